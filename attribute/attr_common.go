@@ -1,9 +1,8 @@
 package attribute
 
 import (
-	"errors"
-	"fmt"
 	"math"
+	"net"
 	"strconv"
 )
 
@@ -54,6 +53,7 @@ const (
 	replyStatusCategory = attrCategory(5)
 	stringCategory      = attrCategory(6)
 	vlanCategory        = attrCategory(7)
+	ipv6Category        = attrCategory(8) // no types known yet, see attr_ipv6.go
 )
 
 var (
@@ -117,6 +117,7 @@ var (
 	attrLenByCategory = map[attrCategory]int{
 		duplexCategory:      3,
 		ipv4Category:        6,
+		ipv6Category:        18,
 		macCategory:         8,
 		speedCategory:       6,
 		replyStatusCategory: 3,
@@ -127,6 +128,7 @@ var (
 	attrCategoryString = map[attrCategory]string{
 		duplexCategory:      "interface duplex",
 		ipv4Category:        "IPv4 address",
+		ipv6Category:        "IPv6 address",
 		macCategory:         "MAC address",
 		speedCategory:       "interface speed",
 		replyStatusCategory: "reply status",
@@ -149,16 +151,16 @@ func MarshalAttribute(a Attribute) []byte {
 func UnmarshalAttribute(b []byte) (Attribute, error) {
 	observedLength := len(b)
 	if observedLength < MinAttrLen {
-		return nil, fmt.Errorf("undersize attribute, cannot unmarshal %d bytes (%d byte minimum)", observedLength, MinAttrLen)
+		return nil, newAttrError(0, ErrLength, "undersize attribute, cannot unmarshal %d bytes (%d byte minimum)", observedLength, MinAttrLen)
 	}
 
 	if observedLength > math.MaxUint8 {
-		return nil, fmt.Errorf("oversize attribute, cannot unmarshal %d bytes (%d byte maximum)", observedLength, math.MaxUint8)
+		return nil, newAttrError(AttrType(b[0]), ErrLength, "oversize attribute, cannot unmarshal %d bytes (%d byte maximum)", observedLength, math.MaxUint8)
 	}
 
 	claimedLength := int(b[1])
 	if observedLength != claimedLength {
-		return nil, fmt.Errorf("cannot unmarshal attribute. length field says %d bytes, got %d bytes", observedLength, claimedLength)
+		return nil, newAttrError(AttrType(b[0]), ErrLength, "cannot unmarshal attribute. length field says %d bytes, got %d bytes", claimedLength, observedLength)
 	}
 
 	t := AttrType(b[0])
@@ -167,6 +169,8 @@ func UnmarshalAttribute(b []byte) (Attribute, error) {
 		return &duplexAttribute{attrType: t, attrData: b[2:]}, nil
 	case ipv4Category:
 		return &ipv4Attribute{attrType: t, attrData: b[2:]}, nil
+	case ipv6Category:
+		return &ipv6Attribute{attrType: t, attrData: b[2:]}, nil
 	case macCategory:
 		return &macAttribute{attrType: t, attrData: b[2:]}, nil
 	case replyStatusCategory:
@@ -179,7 +183,7 @@ func UnmarshalAttribute(b []byte) (Attribute, error) {
 		return &vlanAttribute{attrType: t, attrData: b[2:]}, nil
 	}
 
-	return nil, fmt.Errorf("cannot umarshal attribute of unknown type %d", t)
+	return nil, newAttrError(t, ErrUnknownType, "cannot umarshal attribute of unknown type %d", t)
 }
 
 // Attribute represents an attribute field from a
@@ -220,6 +224,7 @@ type AttrBuilder interface {
 	// Use it for attributes belonging to these categories:
 	//   duplexCategory: "Half" / "Full" / "Auto"
 	//   ipv4Category: "x.x.x.x"
+	//   ipv6Category: "x:x::x"
 	//   macCategory: "xx:xx:xx:xx:xx:xx"
 	//   replyStatusCategory "Success" / "Source Mac address not found"
 	//   speedCategory: "10Mb/s" / "1Gb/s" / "10Tb/s"
@@ -288,7 +293,7 @@ func (o *defaultAttrBuilder) SetBytes(b []byte) AttrBuilder {
 
 func (o *defaultAttrBuilder) Build() (Attribute, error) {
 	if o.typeHasBeenSet != true {
-		return nil, errors.New("`Attribute.Build()' called without first having set attribute type")
+		return nil, newAttrError(0, ErrTypeNotSet, "`Attribute.Build()' called without first having set attribute type")
 	}
 
 	switch o.attrType {
@@ -307,7 +312,10 @@ func (o *defaultAttrBuilder) Build() (Attribute, error) {
 	case ReplyStatusType:
 		return o.newReplyStatusAttribute()
 	}
-	return nil, fmt.Errorf("cannot build, unrecognized attribute type `%d'", o.attrType)
+	if attrCategoryByType[o.attrType] == ipv6Category {
+		return o.newIpv6Attribute()
+	}
+	return nil, newAttrError(o.attrType, ErrUnknownType, "cannot build, unrecognized attribute type `%d'", o.attrType)
 }
 
 // checkTypeLen checks an attribute's Attribute.Type() and Attribute.Len()
@@ -315,19 +323,18 @@ func (o *defaultAttrBuilder) Build() (Attribute, error) {
 func checkTypeLen(a Attribute, category attrCategory) error {
 	// Check the supplied attribute against the supplied category
 	if attrCategoryByType[a.Type()] != category {
-		return fmt.Errorf("expected '%s' category attribute, got '%s'", attrCategoryString[attrCategoryByType[a.Type()]], AttrTypeString[a.Type()])
+		return newAttrError(a.Type(), ErrWrongCategory, "expected '%s' category attribute, got '%s'", attrCategoryString[category], AttrTypeString[a.Type()])
 	}
 
 	// An attribute should never be less than 3 bytes (including TL header)
 	if a.Len() < MinAttrLen {
-		return fmt.Errorf("undersize attribute: got %d bytes, need at least %d bytes", a.Len(), MinAttrLen)
+		return newAttrError(a.Type(), ErrLength, "undersize attribute: got %d bytes, need at least %d bytes", a.Len(), MinAttrLen)
 	}
 
 	// l2t attribute length field is only a single byte. We better
 	// not have more data than can be described by that byte.
 	if a.Len() > math.MaxUint8 {
-		msg := fmt.Sprintf("oversize attribute: got %d bytes, max %d bytes", a.Len(), math.MaxUint8)
-		return errors.New(msg)
+		return newAttrError(a.Type(), ErrLength, "oversize attribute: got %d bytes, max %d bytes", a.Len(), math.MaxUint8)
 	}
 
 	// Some attribute types have variable lengths.
@@ -336,12 +343,25 @@ func checkTypeLen(a Attribute, category attrCategory) error {
 	expectedLen := attrLenByCategory[attrCategoryByType[a.Type()]]
 	if expectedLen >= MinAttrLen {
 		if int(a.Len()) != expectedLen {
-			return fmt.Errorf("%s attribute should be exactly %d bytes, got %d bytes", AttrTypeString[a.Type()], expectedLen, a.Len())
+			return newAttrError(a.Type(), ErrLength, "%s attribute should be exactly %d bytes, got %d bytes", AttrTypeString[a.Type()], expectedLen, a.Len())
 		}
 	}
 	return nil
 }
 
+// NewSrcIpAttribute returns a source address attribute suitable for ip,
+// which is our address as seen by the switch. Only IPv4 source addresses
+// can be expressed in L2T at this time.
+func NewSrcIpAttribute(ip net.IP) (Attribute, error) {
+	if ip.To4() == nil {
+		return nil, newAttrError(SrcIPv4Type, ErrInvalidPayload, "no L2T attribute can carry source address `%s'", ip)
+	}
+	return NewAttrBuilder().
+		SetType(SrcIPv4Type).
+		SetBytes(ip.To4()).
+		Build()
+}
+
 // LocationOfAttributeByType returns the index of the first instance
 // of an AttrType within a slice, or -1 if not found
 func LocationOfAttributeByType(s []Attribute, aType AttrType) int {
@@ -363,7 +383,7 @@ func AttrStringToType(in string) (AttrType, error) {
 		if inAsInt >= 0 && inAsInt <= math.MaxUint8 {
 			return AttrType(inAsInt), nil
 		} else {
-			return 0, fmt.Errorf("value %d out of range", inAsInt)
+			return 0, newAttrError(0, ErrUnknownType, "value %d out of range", inAsInt)
 		}
 	} else {
 		for t, s := range AttrTypeString {
@@ -372,7 +392,7 @@ func AttrStringToType(in string) (AttrType, error) {
 			}
 		}
 	}
-	return 0, fmt.Errorf("unknown attribute type %s", in)
+	return 0, newAttrError(0, ErrUnknownType, "unknown attribute type %s", in)
 }
 
 // SortAttributes sorts a map (what you'd get from message.Attributes())
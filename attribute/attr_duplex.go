@@ -1,8 +1,6 @@
 package attribute
 
 import (
-	"fmt"
-	"errors"
 	"strings"
 )
 
@@ -48,7 +46,7 @@ func (o duplexAttribute) Validate() error {
 	}
 
 	if _, ok := portDuplexToString[portDuplex(o.attrData[0])]; !ok {
-		return fmt.Errorf("`%#x' not a valid payload for %s", o.attrData[0], AttrTypeString[o.attrType])
+		return newAttrError(o.attrType, ErrInvalidPayload, "`%#x' not a valid payload for %s", o.attrData[0], AttrTypeString[o.attrType])
 	}
 
 	return nil
@@ -71,7 +69,7 @@ func (o *defaultAttrBuilder) newDuplexAttribute() (Attribute, error) {
 			}
 		}
 		if !success {
-			return nil, fmt.Errorf("string payload `%s' unrecognized for duplex type", o.stringPayload)
+			return nil, newAttrError(o.attrType, ErrInvalidPayload, "string payload `%s' unrecognized for duplex type", o.stringPayload)
 		}
 	case o.intHasBeenSet:
 		for portDuplex, _ := range portDuplexToString {
@@ -81,15 +79,15 @@ func (o *defaultAttrBuilder) newDuplexAttribute() (Attribute, error) {
 			}
 		}
 		if !success {
-			return nil, fmt.Errorf("int payload `%d' unrecognized for duplex type", o.intPayload)
+			return nil, newAttrError(o.attrType, ErrInvalidPayload, "int payload `%d' unrecognized for duplex type", o.intPayload)
 		}
 	case o.bytesHasBeenSet:
 		if len(o.bytesPayload) != 1 {
-			return nil, errors.New("bytes payload invalid length for creating duplex attribute")
+			return nil, newAttrError(o.attrType, ErrLength, "bytes payload invalid length for creating duplex attribute")
 		}
 		duplexByte = o.bytesPayload[0]
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[duplexCategory])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[duplexCategory])
 	}
 
 	a := &duplexAttribute{
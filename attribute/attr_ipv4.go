@@ -2,7 +2,6 @@ package attribute
 
 import (
 	"encoding/binary"
-	"fmt"
 	"net"
 )
 
@@ -41,20 +40,20 @@ func (o *defaultAttrBuilder) newIpv4Attribute() (Attribute, error) {
 	ipv4Bytes := make([]byte, 4)
 	switch {
 	case o.stringHasBeenSet:
-		b := net.ParseIP(o.stringPayload)
+		b := net.ParseIP(o.stringPayload).To4()
 		if b == nil {
-			return nil, fmt.Errorf("cannot convert `%s' to an IPv4 address", o.stringPayload)
+			return nil, newAttrError(o.attrType, ErrInvalidPayload, "cannot convert `%s' to an IPv4 address", o.stringPayload)
 		}
-		ipv4Bytes = b[len(b)-4:]
+		ipv4Bytes = b
 	case o.bytesHasBeenSet:
 		if len(o.bytesPayload) != 4 {
-			return nil, fmt.Errorf("attempt to configure IPv4 attribute with %d byte payload", len(o.bytesPayload))
+			return nil, newAttrError(o.attrType, ErrLength, "attempt to configure IPv4 attribute with %d byte payload", len(o.bytesPayload))
 		}
 		ipv4Bytes = o.bytesPayload
 	case o.intHasBeenSet:
 		binary.BigEndian.PutUint32(ipv4Bytes, o.intPayload)
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[ipv4Category])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[ipv4Category])
 	}
 
 	a := &ipv4Attribute{
@@ -0,0 +1,70 @@
+package attribute
+
+import (
+	"net"
+)
+
+// ipv6Attribute carries a 16 byte IPv6 address. No L2T attribute type
+// carrying an IPv6 address has been observed yet. When one turns up, add
+// it to the maps in attr_common.go with ipv6Category, and to
+// NewSrcIpAttribute() if it's a source address.
+type ipv6Attribute struct {
+	attrType AttrType
+	attrData []byte
+}
+
+func (o ipv6Attribute) Type() AttrType {
+	return o.attrType
+}
+
+func (o ipv6Attribute) Len() uint8 {
+	return uint8(TLsize + len(o.attrData))
+}
+
+func (o ipv6Attribute) String() string {
+	return net.IP(o.attrData).String()
+}
+
+func (o ipv6Attribute) Validate() error {
+	err := checkTypeLen(o, ipv6Category)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (o ipv6Attribute) Bytes() []byte {
+	return o.attrData
+}
+
+// newIpv6Attribute returns a new attribute from ipv6Category
+func (o *defaultAttrBuilder) newIpv6Attribute() (Attribute, error) {
+	var ipv6Bytes []byte
+	switch {
+	case o.stringHasBeenSet:
+		b := net.ParseIP(o.stringPayload)
+		if b == nil || b.To4() != nil {
+			return nil, newAttrError(o.attrType, ErrInvalidPayload, "cannot convert `%s' to an IPv6 address", o.stringPayload)
+		}
+		ipv6Bytes = b.To16()
+	case o.bytesHasBeenSet:
+		if len(o.bytesPayload) != net.IPv6len {
+			return nil, newAttrError(o.attrType, ErrLength, "attempt to configure IPv6 attribute with %d byte payload", len(o.bytesPayload))
+		}
+		ipv6Bytes = o.bytesPayload
+	default:
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[ipv6Category])
+	}
+
+	a := &ipv6Attribute{
+		attrType: o.attrType,
+		attrData: ipv6Bytes,
+	}
+
+	err := a.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
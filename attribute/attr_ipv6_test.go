@@ -0,0 +1,75 @@
+package attribute
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+// withFakeIpv6Type registers an ipv6Category attribute type for the
+// duration of a test, because no real ones are known.
+func withFakeIpv6Type(t *testing.T, f func(AttrType)) {
+	fake := AttrType(200)
+	attrCategoryByType[fake] = ipv6Category
+	AttrTypeString[fake] = "FAKE_IPV6"
+	defer func() {
+		delete(attrCategoryByType, fake)
+		delete(AttrTypeString, fake)
+	}()
+	f(fake)
+}
+
+func TestIpv6Attribute(t *testing.T) {
+	withFakeIpv6Type(t, func(fake AttrType) {
+		a, err := NewAttrBuilder().SetType(fake).SetString("2001:db8::1").Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Len() != 18 || a.String() != "2001:db8::1" {
+			t.Fatalf("unexpected attribute: len %d, %s", a.Len(), a.String())
+		}
+
+		b, err := UnmarshalAttribute(MarshalAttribute(a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a.Bytes(), b.Bytes()) || b.Validate() != nil {
+			t.Fatalf("round trip failed: %v", b.Bytes())
+		}
+
+		for _, s := range []string{"192.0.2.1", "::ffff:192.0.2.1", "bogus"} {
+			_, err := NewAttrBuilder().SetType(fake).SetString(s).Build()
+			if !errors.Is(err, ErrInvalidPayload) {
+				t.Fatalf("%s: expected ErrInvalidPayload, got %v", s, err)
+			}
+		}
+
+		_, err = NewAttrBuilder().SetType(fake).SetBytes([]byte{1, 2, 3, 4}).Build()
+		if !errors.Is(err, ErrLength) {
+			t.Fatalf("expected ErrLength, got %v", err)
+		}
+	})
+}
+
+func TestNewSrcIpAttribute(t *testing.T) {
+	a, err := NewSrcIpAttribute(net.ParseIP("192.0.2.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Type() != SrcIPv4Type || a.String() != "192.0.2.1" {
+		t.Fatalf("unexpected attribute: %s %s", AttrTypeString[a.Type()], a.String())
+	}
+
+	_, err = NewSrcIpAttribute(net.ParseIP("2001:db8::1"))
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected ErrInvalidPayload, got %v", err)
+	}
+}
+
+func TestIpv4AttributeRejectsIpv6(t *testing.T) {
+	_, err := NewAttrBuilder().SetType(SrcIPv4Type).SetString("2001:db8::1").Build()
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected ErrInvalidPayload, got %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package attribute
 
 import (
-	"fmt"
 	"net"
 )
 
@@ -53,10 +52,10 @@ func (o *defaultAttrBuilder) newMacAttribute() (Attribute, error) {
 	case o.stringHasBeenSet:
 		macAddr, err = net.ParseMAC(o.stringPayload)
 		if err != nil {
-			return nil, err
+			return nil, wrapAttrError(o.attrType, ErrInvalidPayload, err, "cannot convert `%s' to a MAC address", o.stringPayload)
 		}
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[macCategory])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[macCategory])
 	}
 
 	a := &macAttribute{
@@ -131,17 +131,17 @@ func (o *defaultAttrBuilder) newReplyStatusAttribute() (Attribute, error) {
 			}
 		}
 		if !success {
-			return nil, fmt.Errorf("string payload `%s' unrecognized for reply status type", o.stringPayload)
+			return nil, newAttrError(o.attrType, ErrInvalidPayload, "string payload `%s' unrecognized for reply status type", o.stringPayload)
 		}
 	case o.intHasBeenSet:
 		replyStatusByte = uint8(o.intPayload)
 	case o.bytesHasBeenSet:
 		if len(o.bytesPayload) != 1 {
-			return nil, fmt.Errorf("cannot use %d bytes to build a reply status attribute", len(o.bytesPayload))
+			return nil, newAttrError(o.attrType, ErrLength, "cannot use %d bytes to build a reply status attribute", len(o.bytesPayload))
 		}
 		replyStatusByte = o.bytesPayload[0]
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[replyStatusCategory])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[replyStatusCategory])
 	}
 
 	a := &replyStatusAttribute{
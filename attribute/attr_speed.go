@@ -2,8 +2,6 @@ package attribute
 
 import (
 	"encoding/binary"
-	"errors"
-	"fmt"
 	"math"
 	"reflect"
 	"strconv"
@@ -47,12 +45,12 @@ func (o speedAttribute) Validate() error {
 	}
 
 	if binary.BigEndian.Uint32(o.attrData) > maxSpeedWireFormat {
-		return fmt.Errorf("wire format speed `%d' exceeds maximum value (%d)", binary.BigEndian.Uint32(o.attrData), maxSpeedWireFormat)
+		return newAttrError(o.attrType, ErrInvalidPayload, "wire format speed `%d' exceeds maximum value (%d)", binary.BigEndian.Uint32(o.attrData), maxSpeedWireFormat)
 	}
 
 	speedVal := int(math.Pow(10, float64(binary.BigEndian.Uint32(o.attrData))))
 	if speedVal > maxSpeedMbps {
-		return fmt.Errorf("interface speed `%d' exceeds maximum value (%d)", speedVal, maxSpeedMbps)
+		return newAttrError(o.attrType, ErrInvalidPayload, "interface speed `%d' exceeds maximum value (%d)", speedVal, maxSpeedMbps)
 	}
 
 	return nil
@@ -80,7 +78,7 @@ func (o *defaultAttrBuilder) newSpeedAttribute() (Attribute, error) {
 			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[speedCategory])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[speedCategory])
 	}
 
 	a := &speedAttribute{
@@ -135,7 +133,7 @@ func SpeedStringToBytes(s string) ([]byte, error) {
 	// Did we get valid characters?
 	for _, v := range s {
 		if v > unicode.MaxASCII || !unicode.IsPrint(rune(v)) {
-			return nil, errors.New("string contains invalid characters")
+			return nil, newAttrError(0, ErrInvalidPayload, "string contains invalid characters")
 		}
 	}
 
@@ -172,7 +170,7 @@ func SpeedStringToBytes(s string) ([]byte, error) {
 
 			// Now make sure we've only got math-y characters left in the string.
 			if strings.Trim(trimmed, "0123456789.") != "" {
-				return nil, fmt.Errorf("cannot parse `%s' as an interface speed", s)
+				return nil, newAttrError(0, ErrInvalidPayload, "cannot parse `%s' as an interface speed", s)
 			}
 
 			// speedFloat will contain the value previously expressed by
@@ -181,7 +179,7 @@ func SpeedStringToBytes(s string) ([]byte, error) {
 			// If "100Gb/s", speedFloat will be float64(100)
 			speedFloat, err := strconv.ParseFloat(trimmed, 32)
 			if err != nil {
-				return nil, err
+				return nil, wrapAttrError(0, ErrInvalidPayload, err, "cannot parse `%s' as an interface speed", s)
 			}
 
 			// speedFloatMbps will contain the value previously expressed by
@@ -199,5 +197,5 @@ func SpeedStringToBytes(s string) ([]byte, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("cannot parse speed string: `%s'", s)
+	return nil, newAttrError(0, ErrInvalidPayload, "cannot parse speed string: `%s'", s)
 }
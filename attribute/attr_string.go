@@ -1,8 +1,6 @@
 package attribute
 
 import (
-	"errors"
-	"fmt"
 	"math"
 	"strconv"
 	"strings"
@@ -39,24 +37,24 @@ func (o stringAttribute) Validate() error {
 
 	// Underlength?
 	if int(o.Len()) < TLsize+len(string(stringTerminator)) {
-		return fmt.Errorf("underlength string: got %d bytes (min %d)", o.Len(), TLsize+len(string(stringTerminator)))
+		return newAttrError(o.attrType, ErrLength, "underlength string: got %d bytes (min %d)", o.Len(), TLsize+len(string(stringTerminator)))
 	}
 
 	// Overlength?
 	if o.Len() > math.MaxUint8 {
-		return fmt.Errorf("overlength string: got %d bytes (max %d)", o.Len(), math.MaxUint8)
+		return newAttrError(o.attrType, ErrLength, "overlength string: got %d bytes (max %d)", o.Len(), math.MaxUint8)
 	}
 
 	// Ends with string terminator?
 	if !strings.HasSuffix(string(o.attrData), string(stringTerminator)) {
-		return fmt.Errorf("string missing termination character ` %#x'", string(stringTerminator))
+		return newAttrError(o.attrType, ErrInvalidPayload, "string missing termination character ` %#x'", string(stringTerminator))
 
 	}
 
 	// Printable?
 	for _, v := range o.attrData[:(len(o.attrData) - 1)] {
 		if v > unicode.MaxASCII || !unicode.IsPrint(rune(v)) {
-			return errors.New("string is not printable.")
+			return newAttrError(o.attrType, ErrInvalidPayload, "string is not printable.")
 		}
 	}
 
@@ -78,7 +76,7 @@ func (o *defaultAttrBuilder) newStringAttribute() (Attribute, error) {
 	case o.stringHasBeenSet:
 		stringBytes = []byte(o.stringPayload + string(stringTerminator))
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[stringCategory])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[stringCategory])
 	}
 
 	a := &stringAttribute{
@@ -2,7 +2,6 @@ package attribute
 
 import (
 	"encoding/binary"
-	"fmt"
 	"strconv"
 )
 
@@ -38,7 +37,7 @@ func (o vlanAttribute) Validate() error {
 
 	vlan := binary.BigEndian.Uint16(o.attrData)
 	if vlan > maxVLAN || vlan < minVLAN {
-		return fmt.Errorf("VLAN %d value out of range", vlan)
+		return newAttrError(o.attrType, ErrInvalidPayload, "VLAN %d value out of range", vlan)
 	}
 
 	return nil
@@ -56,7 +55,7 @@ func (o *defaultAttrBuilder) newVlanAttribute() (Attribute, error) {
 	case o.stringHasBeenSet:
 		vlan, err := strconv.Atoi(o.stringPayload)
 		if err != nil {
-			return nil, err
+			return nil, wrapAttrError(o.attrType, ErrInvalidPayload, err, "cannot convert `%s' to a VLAN", o.stringPayload)
 		}
 		binary.BigEndian.PutUint16(vlanBytes, uint16(vlan))
 	case o.intHasBeenSet:
@@ -65,7 +64,7 @@ func (o *defaultAttrBuilder) newVlanAttribute() (Attribute, error) {
 	case o.bytesHasBeenSet:
 		vlanBytes = o.bytesPayload
 	default:
-		return nil, fmt.Errorf("cannot build, no attribute payload found for category %s attribute", attrCategoryString[vlanCategory])
+		return nil, newAttrError(o.attrType, ErrNoPayload, "cannot build, no attribute payload found for category %s attribute", attrCategoryString[vlanCategory])
 	}
 
 	a := &vlanAttribute{
@@ -0,0 +1,181 @@
+package attribute
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// AttrDoc is the JSON / YAML representation of an Attribute. Type is the
+// AttrTypeString name (or a number, for unknown types). Value holds the
+// payload in its natural form: text for MAC addresses, IP addresses,
+// strings, speed, duplex and reply status, a number for VLANs. When the
+// natural form wouldn't rebuild the exact wire payload (malformed data,
+// unknown reply status, etc...) Raw holds the payload in hex instead.
+type AttrDoc struct {
+	Type  string      `json:"type" yaml:"type"`
+	Value interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	Raw   string      `json:"raw,omitempty" yaml:"raw,omitempty"`
+}
+
+// NewAttrDoc returns the AttrDoc representation of an Attribute.
+func NewAttrDoc(a Attribute) AttrDoc {
+	doc := AttrDoc{Type: AttrTypeString[a.Type()]}
+	if doc.Type == "" {
+		doc.Type = strconv.Itoa(int(a.Type()))
+	}
+
+	if a.Validate() == nil {
+		value := naturalValue(a)
+		rebuilt, err := buildFromValue(a.Type(), value)
+		if err == nil && bytes.Equal(rebuilt.Bytes(), a.Bytes()) {
+			doc.Value = value
+			return doc
+		}
+	}
+
+	doc.Raw = hex.EncodeToString(a.Bytes())
+	return doc
+}
+
+// Attribute returns the Attribute described by the AttrDoc.
+func (o AttrDoc) Attribute() (Attribute, error) {
+	t, err := AttrStringToType(o.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Raw != "" {
+		payload, err := hex.DecodeString(o.Raw)
+		if err != nil {
+			return nil, wrapAttrError(t, ErrInvalidPayload, err, "cannot decode raw %s payload", AttrTypeString[t])
+		}
+		if len(payload)+TLsize > math.MaxUint8 {
+			return nil, newAttrError(t, ErrLength, "oversize raw payload: %d bytes", len(payload))
+		}
+		return UnmarshalAttribute(append([]byte{byte(t), byte(len(payload) + TLsize)}, payload...))
+	}
+
+	return buildFromValue(t, o.Value)
+}
+
+// naturalValue returns the attribute payload in the form used by AttrDoc.
+func naturalValue(a Attribute) interface{} {
+	switch attrCategoryByType[a.Type()] {
+	case vlanCategory:
+		return int(a.Bytes()[0])<<8 | int(a.Bytes()[1])
+	case replyStatusCategory:
+		if _, ok := replyStatusToString[replyStatus(a.Bytes()[0])]; !ok {
+			return int(a.Bytes()[0])
+		}
+	}
+	return a.String()
+}
+
+// buildFromValue builds an attribute of the specified type using a value
+// from an AttrDoc. Numbers may arrive as any of the types produced by the
+// JSON and YAML decoders.
+func buildFromValue(t AttrType, value interface{}) (Attribute, error) {
+	builder := NewAttrBuilder().SetType(t)
+	switch v := value.(type) {
+	case string:
+		builder.SetString(v)
+	case float64:
+		if v < 0 || v > math.MaxUint32 || v != math.Trunc(v) {
+			return nil, newAttrError(t, ErrInvalidPayload, "cannot use %v as %s payload", v, AttrTypeString[t])
+		}
+		builder.SetInt(uint32(v))
+	case json.Number:
+		i, err := strconv.ParseUint(v.String(), 10, 32)
+		if err != nil {
+			return nil, wrapAttrError(t, ErrInvalidPayload, err, "cannot use %s as %s payload", v, AttrTypeString[t])
+		}
+		builder.SetInt(uint32(i))
+	case int:
+		if v < 0 || v > math.MaxUint32 {
+			return nil, newAttrError(t, ErrInvalidPayload, "cannot use %d as %s payload", v, AttrTypeString[t])
+		}
+		builder.SetInt(uint32(v))
+	case uint64:
+		if v > math.MaxUint32 {
+			return nil, newAttrError(t, ErrInvalidPayload, "cannot use %d as %s payload", v, AttrTypeString[t])
+		}
+		builder.SetInt(uint32(v))
+	case nil:
+		return nil, newAttrError(t, ErrNoPayload, "no value or raw payload for %s attribute", AttrTypeString[t])
+	default:
+		return nil, newAttrError(t, ErrInvalidPayload, "cannot use %T as %s payload", v, AttrTypeString[t])
+	}
+	return builder.Build()
+}
+
+// UnmarshalAttributeJSON returns the Attribute described by a JSON
+// format AttrDoc.
+func UnmarshalAttributeJSON(b []byte) (Attribute, error) {
+	var doc AttrDoc
+	err := json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Attribute()
+}
+
+// The concrete attribute types all encode as an AttrDoc.
+
+func (o duplexAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o duplexAttribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
+
+func (o ipv4Attribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o ipv4Attribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
+
+func (o macAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o macAttribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
+
+func (o replyStatusAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o replyStatusAttribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
+
+func (o speedAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o speedAttribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
+
+func (o stringAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o stringAttribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
+
+func (o vlanAttribute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewAttrDoc(o))
+}
+
+func (o vlanAttribute) MarshalYAML() (interface{}, error) {
+	return NewAttrDoc(o), nil
+}
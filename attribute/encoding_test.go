@@ -0,0 +1,85 @@
+package attribute
+
+import (
+	"bytes"
+	"encoding/json"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestAttrJSONRoundTrip(t *testing.T) {
+	var attrs []Attribute
+	for _, b := range [][]byte{
+		{byte(SrcMacType), 8, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		{byte(VlanType), 4, 0x0f, 0xfe},
+		{byte(DevNameType), 7, 'h', 'o', 's', 't', 0},
+		{byte(DevIPv4Type), 6, 192, 0, 2, 1},
+		{byte(InPortSpeedType), 6, 0, 0, 0, 3},
+		{byte(InPortSpeedType), 6, 0, 0, 0, 0},
+		{byte(InPortDuplexType), 3, 2},
+		{byte(ReplyStatusType), 3, 1},
+		{byte(ReplyStatusType), 3, 42},
+		{byte(DevTypeType), 5, 'b', 'a', 'd'}, // missing terminator
+		{byte(OutPortDuplexType), 3, 9},       // invalid duplex
+	} {
+		a, err := UnmarshalAttribute(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs = append(attrs, a)
+	}
+
+	for _, a := range attrs {
+		j, err := json.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := UnmarshalAttributeJSON(j)
+		if err != nil {
+			t.Fatalf("%s: %s", j, err)
+		}
+		if !bytes.Equal(MarshalAttribute(a), MarshalAttribute(result)) {
+			t.Fatalf("JSON round trip %s: expected %v, got %v", j, MarshalAttribute(a), MarshalAttribute(result))
+		}
+
+		y, err := yaml.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc AttrDoc
+		err = yaml.Unmarshal(y, &doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err = doc.Attribute()
+		if err != nil {
+			t.Fatalf("%s: %s", y, err)
+		}
+		if !bytes.Equal(MarshalAttribute(a), MarshalAttribute(result)) {
+			t.Fatalf("YAML round trip %s: expected %v, got %v", y, MarshalAttribute(a), MarshalAttribute(result))
+		}
+	}
+}
+
+func TestAttrJSONNatural(t *testing.T) {
+	a, err := NewAttrBuilder().SetType(VlanType).SetInt(100).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"type":"L2_ATTR_VLAN","value":100}`
+	if string(j) != expected {
+		t.Fatalf("expected %s, got %s", expected, j)
+	}
+
+	a, err = UnmarshalAttributeJSON([]byte(`{"type":"L2_ATTR_DST_MAC","value":"00:11:22:33:44:55"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != "00:11:22:33:44:55" {
+		t.Fatalf("expected 00:11:22:33:44:55, got %s", a.String())
+	}
+}
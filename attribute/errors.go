@@ -0,0 +1,63 @@
+package attribute
+
+import (
+	"errors"
+	"fmt"
+)
+
+// These values describe the kinds of problems reported by AttrError. Test
+// for them with errors.Is().
+var (
+	ErrTypeNotSet     = errors.New("attribute type not set")
+	ErrUnknownType    = errors.New("unknown attribute type")
+	ErrWrongCategory  = errors.New("wrong attribute category")
+	ErrLength         = errors.New("bad attribute length")
+	ErrNoPayload      = errors.New("no attribute payload")
+	ErrInvalidPayload = errors.New("invalid attribute payload")
+)
+
+// AttrError describes a problem building, unmarshaling or validating an
+// attribute. Kind is one of the Err* values above, and satisfies
+// errors.Is(). Err holds the underlying error, if there is one.
+type AttrError struct {
+	Type AttrType
+	Kind error
+	Msg  string
+	Err  error
+}
+
+func (o *AttrError) Error() string {
+	if o.Err != nil {
+		return o.Msg + ": " + o.Err.Error()
+	}
+	return o.Msg
+}
+
+// Is returns a boolean indicating whether target matches the kind of error.
+func (o *AttrError) Is(target error) bool {
+	return target == o.Kind
+}
+
+// Unwrap returns the underlying error, if any.
+func (o *AttrError) Unwrap() error {
+	return o.Err
+}
+
+// newAttrError returns an *AttrError with a formatted message.
+func newAttrError(t AttrType, kind error, format string, a ...interface{}) error {
+	return &AttrError{
+		Type: t,
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, a...),
+	}
+}
+
+// wrapAttrError returns an *AttrError wrapping the supplied error.
+func wrapAttrError(t AttrType, kind error, err error, format string, a ...interface{}) error {
+	return &AttrError{
+		Type: t,
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, a...),
+		Err:  err,
+	}
+}
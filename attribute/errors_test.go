@@ -0,0 +1,26 @@
+package attribute
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAttrError(t *testing.T) {
+	_, err := UnmarshalAttribute([]byte{byte(SrcIPv4Type), 5, 1, 2, 3, 4})
+	if !errors.Is(err, ErrLength) {
+		t.Fatalf("expected ErrLength, got %v", err)
+	}
+
+	var ae *AttrError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected *AttrError, got %T", err)
+	}
+	if ae.Type != SrcIPv4Type {
+		t.Fatalf("expected type %d, got %d", SrcIPv4Type, ae.Type)
+	}
+
+	_, err = NewAttrBuilder().Build()
+	if !errors.Is(err, ErrTypeNotSet) {
+		t.Fatalf("expected ErrTypeNotSet, got %v", err)
+	}
+}
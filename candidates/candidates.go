@@ -0,0 +1,88 @@
+package candidates
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+	"sort"
+)
+
+// Candidate is a MAC address to look for. A Vlan of zero means the MAC
+// should be looked for in every VLAN being swept.
+type Candidate struct {
+	Mac    net.HardwareAddr
+	Vlan   int
+	Source string // name of the Source which generated the Candidate
+}
+
+// Source generates Candidates. The vlans argument lists the VLANs being
+// swept, for sources which generate per-VLAN candidates.
+type Source interface {
+	Name() string
+	Candidates(vlans []int) ([]Candidate, error)
+}
+
+// Generate collects Candidates from each Source. Duplicates (same MAC and
+// VLAN) are dropped, keeping the first.
+func Generate(sources []Source, vlans []int) ([]Candidate, error) {
+	var out []Candidate
+	seen := make(map[string]bool)
+	for _, s := range sources {
+		candidates, err := s.Candidates(vlans)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range candidates {
+			key := fmt.Sprintf("%s/%d", c.Mac, c.Vlan)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// Sweep asks the target about each Candidate in each of the VLANs (or just
+// the Candidate's own VLAN, if it has one), and returns the Candidates the
+// switch knows about, with Vlan set to where each was found, sorted by VLAN
+// and MAC. Errors for individual
+// queries are returned alongside. If progressChan is not nil, it receives
+// a struct{} as each query completes.
+func Sweep(t target.Target, candidates []Candidate, vlans []int, progressChan chan struct{}) ([]Candidate, []error) {
+	var queries []target.MacVlan
+	var from []Candidate // maps queries to candidates
+	for _, c := range candidates {
+		if c.Vlan != 0 {
+			queries = append(queries, target.MacVlan{Mac: c.Mac, Vlan: c.Vlan})
+			from = append(from, c)
+			continue
+		}
+		for _, v := range vlans {
+			queries = append(queries, target.MacVlan{Mac: c.Mac, Vlan: v})
+			from = append(from, c)
+		}
+	}
+
+	var found []Candidate
+	var errs []error
+	for i, r := range t.MacsInVlans(queries, progressChan) {
+		switch {
+		case r.Err != nil:
+			errs = append(errs, r.Err)
+		case r.Found:
+			c := from[i]
+			c.Vlan = r.Vlan
+			found = append(found, c)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Vlan != found[j].Vlan {
+			return found[i].Vlan < found[j].Vlan
+		}
+		return found[i].Mac.String() < found[j].Mac.String()
+	})
+	return found, errs
+}
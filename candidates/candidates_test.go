@@ -0,0 +1,226 @@
+package candidates
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/target"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVirtualRouterMacs(t *testing.T) {
+	for _, test := range []struct {
+		protocol string
+		group    int
+		expected string
+	}{
+		{HsrpV1, 10, "00:00:0c:07:ac:0a"},
+		{HsrpV2, 4095, "00:00:0c:9f:ff:ff"},
+		{HsrpV2, 300, "00:00:0c:9f:f1:2c"},
+		{Vrrp, 1, "00:00:5e:00:01:01"},
+		{Glbp, 1, "00:07:b4:00:01:01"},
+	} {
+		macs, err := VirtualRouterMacs(test.protocol, test.group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if macs[0].String() != test.expected {
+			t.Fatalf("%s group %d: expected %s, got %s", test.protocol, test.group, test.expected, macs[0])
+		}
+		for _, mac := range macs {
+			p, g, ok := ParseVirtualRouterMac(mac)
+			if !ok || p != test.protocol || g != test.group {
+				t.Fatalf("%s parsed as %s group %d (%t)", mac, p, g, ok)
+			}
+		}
+	}
+
+	_, err := VirtualRouterMacs(Vrrp, 0)
+	if err == nil {
+		t.Fatal("VRRP group 0 should be rejected")
+	}
+	_, _, ok := ParseVirtualRouterMac(net.HardwareAddr{0x00, 0x00, 0x0c, 0x12, 0x34, 0x56})
+	if ok {
+		t.Fatal("ordinary Cisco MAC parsed as virtual router MAC")
+	}
+}
+
+func TestVirtualRouterSource(t *testing.T) {
+	c, err := VirtualRouterSource{Protocols: Protocols()}.Candidates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := 256 + 4096 + 255 + 1024*glbpForwarders
+	if len(c) != expected {
+		t.Fatalf("expected %d candidates, got %d", expected, len(c))
+	}
+
+	c, err = VirtualRouterSource{Protocols: []string{Vrrp}, Groups: []int{0, 1, 2}}.Candidates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(c))
+	}
+}
+
+func TestLoadOuis(t *testing.T) {
+	in := "00-00-0C   (hex)\t\tCisco Systems, Inc\n" +
+		"00000C     (base 16)\t\tCisco Systems, Inc\n" +
+		"\t\t\t\t170 WEST TASMAN DRIVE\n" +
+		"525400 QEMU\n"
+	ouis, err := LoadOuis(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ouis) != 2 || ouis[Oui{0, 0, 0x0c}] != "Cisco Systems, Inc" || ouis[Oui{0x52, 0x54, 0}] != "QEMU" {
+		t.Fatalf("unexpected OUIs: %v", ouis)
+	}
+
+	if len(BundledOuis()) == 0 {
+		t.Fatal("bundled OUI list is empty")
+	}
+}
+
+func TestOuiSource(t *testing.T) {
+	c, err := OuiSource{Vendors: []string{"vmware"}, Count: 3}.Candidates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 9 || c[0].Mac.String() != "00:05:69:00:00:01" {
+		t.Fatalf("unexpected candidates: %v", c)
+	}
+
+	_, err = OuiSource{Vendors: []string{"nobody"}, Count: 3}.Candidates(nil)
+	if err == nil {
+		t.Fatal("unknown vendor should produce an error")
+	}
+}
+
+func TestStpSource(t *testing.T) {
+	base, _ := net.ParseMAC("0011.22ff.fffe")
+	c, err := StpSource{Base: base}.Candidates([]int{1, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 3 || c[0].Vlan != 0 || c[1].Mac.String() != "00:11:22:ff:ff:ff" || c[2].Mac.String() != "00:11:22:00:00:08" || c[2].Vlan != 10 {
+		t.Fatalf("unexpected candidates: %v", c)
+	}
+}
+
+func TestArpSource(t *testing.T) {
+	f, err := ioutil.TempFile("", "arp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("IP address       HW type     Flags       HW address            Mask     Device\n" +
+		"192.0.2.1        0x1         0x2         00:11:22:33:44:55     *        eth0\n" +
+		"192.0.2.2        0x1         0x0         00:00:00:00:00:00     *        eth0\n" +
+		"Internet  192.0.2.3   12   0011.2233.4466  ARPA   Vlan10\n")
+	f.Close()
+
+	c, err := ArpSource{Filename: f.Name()}.Candidates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 2 || c[0].Mac.String() != "00:11:22:33:44:55" || c[1].Mac.String() != "00:11:22:33:44:66" {
+		t.Fatalf("unexpected candidates: %v", c)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	c, err := Generate([]Source{
+		VirtualRouterSource{Protocols: []string{HsrpV1}, Groups: []int{1}},
+		VirtualRouterSource{Protocols: []string{HsrpV1}, Groups: []int{1, 2}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(c))
+	}
+}
+
+// sweepTarget answers MacsInVlans from a list of known MAC/VLAN pairs.
+type sweepTarget struct {
+	target.Target
+	known map[string]bool
+}
+
+func (o sweepTarget) MacsInVlans(queries []target.MacVlan, _ chan struct{}) []target.MacSweepResult {
+	var out []target.MacSweepResult
+	for _, q := range queries {
+		out = append(out, target.MacSweepResult{
+			MacVlan: q,
+			Found:   o.known[fmt.Sprintf("%s %d", q.Mac, q.Vlan)],
+		})
+	}
+	return out
+}
+
+func TestSweep(t *testing.T) {
+	tgt := sweepTarget{known: map[string]bool{
+		"00:00:0c:07:ac:01 2": true,
+		"00:00:0c:07:ac:02 1": true,
+		"00:00:0c:07:ac:03 1": true,
+	}}
+	c, err := Generate([]Source{VirtualRouterSource{Protocols: []string{HsrpV1}, Groups: []int{1, 2, 3}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c[2].Vlan = 2 // only look for group 3 in VLAN 2
+
+	found, errs := Sweep(tgt, c, []int{1, 2}, nil)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(found) != 2 || found[0].Vlan != 1 || found[0].Source != "hsrpv1 group 2" || found[1].Vlan != 2 || found[1].Source != "hsrpv1 group 1" {
+		t.Fatalf("unexpected results: %v", found)
+	}
+}
+
+// gatewayTarget adds port information to sweepTarget.
+type gatewayTarget struct {
+	sweepTarget
+}
+
+func (o gatewayTarget) Send(msg message.Msg) (message.Msg, error) {
+	builder := message.NewMsgBuilder().SetType(message.ReplySrc)
+	port, err := attribute.NewAttrBuilder().SetType(attribute.InPortNameType).SetString("Gi1/0/48").Build()
+	if err != nil {
+		return nil, err
+	}
+	return builder.SetAttr(port).Build(), nil
+}
+
+func TestFindGateways(t *testing.T) {
+	tgt := gatewayTarget{sweepTarget{known: map[string]bool{
+		"00:00:0c:07:ac:0a 10": true,
+		"00:00:5e:00:01:14 20": true,
+		"00:07:b4:00:1e:02 30": true,
+	}}}
+
+	gws, errs := FindGateways(tgt, []int{10, 20, 30}, VirtualRouterSource{}, nil)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	expected := []string{
+		"hsrpv1 10 vlan 10 Gi1/0/48",
+		"vrrp 20 vlan 20 Gi1/0/48",
+		"glbp 30 vlan 30 Gi1/0/48",
+	}
+	if len(gws) != len(expected) {
+		t.Fatalf("expected %d gateways, got %v", len(expected), gws)
+	}
+	for i, gw := range gws {
+		got := fmt.Sprintf("%s %d vlan %d %s", gw.Protocol, gw.Group, gw.Vlan, gw.Port)
+		if got != expected[i] {
+			t.Fatalf("expected `%s', got `%s'", expected[i], got)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package candidates generates MAC addresses worth asking a switch about.
+// L2T can't dump a switch's MAC address table, but it will say whether a
+// particular MAC is known in a particular VLAN. Good guesses come from
+// vendor OUIs, router virtual MACs, STP bridge addresses and ARP caches.
+package candidates
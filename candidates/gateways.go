@@ -0,0 +1,98 @@
+package candidates
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+	"strconv"
+)
+
+// Gateway is a virtual router group found in a VLAN.
+type Gateway struct {
+	Protocol string           `json:"protocol"`
+	Group    int              `json:"group"`
+	Vlan     int              `json:"vlan"`
+	Mac      net.HardwareAddr `json:"mac"`
+	Port     string           `json:"port,omitempty"`     // where the switch learned the MAC
+	Neighbor string           `json:"neighbor,omitempty"` // CDP neighbor on that port
+}
+
+// FindGateways sweeps the virtual MACs generated by vr (every group of every
+// protocol, if vr.Protocols is nil) through the VLANs (all VLANs configured
+// on the switch, if vlans is nil), then asks about each
+// MAC found to learn the port it's behind. Errors for individual queries
+// are returned alongside the Gateways found. If progressChan is not nil,
+// it receives a struct{} as each sweep query completes.
+func FindGateways(t target.Target, vlans []int, vr VirtualRouterSource, progressChan chan struct{}) ([]Gateway, []error) {
+	var errs []error
+	if vlans == nil {
+		vlans, errs = target.Vlans(t, nil)
+	}
+	if vr.Protocols == nil {
+		vr.Protocols = Protocols()
+	}
+
+	candidates, err := vr.Candidates(vlans)
+	if err != nil {
+		return nil, append(errs, err)
+	}
+
+	found, sweepErrs := Sweep(t, candidates, vlans, progressChan)
+	errs = append(errs, sweepErrs...)
+
+	var out []Gateway
+	for _, c := range found {
+		p, g, _ := ParseVirtualRouterMac(c.Mac)
+		gw := Gateway{
+			Protocol: p,
+			Group:    g,
+			Vlan:     c.Vlan,
+			Mac:      c.Mac,
+		}
+		err := gw.locate(t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s group %d vlan %d: %w", p, g, c.Vlan, err))
+		}
+		out = append(out, gw)
+	}
+	return out, errs
+}
+
+// locate fills in the Gateway's Port and Neighbor by tracing from the
+// virtual MAC to itself. The switch reports the port where it learned the
+// MAC (and the CDP neighbor there, if any) in its reply.
+func (o *Gateway) locate(t target.Target) error {
+	builder := message.NewMsgBuilder().SetType(message.RequestSrc)
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.SrcMacType, o.Mac.String()},
+		{attribute.DstMacType, o.Mac.String()},
+		{attribute.VlanType, strconv.Itoa(o.Vlan)},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			return err
+		}
+		builder.SetAttr(att)
+	}
+
+	reply, err := t.Send(builder.Build())
+	if err != nil {
+		return err
+	}
+
+	for _, at := range []attribute.AttrType{attribute.InPortNameType, attribute.OutPortNameType} {
+		if port := reply.GetAttr(at); port != nil {
+			o.Port = port.String()
+			break
+		}
+	}
+	if nbr := reply.GetAttr(attribute.NbrIPv4Type); nbr != nil {
+		o.Neighbor = nbr.String()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package candidates
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// Oui is an IEEE organizationally unique identifier: the first three bytes
+// of a MAC address.
+type Oui [3]byte
+
+func (o Oui) String() string {
+	return strings.ToUpper(hex.EncodeToString(o[:]))
+}
+
+// bundledOuis lists OUIs belonging to vendors commonly found on enterprise
+// networks, in the same format read by LoadOuis.
+const bundledOuis = `
+00000C	Cisco
+00059A	Cisco
+000DEC	Cisco
+001BD4	Cisco
+002155	Cisco
+00500F	Cisco
+001C73	Arista
+000585	Juniper
+002688	Juniper
+001B21	Intel
+001E67	Intel
+003048	Super Micro
+002590	Super Micro
+0004F2	Polycom
+00408C	Axis
+000393	Apple
+000569	VMware
+000C29	VMware
+005056	VMware
+00155D	Microsoft (Hyper-V)
+00163E	Xen
+525400	QEMU/KVM
+080027	VirtualBox
+B827EB	Raspberry Pi
+DCA632	Raspberry Pi
+`
+
+// LoadOuis reads OUIs and vendor names, one per line. Lines look either
+// like "00000C<whitespace>Cisco" or like the IEEE's oui.txt:
+// "00-00-0C   (hex)		Cisco Systems, Inc". Other lines are ignored.
+// The last line for each OUI wins.
+func LoadOuis(r io.Reader) (map[Oui]string, error) {
+	out := make(map[Oui]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		b, err := hex.DecodeString(strings.Replace(fields[0], "-", "", -1))
+		if err != nil || len(b) != 3 {
+			continue
+		}
+
+		// skip oui.txt's "(hex)" or "(base 16)"
+		vendor := fields[1:]
+		if strings.HasPrefix(vendor[0], "(") {
+			for len(vendor) > 0 && !strings.HasSuffix(vendor[0], ")") {
+				vendor = vendor[1:]
+			}
+			if len(vendor) > 0 {
+				vendor = vendor[1:]
+			}
+		}
+		if len(vendor) == 0 {
+			continue
+		}
+
+		var oui Oui
+		copy(oui[:], b)
+		out[oui] = strings.Join(vendor, " ")
+	}
+	return out, scanner.Err()
+}
+
+// BundledOuis returns the built-in OUI list.
+func BundledOuis() map[Oui]string {
+	ouis, err := LoadOuis(strings.NewReader(bundledOuis))
+	if err != nil {
+		panic(err)
+	}
+	return ouis
+}
@@ -0,0 +1,252 @@
+package candidates
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Virtual router protocols.
+const (
+	HsrpV1 = "hsrpv1"
+	HsrpV2 = "hsrpv2"
+	Vrrp   = "vrrp"
+	Glbp   = "glbp"
+)
+
+// glbpForwarders is the number of forwarders (and so virtual MACs) in a
+// GLBP group.
+const glbpForwarders = 4
+
+var (
+	// maxGroup is the highest group number for each protocol.
+	maxGroup = map[string]int{
+		HsrpV1: 255,
+		HsrpV2: 4095,
+		Vrrp:   255,
+		Glbp:   1023,
+	}
+
+	// minGroup is the lowest group number for each protocol.
+	minGroup = map[string]int{
+		HsrpV1: 0,
+		HsrpV2: 0,
+		Vrrp:   1,
+		Glbp:   0,
+	}
+)
+
+// Protocols returns the names of the virtual router protocols.
+func Protocols() []string {
+	return []string{HsrpV1, HsrpV2, Vrrp, Glbp}
+}
+
+// VirtualRouterMacs returns the virtual MAC addresses used by a group of a
+// virtual router protocol. GLBP groups have one per forwarder. All others
+// have just one.
+func VirtualRouterMacs(protocol string, group int) ([]net.HardwareAddr, error) {
+	max, ok := maxGroup[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unknown virtual router protocol `%s'", protocol)
+	}
+	if group < minGroup[protocol] || group > max {
+		return nil, fmt.Errorf("%s group %d out of range %d-%d", protocol, group, minGroup[protocol], max)
+	}
+
+	switch protocol {
+	case HsrpV1:
+		return []net.HardwareAddr{{0x00, 0x00, 0x0c, 0x07, 0xac, byte(group)}}, nil
+	case HsrpV2:
+		return []net.HardwareAddr{{0x00, 0x00, 0x0c, 0x9f, 0xf0 | byte(group>>8), byte(group)}}, nil
+	case Vrrp:
+		return []net.HardwareAddr{{0x00, 0x00, 0x5e, 0x00, 0x01, byte(group)}}, nil
+	}
+
+	var out []net.HardwareAddr
+	for f := 1; f <= glbpForwarders; f++ {
+		out = append(out, net.HardwareAddr{0x00, 0x07, 0xb4, byte(group >> 8), byte(group), byte(f)})
+	}
+	return out, nil
+}
+
+// ParseVirtualRouterMac identifies a virtual router MAC address, returning
+// the protocol and group number. The boolean is false when the MAC doesn't
+// belong to any of the protocols.
+func ParseVirtualRouterMac(mac net.HardwareAddr) (string, int, bool) {
+	if len(mac) != 6 {
+		return "", 0, false
+	}
+	switch {
+	case bytes.Equal(mac[:5], []byte{0x00, 0x00, 0x0c, 0x07, 0xac}):
+		return HsrpV1, int(mac[5]), true
+	case bytes.Equal(mac[:4], []byte{0x00, 0x00, 0x0c, 0x9f}) && mac[4]&0xf0 == 0xf0:
+		return HsrpV2, int(mac[4]&0x0f)<<8 | int(mac[5]), true
+	case bytes.Equal(mac[:5], []byte{0x00, 0x00, 0x5e, 0x00, 0x01}) && mac[5] != 0:
+		return Vrrp, int(mac[5]), true
+	case bytes.Equal(mac[:3], []byte{0x00, 0x07, 0xb4}) && mac[3] < 4 && mac[5] >= 1 && mac[5] <= glbpForwarders:
+		return Glbp, int(mac[3])<<8 | int(mac[4]), true
+	}
+	return "", 0, false
+}
+
+// VirtualRouterSource generates router virtual MACs. Every group of each
+// protocol is generated unless Groups is set.
+type VirtualRouterSource struct {
+	Protocols []string
+	Groups    []int
+}
+
+func (o VirtualRouterSource) Name() string {
+	return "virtual-router"
+}
+
+func (o VirtualRouterSource) Candidates(_ []int) ([]Candidate, error) {
+	var out []Candidate
+	for _, p := range o.Protocols {
+		groups := o.Groups
+		if groups == nil {
+			for g := minGroup[p]; g <= maxGroup[p]; g++ {
+				groups = append(groups, g)
+			}
+		}
+		for _, g := range groups {
+			if g < minGroup[p] || g > maxGroup[p] {
+				continue // group numbers may suit some protocols but not others
+			}
+			macs, err := VirtualRouterMacs(p, g)
+			if err != nil {
+				return nil, err
+			}
+			for _, mac := range macs {
+				out = append(out, Candidate{
+					Mac:    mac,
+					Source: fmt.Sprintf("%s group %d", p, g),
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// OuiSource generates MACs from vendor OUIs: Count addresses per OUI,
+// counting up from oui:00:00:01. Vendors are matched by case insensitive
+// substring against the OUI list. A nil Ouis uses the bundled list.
+type OuiSource struct {
+	Vendors []string
+	Count   int
+	Ouis    map[Oui]string
+}
+
+func (o OuiSource) Name() string {
+	return "oui"
+}
+
+func (o OuiSource) Candidates(_ []int) ([]Candidate, error) {
+	ouis := o.Ouis
+	if ouis == nil {
+		ouis = BundledOuis()
+	}
+
+	var matched []Oui
+	for oui, vendor := range ouis {
+		for _, v := range o.Vendors {
+			if strings.Contains(strings.ToLower(vendor), strings.ToLower(v)) {
+				matched = append(matched, oui)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no OUIs match vendors %s", strings.Join(o.Vendors, ", "))
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return bytes.Compare(matched[i][:], matched[j][:]) < 0
+	})
+
+	var out []Candidate
+	for _, oui := range matched {
+		for i := 1; i <= o.Count; i++ {
+			out = append(out, Candidate{
+				Mac:    net.HardwareAddr{oui[0], oui[1], oui[2], byte(i >> 16), byte(i >> 8), byte(i)},
+				Source: "oui " + ouis[oui],
+			})
+		}
+	}
+	return out, nil
+}
+
+// StpSource generates MACs from a switch's STP bridge address. Switches
+// which allocate a bridge MAC per VLAN use the base address plus the VLAN
+// number, so each VLAN gets its own candidate, along with the base address
+// itself.
+type StpSource struct {
+	Base net.HardwareAddr
+}
+
+func (o StpSource) Name() string {
+	return "stp"
+}
+
+func (o StpSource) Candidates(vlans []int) ([]Candidate, error) {
+	if len(o.Base) != 6 {
+		return nil, fmt.Errorf("STP base address `%s' isn't a 6 byte MAC", o.Base)
+	}
+
+	out := []Candidate{{Mac: o.Base, Source: "stp base"}}
+	for _, v := range vlans {
+		out = append(out, Candidate{
+			Mac:    addToMac(o.Base, v),
+			Vlan:   v,
+			Source: fmt.Sprintf("stp base+%d", v),
+		})
+	}
+	return out, nil
+}
+
+// addToMac returns mac + n, treating the low three bytes as a counter so
+// that the OUI doesn't change.
+func addToMac(mac net.HardwareAddr, n int) net.HardwareAddr {
+	low := int(mac[3])<<16 | int(mac[4])<<8 | int(mac[5])
+	low = (low + n) & 0xffffff
+	return net.HardwareAddr{mac[0], mac[1], mac[2], byte(low >> 16), byte(low >> 8), byte(low)}
+}
+
+// ArpSource reads MACs from a saved ARP or neighbor cache. Any format with
+// one entry per line works: Linux /proc/net/arp, "ip neigh", "arp -an",
+// or Cisco "show ip arp". Each field which parses as a MAC address is
+// used, apart from all-zeros and broadcast.
+type ArpSource struct {
+	Filename string
+}
+
+func (o ArpSource) Name() string {
+	return "arp"
+}
+
+func (o ArpSource) Candidates(_ []int) ([]Candidate, error) {
+	f, err := os.Open(o.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Candidate
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			mac, err := net.ParseMAC(field)
+			if err != nil || len(mac) != 6 {
+				continue
+			}
+			if bytes.Equal(mac, make([]byte, 6)) || bytes.Equal(mac, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) {
+				continue
+			}
+			out = append(out, Candidate{Mac: mac, Source: "arp " + o.Filename})
+		}
+	}
+	return out, scanner.Err()
+}
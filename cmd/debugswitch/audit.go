@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/foozler"
+	"github.com/chrismarget/cisco-l2t/target"
+)
+
+const (
+	// remediationSettleTime gives the switch a moment to close the
+	// listener before we check from the outside.
+	remediationSettleTime = 2 * time.Second
+)
+
+// auditState is a snapshot of a switch's L2T service, as seen from both
+// the CLI and the network.
+type auditState struct {
+	config    foozler.L2TConfig
+	configErr error
+	answers   bool
+	refused   bool // ICMP port unreachable from every address
+	probeInfo string
+	probeErr  error
+}
+
+// auditReport collects the before/after state of a single switch.
+type auditReport struct {
+	address    string
+	connected  bool
+	before     auditState
+	after      *auditState
+	remediated bool
+	err        error
+}
+
+// exposed returns a boolean indicating whether the switch was still
+// answering L2T queries when we finished with it.
+func (o auditReport) exposed() bool {
+	if o.after != nil {
+		return o.after.answers
+	}
+	return o.before.answers
+}
+
+// refusedInfo is returned by probe() when the switch answers with ICMP
+// port unreachable, which is what a remediated switch usually does.
+const refusedInfo = "service disabled"
+
+// probe checks from the outside whether the switch answers a
+// message.TestMsg() on any address we can learn about.
+func probe(address string, bind communicate.Bind) (bool, string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		addrs, err := net.LookupIP(address)
+		if err != nil {
+			return false, "", err
+		}
+		if len(addrs) == 0 {
+			return false, "", fmt.Errorf("no addresses found for %s", address)
+		}
+		ip = addrs[0]
+	}
+
+	t, err := target.TargetBuilder().
+		SetBind(bind).
+		AddIp(ip).
+		Build()
+	if errors.Is(err, target.ErrServiceDisabled) {
+		return false, refusedInfo, nil
+	}
+	var ute target.UnreachableTargetError
+	if errors.As(err, &ute) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	return true, t.String(), nil
+}
+
+// inspect collects the current auditState from the switch.
+func inspect(auditor *foozler.Auditor, address string, bind communicate.Bind) auditState {
+	var s auditState
+	s.config, s.configErr = auditor.L2TConfig()
+	s.answers, s.probeInfo, s.probeErr = probe(address, bind)
+	s.refused = s.probeInfo == refusedInfo
+	return s
+}
+
+// auditSwitch logs into the switch, inspects it and, if requested and
+// necessary, applies the advisory remediation and inspects it again.
+func auditSwitch(address string, port int, clientConfig *ssh.ClientConfig, bind communicate.Bind, remediate bool, save bool) auditReport {
+	report := auditReport{address: address}
+
+	auditor, err := foozler.AuditorFor(address, port, clientConfig)
+	if err != nil {
+		report.err = err
+		return report
+	}
+	defer auditor.Close()
+	report.connected = true
+
+	report.before = inspect(auditor, address, bind)
+
+	if !remediate || (report.before.config.Off() && !report.before.answers) {
+		return report
+	}
+
+	err = auditor.DisableL2T(save)
+	if err != nil {
+		report.err = err
+		return report
+	}
+	report.remediated = true
+
+	time.Sleep(remediationSettleTime)
+	after := inspect(auditor, address, bind)
+	report.after = &after
+
+	return report
+}
+
+func (o auditState) write(w io.Writer, label string) {
+	var config string
+	switch {
+	case o.configErr != nil:
+		config = "error: " + o.configErr.Error()
+	case o.config.Off():
+		config = "disabled (" + foozler.L2TDisableCommand + ")"
+	case o.config.Disabled:
+		config = "enabled despite " + foozler.L2TDisableCommand
+	default:
+		config = "enabled"
+	}
+	if o.configErr == nil && o.config.L2TraceState != foozler.L2TraceUnsupported {
+		config += ", show l2trace: " + o.config.L2TraceState.String()
+	}
+
+	var network string
+	switch {
+	case o.probeErr != nil:
+		network = "error: " + o.probeErr.Error()
+	case o.answers:
+		network = "answering"
+	case o.refused:
+		network = "refused (port unreachable)"
+	default:
+		network = "silent"
+	}
+
+	_, _ = fmt.Fprintf(w, "  %-7s config: %-30s network: %s\n", label, config, network)
+	if o.answers && o.probeInfo != "" {
+		_, _ = fmt.Fprintf(w, "    %s\n", strings.Replace(o.probeInfo, "\n", "\n    ", -1))
+	}
+}
+
+func (o auditReport) write(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "%s:\n", o.address)
+	if !o.connected {
+		_, _ = fmt.Fprintf(w, "  error: %s\n", o.err.Error())
+		return
+	}
+
+	o.before.write(w, "before:")
+	if o.after != nil {
+		o.after.write(w, "after:")
+	}
+
+	var result string
+	switch {
+	case o.err != nil:
+		result = "error: " + o.err.Error()
+	case o.exposed():
+		result = "EXPOSED"
+	case o.remediated:
+		result = "remediated"
+	default:
+		result = "ok"
+	}
+	_, _ = fmt.Fprintf(w, "  result: %s\n", result)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/stephen-fox/userutil"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	envUsername   = "DEBUGSWITCH_USERNAME"
+	envPassword   = "DEBUGSWITCH_PASSWORD"
+	envKeyFile    = "DEBUGSWITCH_KEY_FILE"
+	envPassphrase = "DEBUGSWITCH_KEY_PASSPHRASE"
+
+	credUsername   = "username"
+	credPassword   = "password"
+	credKeyFile    = "key_file"
+	credPassphrase = "key_passphrase"
+)
+
+// credentials holds everything we might use to authenticate to the switch.
+// Empty values are filled in by (in order of preference) command line flags,
+// environment variables, a credentials file and, unless running in batch
+// mode, interactive prompts.
+type credentials struct {
+	username   string
+	password   string
+	keyFile    string
+	passphrase string
+	useAgent   bool
+	batch      bool
+}
+
+// mergeFrom fills any empty fields in o with values from the supplied map.
+func (o *credentials) mergeFrom(in map[string]string) {
+	if o.username == "" {
+		o.username = in[credUsername]
+	}
+	if o.password == "" {
+		o.password = in[credPassword]
+	}
+	if o.keyFile == "" {
+		o.keyFile = in[credKeyFile]
+	}
+	if o.passphrase == "" {
+		o.passphrase = in[credPassphrase]
+	}
+}
+
+// credentialsFromEnv returns credential values found in the environment.
+func credentialsFromEnv() map[string]string {
+	return map[string]string{
+		credUsername:   os.Getenv(envUsername),
+		credPassword:   os.Getenv(envPassword),
+		credKeyFile:    os.Getenv(envKeyFile),
+		credPassphrase: os.Getenv(envPassphrase),
+	}
+}
+
+// credentialsFromFile reads a file of "name = value" lines. Blank lines
+// and lines beginning with '#' are ignored. Recognized names are
+// username, password, key_file and key_passphrase.
+func credentialsFromFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s line %d: expected 'name = value'", path, lineNum)
+		}
+
+		name := strings.TrimSpace(kv[0])
+		switch name {
+		case credUsername, credPassword, credKeyFile, credPassphrase:
+			out[name] = strings.TrimSpace(kv[1])
+		default:
+			return nil, fmt.Errorf("%s line %d: unknown credential `%s'", path, lineNum, name)
+		}
+	}
+
+	return out, scanner.Err()
+}
+
+// resolveUsername makes sure we have a username, prompting for one (with
+// visible input) if necessary, and falling back to the local user name.
+func (o *credentials) resolveUsername() error {
+	if o.username == "" && !o.batch {
+		var err error
+		o.username, err = userutil.GetUserInput("Username", userutil.PromptOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return err
+		}
+		o.username = u.Username
+	}
+
+	return nil
+}
+
+// getPassword returns the configured password, or prompts for one.
+func (o *credentials) getPassword() (string, error) {
+	if o.password != "" {
+		return o.password, nil
+	}
+
+	if o.batch {
+		return "", fmt.Errorf("no password available in batch mode")
+	}
+
+	password, err := userutil.GetUserInput("Password", userutil.PromptOptions{
+		ShouldHideInput: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// remember it for keyboard-interactive, which may ask again
+	o.password = password
+	return password, nil
+}
+
+// keyFileSigner loads the private key file, decrypting it with the
+// configured (or prompted) passphrase if necessary.
+func (o *credentials) keyFileSigner() (ssh.Signer, error) {
+	pemBytes, err := ioutil.ReadFile(o.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(o.passphrase))
+	}
+
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	if err == nil || o.batch || !errors.As(err, new(*ssh.PassphraseMissingError)) {
+		return signer, err
+	}
+
+	passphrase, err := userutil.GetUserInput("Passphrase for "+o.keyFile, userutil.PromptOptions{
+		ShouldHideInput: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+}
+
+// authMethods returns the ssh.AuthMethods we're able to offer, in order of
+// preference: public key (key file and/or agent), password, then
+// keyboard-interactive. The returned cleanup function closes the agent
+// connection, if any.
+func (o *credentials) authMethods() ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	var signers []ssh.Signer
+	cleanup := func() {}
+
+	if o.keyFile != "" {
+		signer, err := o.keyFileSigner()
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("cannot load key file %s - %s", o.keyFile, err.Error())
+		}
+		signers = append(signers, signer)
+	}
+
+	var agentClient agent.Agent
+	if o.useAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, cleanup, fmt.Errorf("ssh-agent requested, but SSH_AUTH_SOCK is not set")
+		}
+		cxn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("cannot connect to ssh-agent - %s", err.Error())
+		}
+		cleanup = func() { _ = cxn.Close() }
+		agentClient = agent.NewClient(cxn)
+	}
+
+	if len(signers) > 0 || agentClient != nil {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if agentClient == nil {
+				return signers, nil
+			}
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				return nil, err
+			}
+			return append(signers, agentSigners...), nil
+		}))
+	}
+
+	// Only offer password based methods if we have a password or are
+	// allowed to ask for one.
+	if o.password != "" || !o.batch {
+		methods = append(methods,
+			ssh.PasswordCallback(o.getPassword),
+			ssh.KeyboardInteractive(o.keyboardInteractive),
+		)
+	}
+
+	if len(methods) == 0 {
+		return nil, cleanup, fmt.Errorf("no usable authentication methods")
+	}
+
+	return methods, cleanup, nil
+}
+
+// keyboardInteractive answers keyboard-interactive challenges. Hidden
+// (non-echoed) questions are assumed to want the password. Anything else
+// is put to the user, if we're allowed to ask.
+func (o *credentials) keyboardInteractive(_, instruction string, questions []string, echos []bool) ([]string, error) {
+	if instruction != "" && !o.batch {
+		fmt.Println(instruction)
+	}
+
+	answers := make([]string, len(questions))
+	for i, q := range questions {
+		if !echos[i] {
+			password, err := o.getPassword()
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = password
+			continue
+		}
+
+		if o.batch {
+			return nil, fmt.Errorf("cannot answer keyboard-interactive question `%s' in batch mode", q)
+		}
+
+		answer, err := userutil.GetUserInput(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(q), ":")),
+			userutil.PromptOptions{})
+		if err != nil {
+			return nil, err
+		}
+		answers[i] = answer
+	}
+
+	return answers, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/stephen-fox/sshutil"
+	"github.com/stephen-fox/userutil"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	hostKeyModePrompt    = "prompt"
+	hostKeyModeStrict    = "strict"
+	hostKeyModeAcceptNew = "accept-new"
+)
+
+// defaultKnownHostsFile returns the path of the user's known_hosts file.
+func defaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// hostKeyCallback returns an ssh.HostKeyCallback for the requested mode:
+//
+//	prompt:     ask the user about unknown keys (the historic behavior)
+//	strict:     only accept hosts with a matching key in the known_hosts file
+//	accept-new: like strict, but unknown hosts are trusted and added to the
+//	            known_hosts file. Changed keys are still rejected.
+func hostKeyCallback(mode string, knownHostsFile string, batch bool) (ssh.HostKeyCallback, error) {
+	if mode == hostKeyModePrompt {
+		if batch {
+			return nil, fmt.Errorf("host key mode %s cannot be used in batch mode", hostKeyModePrompt)
+		}
+		return sshutil.ImitateSSHClientHostKeyCallBack(func(i sshutil.SSHHostKeyPromptInfo) bool {
+			b, _ := userutil.GetYesOrNoUserInput(i.UserFacingPrompt, userutil.PromptOptions{})
+			return b
+		}), nil
+	}
+
+	if knownHostsFile == "" {
+		return nil, fmt.Errorf("host key mode %s requires a known_hosts file", mode)
+	}
+
+	switch mode {
+	case hostKeyModeStrict:
+		return knownhosts.New(knownHostsFile)
+	case hostKeyModeAcceptNew:
+		// make sure the file exists so that knownhosts.New() can read it.
+		err := os.MkdirAll(filepath.Dir(knownHostsFile), 0700)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(knownHostsFile, os.O_CREATE|os.O_RDONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_ = f.Close()
+
+		known, err := knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+		return acceptNewHostKey(known, knownHostsFile), nil
+	}
+
+	return nil, fmt.Errorf("unknown host key mode `%s'", mode)
+}
+
+// acceptNewHostKey wraps a knownhosts callback so that keys for hosts
+// which don't appear in the file at all get recorded rather than rejected.
+func acceptNewHostKey(known ssh.HostKeyCallback, knownHostsFile string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := known(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok || len(keyErr.Want) > 0 {
+			// nil (known key), some other problem, or a changed key.
+			return err
+		}
+
+		f, err := os.OpenFile(knownHostsFile, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		addresses := []string{hostname}
+		if remote != nil && remote.String() != hostname {
+			addresses = append(addresses, remote.String())
+		}
+		_, err = fmt.Fprintln(f, knownhosts.Line(addresses, key))
+		return err
+	}
+}
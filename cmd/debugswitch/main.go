@@ -5,54 +5,111 @@ import (
 	"fmt"
 	"golang.org/x/crypto/ssh"
 	"log"
-	"os/user"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
 
+	"github.com/chrismarget/cisco-l2t/communicate"
 	"github.com/chrismarget/cisco-l2t/foozler"
-	"github.com/stephen-fox/sshutil"
-	"github.com/stephen-fox/userutil"
 )
 
 func main() {
-	address := flag.String("a", "", "The address")
+	address := flag.String("a", "", "The address (comma separated list allowed)")
+	port := flag.Int("port", 22, "The SSH port")
+	username := flag.String("u", "", "The username (env "+envUsername+")")
+	keyFile := flag.String("i", "", "Private key file (env "+envKeyFile+")")
+	useAgent := flag.Bool("agent", false, "Authenticate using ssh-agent (SSH_AUTH_SOCK)")
+	credFile := flag.String("credentials", "", "File containing 'name = value' credential lines")
+	knownHosts := flag.String("known-hosts", defaultKnownHostsFile(), "The known_hosts file")
+	hostKeyMode := flag.String("host-key-mode", hostKeyModePrompt,
+		"Host key checking: "+hostKeyModePrompt+", "+hostKeyModeStrict+" or "+hostKeyModeAcceptNew)
+	legacyCiphers := flag.Bool("legacy-ciphers", false, "Also offer the aes128-cbc cipher for old switches")
+	batch := flag.Bool("batch", false, "Never prompt for input")
+	audit := flag.Bool("audit", false, "Report L2T service state instead of printing debug output")
+	remediate := flag.Bool("remediate", false, "Disable the L2T service where it's running (implies -audit)")
+	save := flag.Bool("save", false, "Write memory after remediating")
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
 	flag.Parse()
 
-	username, err := userutil.GetUserInput("Username", userutil.PromptOptions{
-		ShouldHideInput: true,
-	})
-	if err != nil {
-		log.Fatalln(err.Error())
+	creds := &credentials{
+		username: *username,
+		keyFile:  *keyFile,
+		useAgent: *useAgent,
+		batch:    *batch,
 	}
-	if len(username) == 0 {
-		u, err := user.Current()
+	creds.mergeFrom(credentialsFromEnv())
+	if *credFile != "" {
+		fromFile, err := credentialsFromFile(*credFile)
 		if err != nil {
 			log.Fatalln(err.Error())
 		}
+		creds.mergeFrom(fromFile)
+	}
 
-		username = u.Username
+	err := creds.resolveUsername()
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
 
-	password, err := userutil.GetUserInput("Password", userutil.PromptOptions{
-		ShouldHideInput: true,
-	})
+	authMethods, closeAgent, err := creds.authMethods()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	defer closeAgent()
 
-	onHostKey := func(i sshutil.SSHHostKeyPromptInfo) bool {
-		b, _ := userutil.GetYesOrNoUserInput(i.UserFacingPrompt, userutil.PromptOptions{})
-		return b
+	onHostKey, err := hostKeyCallback(*hostKeyMode, *knownHosts, *batch)
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
 
 	clientConfig := &ssh.ClientConfig{
-		User: username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-		},
-		HostKeyCallback: sshutil.ImitateSSHClientHostKeyCallBack(onHostKey),
+		User:            creds.username,
+		Auth:            authMethods,
+		HostKeyCallback: onHostKey,
 		Timeout:         10 * time.Second,
 	}
 
-	clientConfig.Ciphers = append(clientConfig.Ciphers, "aes128-cbc")
+	if *legacyCiphers {
+		// Appending to an empty cipher list would leave us with *only* the
+		// legacy cipher, so start from the defaults.
+		clientConfig.SetDefaults()
+		clientConfig.Ciphers = append(clientConfig.Ciphers, "aes128-cbc")
+	}
+
+	var addresses []string
+	for _, a := range append(strings.Split(*address, ","), flag.Args()...) {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
 
-	d, err := foozler.ConnectTo(*address, 22, clientConfig)
+	if *audit || *remediate {
+		exposed := false
+		for _, a := range addresses {
+			report := auditSwitch(a, *port, clientConfig, bind, *remediate, *save)
+			report.write(os.Stdout)
+			if report.err != nil || report.exposed() {
+				exposed = true
+			}
+		}
+		if exposed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch len(addresses) {
+	case 0:
+		log.Fatalln("no switch address specified")
+	case 1:
+	default:
+		debugMany(addresses, *port, clientConfig)
+		return
+	}
+
+	d, err := foozler.ConnectTo(addresses[0], *port, clientConfig)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
@@ -73,3 +130,44 @@ func main() {
 		}
 	}
 }
+
+// debugMany prints debug output from several switches at once, each line
+// prefixed by the name of the switch that produced it.
+func debugMany(addresses []string, port int, clientConfig *ssh.ClientConfig) {
+	g := foozler.ConnectToAll(addresses, port, clientConfig)
+	g.Enable()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		log.Println("closing sessions")
+		g.Close()
+	}()
+
+	width := 0
+	for _, a := range addresses {
+		if len(a) > width {
+			width = len(a)
+		}
+	}
+
+	errs := g.Errors()
+	out := g.Output()
+	for errs != nil || out != nil {
+		select {
+		case e, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Println(e.Error())
+		case o, ok := <-out:
+			if !ok {
+				out = nil
+				continue
+			}
+			fmt.Printf("%-*s %s\n", width, o.Switch, o.Line)
+		}
+	}
+}
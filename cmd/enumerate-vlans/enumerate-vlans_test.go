@@ -1,9 +1,43 @@
 package main
 
-import "testing"
+import (
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestPrintResults(t *testing.T) {
 	testData := []int{1,2,3,4}
 	printResults(testData)
 
 }
+
+func TestGetTargetWrongAddress(t *testing.T) {
+	tgt, err := target.TestTargetBuilder().AddIp(net.ParseIP("192.0.2.1")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileFile := filepath.Join(t.TempDir(), "profile.json")
+	f, err := os.Create(profileFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = target.SaveProfile(tgt, f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = getTarget("192.0.2.99", profileFile, communicate.Bind{})
+	if err == nil {
+		t.Fatal("address not in the profile should produce an error")
+	}
+
+	_, err = getTarget("", filepath.Join(t.TempDir(), "missing.json"), communicate.Bind{})
+	if err == nil {
+		t.Fatal("missing profile without an address should produce an error")
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"github.com/cheggaaa/pb/v3"
-	"github.com/chrismarget/cisco-l2t/attribute"
-	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/communicate"
 	"github.com/chrismarget/cisco-l2t/target"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -18,56 +18,9 @@ const (
 	vlanMax = 4094
 )
 
-func queryTemplate(t target.Target) (message.Msg, error) {
-	srcIpAttr, err := attribute.NewAttrBuilder().
-		SetType(attribute.SrcIPv4Type).
-		SetString(t.GetLocalIp().String()).
-		Build()
-	if err != nil {
-		return nil, err
-	}
-
-	msg, err := message.TestMsg()
-	if err != nil {
-		return nil, err
-	}
-
-	msg.SetAttr(srcIpAttr)
-	return msg, nil
-}
-
-func buildQueries(t target.Target) ([]message.Msg, error) {
-	var queries []message.Msg
-	for v := vlanMin; v <= vlanMax; v++ {
-		template, err := queryTemplate(t)
-		if err != nil {
-			return nil, err
-		}
-
-		vlanAttr, err := attribute.NewAttrBuilder().
-			SetType(attribute.VlanType).
-			SetInt(uint32(v)).
-			Build()
-		if err != nil {
-			return nil, err
-		}
-
-		template.SetAttr(vlanAttr)
-		queries = append(queries, template)
-	}
-	return queries, nil
-}
-
-func enumerate_vlans(t target.Target) ([]int, []error, error) {
-	queries, err := buildQueries(t)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	var found []int
-	var errors []error
+func enumerate_vlans(t target.Target) ([]int, []error) {
 	// progress bar and bar channel
-	bar := pb.StartNew(len(queries))
+	bar := pb.StartNew(vlanMax - vlanMin + 1)
 	pChan := make(chan struct{})
 	go func() {
 		for _ = range pChan {
@@ -76,35 +29,10 @@ func enumerate_vlans(t target.Target) ([]int, []error, error) {
 	}()
 
 	// go do work
-	result := t.SendBulkUnsafe(queries, pChan)
+	found, errors := target.Vlans(t, pChan)
 	bar.Finish()
 
-	// how'd we do?
-	for _, r := range result {
-		if r.Err != nil {
-			// Error? This message goes on the doOver slice
-			errors = append(errors, err)
-			continue
-		}
-		err := r.Msg.Validate()
-		if err != nil {
-			// Message validation error? This message goes on the doOver slice
-			errors = append(errors, err)
-			continue
-		}
-		replyStatus := r.Msg.GetAttr(attribute.ReplyStatusType)
-		if replyStatus == nil {
-			// No reply status attribute? This message goes on the doOver slice
-			errors = append(errors, fmt.Errorf("no reply status: %s", r.Msg.String()))
-			continue
-		}
-		// So far so good. Check to see whether the replyStatus indicates the vlan exists
-		if replyStatus.String() == attribute.ReplyStatusSrcNotFound {
-			found = append(found, r.Index+vlanMin)
-		}
-	}
-
-	return found, errors, nil
+	return found, errors
 }
 
 func printResults(found []int) {
@@ -157,28 +85,109 @@ func printResults(found []int) {
 
 }
 
+// getTarget loads the target from the profile file, if one exists.
+// Otherwise it builds the target from scratch. Either way, if a profile
+// file was named, the result is saved there: loading may have meant
+// rediscovering the target. A non-zero bind overrides the one in the
+// profile.
+func getTarget(address string, profileFile string, bind communicate.Bind) (target.Target, error) {
+	var ip net.IP
+	if address != "" {
+		ip = net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("cannot parse target switch address `%s'", address)
+		}
+	}
+
+	var t target.Target
+	if profileFile != "" {
+		f, err := os.Open(profileFile)
+		switch {
+		case err == nil:
+			t, err = profileTarget(f, ip, bind)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+
+	if t == nil {
+		if ip == nil {
+			return nil, fmt.Errorf("profile %s doesn't exist, you need to specify a target switch", profileFile)
+		}
+		var err error
+		t, err = target.TargetBuilder().
+			SetBind(bind).
+			AddIp(ip).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if profileFile != "" {
+		f, err := os.Create(profileFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		err = target.SaveProfile(t, f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// profileTarget loads a target profile and revalidates it. The address,
+// if there is one, has to be one of the target's.
+func profileTarget(r io.Reader, ip net.IP, bind communicate.Bind) (target.Target, error) {
+	p, err := target.LoadProfile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip != nil {
+		var known bool
+		for _, a := range p.Addresses {
+			if a.Destination.Equal(ip) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("%s isn't one of the addresses in the target profile", ip)
+		}
+	}
+
+	if !bind.IsZero() {
+		p.Bind = &bind
+	}
+	return p.Target(true)
+}
+
 func main() {
+	profileFile := flag.String("profile", "", "target profile file (loaded if present, then saved)")
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
 	flag.Parse()
-	if flag.NArg() != 1 {
+	if flag.NArg() > 1 || (flag.NArg() != 1 && *profileFile == "") {
 		log.Println("You need to specify a target switch")
 		os.Exit(1)
 	}
 
-	t, err := target.TargetBuilder().
-		AddIp(net.ParseIP(flag.Arg(0))).
-		Build()
+	t, err := getTarget(flag.Arg(0), *profileFile, bind)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(2)
 	}
 	fmt.Print(t.String(), "\n")
 
-	found, msgerrs, err := enumerate_vlans(t)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(3)
-	}
-
+	found, msgerrs := enumerate_vlans(t)
 	printResults(found)
 	if len(msgerrs) != 0 {
 		log.Println("message errors encountered:")
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/fingerprint"
+	"github.com/chrismarget/cisco-l2t/target"
+	"log"
+	"net"
+	"os"
+)
+
+// database returns the bundled signature database, plus any entries
+// found in the named file. An empty database is an error unless we're
+// only collecting a signature: there'd be nothing to guess with.
+func database(filename string, collecting bool) (fingerprint.Database, error) {
+	db, err := fingerprint.Bundled()
+	if err != nil {
+		return nil, err
+	}
+
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		extra, err := fingerprint.LoadDatabase(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		db = append(extra, db...)
+	}
+
+	if len(db) == 0 && !collecting {
+		return nil, fmt.Errorf("%w: supply signatures with -db, or collect one with -signature", fingerprint.ErrEmptyDatabase)
+	}
+	return db, nil
+}
+
+func printResult(r fingerprint.Result, verbose bool) {
+	platform := r.Platform
+	if platform == "" {
+		platform = "<unknown>"
+	}
+	fmt.Printf("Platform (DEV_TYPE): %s\n", platform)
+
+	m, ok := r.Guess()
+	switch {
+	case ok:
+		fmt.Printf("Best guess:          %s, %s (%.0f%% of %d features)\n",
+			m.Family, m.Firmware, m.Score*100, m.Compared)
+	case len(r.Matches) > 0:
+		fmt.Printf("Best guess:          <none> (closest: %s, %s at %.0f%%)\n",
+			m.Family, m.Firmware, m.Score*100)
+	default:
+		fmt.Println("Best guess:          <none>")
+	}
+
+	if verbose {
+		fmt.Printf("\nSignature:\n%s", r.Signature.String())
+		fmt.Println("\nMatches:")
+		for _, m := range r.Matches {
+			fmt.Printf("  %3.0f%%  %s, %s\n", m.Score*100, m.Family, m.Firmware)
+		}
+	}
+}
+
+func main() {
+	dbFile := flag.String("db", "", "additional signature database (JSON)")
+	signature := flag.Bool("signature", false, "print a database entry for this switch, for adding to the database")
+	asJson := flag.Bool("json", false, "print the result in JSON format")
+	verbose := flag.Bool("v", false, "print the signature and all matches")
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Println("You need to specify a target switch")
+		os.Exit(1)
+	}
+
+	db, err := database(*dbFile, *signature)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	ip := net.ParseIP(flag.Arg(0))
+	if ip == nil {
+		log.Printf("cannot parse target switch address `%s'", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	t, err := target.TargetBuilder().SetBind(bind).AddIp(ip).Build()
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	r, err := fingerprint.Fingerprint(t, db)
+	if err != nil {
+		log.Println(err)
+		os.Exit(3)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	switch {
+	case *signature:
+		err = enc.Encode(fingerprint.Entry{
+			Family:    r.Platform,
+			Firmware:  "",
+			Signature: r.Signature,
+		})
+	case *asJson:
+		err = enc.Encode(r)
+	default:
+		printResult(r, *verbose)
+	}
+	if err != nil {
+		log.Println(err)
+		os.Exit(3)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/inventory"
+	"github.com/chrismarget/cisco-l2t/target"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultInterval    = 15 * time.Minute
+	defaultConcurrency = 4
+	webhookTimeout     = 10 * time.Second
+)
+
+// config is read from a JSON or YAML file.
+type config struct {
+	Interval    string             `yaml:"interval"`
+	Store       string             `yaml:"store"`
+	Webhook     string             `yaml:"webhook"`
+	Concurrency int                `yaml:"concurrency"`
+	Switches    []inventory.Switch `yaml:"switches"`
+}
+
+func readConfig(filename string) (config, time.Duration, error) {
+	var c config
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return c, 0, err
+	}
+	err = yaml.UnmarshalStrict(b, &c)
+	if err != nil {
+		return c, 0, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if len(c.Switches) == 0 {
+		return c, 0, fmt.Errorf("%s: no switches configured", filename)
+	}
+	if c.Store == "" {
+		return c, 0, fmt.Errorf("%s: no store directory configured", filename)
+	}
+	if c.Concurrency < 1 {
+		c.Concurrency = defaultConcurrency
+	}
+
+	interval := defaultInterval
+	if c.Interval != "" {
+		interval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return c, 0, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return c, interval, nil
+}
+
+// notifier delivers Changes to stdout and, if configured, a webhook.
+type notifier struct {
+	out     io.Writer
+	webhook string
+	client  *http.Client
+}
+
+func (o notifier) notify(changes []inventory.Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	for _, c := range changes {
+		fmt.Fprintf(o.out, "%s %s\n", c.Time.Format(time.RFC3339), c.String())
+	}
+
+	if o.webhook == "" {
+		return
+	}
+	b, err := json.Marshal(changes)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	resp, err := o.client.Post(o.webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Printf("webhook: %s", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("webhook: %s", resp.Status)
+	}
+}
+
+// pass takes a snapshot of each switch, compares it to the previous
+// snapshots and records the results.
+func pass(c config, newBuilder func() target.Builder, store *inventory.Store, n notifier) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	slots := make(chan struct{}, c.Concurrency)
+	for _, sw := range c.Switches {
+		wg.Add(1)
+		go func(sw inventory.Switch) {
+			defer wg.Done()
+			slots <- struct{}{}
+			s := inventory.Collect(sw, newBuilder)
+			<-slots
+
+			// serialize store access and output
+			lock.Lock()
+			defer lock.Unlock()
+			for _, e := range s.Errors {
+				log.Printf("%s: %s", sw.Address, e)
+			}
+
+			previous, ok, err := store.Latest(sw.Address)
+			if err != nil {
+				log.Printf("%s: %s", sw.Address, err)
+			}
+			baseline, _, err := store.Baseline(sw.Address)
+			if err != nil {
+				log.Printf("%s: %s", sw.Address, err)
+			}
+
+			// unanswered queries keep their answers from the baseline
+			s = inventory.Carry(baseline, s)
+			err = store.Save(s)
+			if err != nil {
+				log.Printf("%s: %s", sw.Address, err)
+			}
+
+			if !ok {
+				log.Printf("%s: baseline snapshot, %d vlans, %d neighbors", sw.Address, len(s.Vlans), len(s.Neighbors))
+				return
+			}
+
+			changes := inventory.Changes(previous, baseline, s)
+			err = store.RecordChanges(changes)
+			if err != nil {
+				log.Printf("%s: %s", sw.Address, err)
+			}
+			n.notify(changes)
+		}(sw)
+	}
+	wg.Wait()
+}
+
+func main() {
+	configFile := flag.String("config", "", "JSON or YAML configuration file")
+	once := flag.Bool("once", false, "take one set of snapshots, then exit")
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if *configFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	c, interval, err := readConfig(*configFile)
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	store, err := inventory.OpenStore(c.Store)
+	if err != nil {
+		log.Println(err)
+		os.Exit(3)
+	}
+
+	newBuilder := func() target.Builder {
+		return target.TargetBuilder().SetBind(bind)
+	}
+
+	n := notifier{
+		out:     os.Stdout,
+		webhook: c.Webhook,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+
+	pass(c, newBuilder, store, n)
+	if *once {
+		return
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			pass(c, newBuilder, store, n)
+		case <-sig:
+			return
+		}
+	}
+}
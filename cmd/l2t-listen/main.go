@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// jsonRecord is the JSON form of a communicate.Record.
+type jsonRecord struct {
+	From     string          `json:"from"`
+	Received time.Time       `json:"received"`
+	Msg      *message.MsgDoc `json:"msg,omitempty"`
+	Hex      string          `json:"hex,omitempty"`   // when Msg couldn't be decoded
+	Error    string          `json:"error,omitempty"` // why not
+}
+
+func printRecord(r communicate.Record) {
+	fmt.Printf("%s from %s: ", r.Received.Format(time.RFC3339Nano), r.From)
+	if r.Err != nil {
+		fmt.Printf("undecodable (%s): %s\n", r.Err, hex.EncodeToString(r.Data))
+		return
+	}
+	fmt.Println(r.Msg.String())
+	for _, a := range attribute.SortAttributes(r.Msg.Attributes()) {
+		fmt.Printf("  %2d %-20s %s\n", a.Type(), attribute.AttrTypeString[a.Type()], a.String())
+	}
+}
+
+func main() {
+	asJson := flag.Bool("json", false, "print one JSON object per datagram")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Println("You need to specify a local address to listen on, ip:port")
+		os.Exit(1)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", flag.Arg(0))
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	l, err := communicate.Listen(addr, func(r communicate.Record) {
+		if !*asJson {
+			printRecord(r)
+			return
+		}
+		jr := jsonRecord{From: r.From.String(), Received: r.Received}
+		if r.Err != nil {
+			jr.Hex = hex.EncodeToString(r.Data)
+			jr.Error = r.Err.Error()
+		} else {
+			doc := message.NewMsgDoc(r.Msg)
+			jr.Msg = &doc
+		}
+		err := enc.Encode(jr)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	log.Printf("listening on %s", l.Addr())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	l.Close()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cheggaaa/pb/v3"
+	"github.com/chrismarget/cisco-l2t/candidates"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/target"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseList parses comma separated numbers and ranges, e.g. "1,10-20".
+func parseList(in string) ([]int, error) {
+	var out []int
+	for _, item := range strings.Split(in, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(item), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `%s'", item)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("cannot parse `%s'", item)
+			}
+		}
+		for i := first; i <= last; i++ {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(in string) []string {
+	var out []string
+	for _, s := range strings.Split(in, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// getTarget builds the target, exiting on failure.
+func getTarget(address string, bind communicate.Bind) target.Target {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		log.Printf("cannot parse target switch address `%s'", address)
+		os.Exit(1)
+	}
+	t, err := target.TargetBuilder().SetBind(bind).AddIp(ip).Build()
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	fmt.Print(t.String(), "\n")
+	return t
+}
+
+func progressBar(total int) (*pb.ProgressBar, chan struct{}) {
+	bar := pb.StartNew(total)
+	pChan := make(chan struct{})
+	go func() {
+		for range pChan {
+			bar.Increment()
+		}
+	}()
+	return bar, pChan
+}
+
+func findGateways(t target.Target, vlans []int, vr candidates.VirtualRouterSource) {
+	if vlans == nil {
+		fmt.Println("Looking for VLANs...")
+		var errs []error
+		vlans, errs = target.Vlans(t, nil)
+		if len(errs) != 0 {
+			log.Printf("%d VLAN queries failed, first error: %s", len(errs), errs[0])
+		}
+		if vlans == nil {
+			vlans = []int{} // don't let FindGateways look again
+		}
+	}
+
+	if vr.Protocols == nil {
+		vr.Protocols = candidates.Protocols()
+	}
+	cands, err := vr.Candidates(vlans)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	bar, pChan := progressBar(len(cands) * len(vlans))
+	gws, errs := candidates.FindGateways(t, vlans, vr, pChan)
+	bar.Finish()
+
+	fmt.Printf("\n%d gateway groups found in %d VLANs:\n", len(gws), len(vlans))
+	for _, gw := range gws {
+		port := gw.Port
+		if port == "" {
+			port = "<unknown port>"
+		}
+		if gw.Neighbor != "" {
+			port += " (neighbor " + gw.Neighbor + ")"
+		}
+		fmt.Printf("  vlan %-4d  %-6s group %-4d  %s  %s\n", gw.Vlan, gw.Protocol, gw.Group, gw.Mac, port)
+	}
+
+	if len(errs) != 0 {
+		log.Printf("%d queries failed, first error: %s", len(errs), errs[0])
+		os.Exit(3)
+	}
+}
+
+func main() {
+	vlanList := flag.String("vlans", "", "VLANs to sweep, e.g. 1,10-20 (required)")
+	vendors := flag.String("vendors", "", "comma separated vendor names, matched against the OUI list")
+	ouiCount := flag.Int("oui-count", 16, "addresses to try per vendor OUI")
+	ouiFile := flag.String("oui-file", "", "OUI list to use instead of the bundled one (IEEE oui.txt format works)")
+	virtual := flag.String("virtual", "", "comma separated virtual router protocols: "+strings.Join(candidates.Protocols(), ", "))
+	groupList := flag.String("groups", "", "virtual router group numbers, e.g. 0-255 (default all)")
+	stpBase := flag.String("stp", "", "STP bridge base MAC address")
+	arpFile := flag.String("arp", "", "file containing an ARP or neighbor cache")
+	gateways := flag.Bool("gateways", false, "find router virtual MACs and the ports they're learned on (-vlans, -virtual and -groups optional)")
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Println("You need to specify a target switch")
+		os.Exit(1)
+	}
+
+	var vlans []int
+	var err error
+	if *vlanList != "" {
+		vlans, err = parseList(*vlanList)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	}
+	if vlans == nil && !*gateways {
+		log.Println("You need to specify VLANs with -vlans")
+		os.Exit(1)
+	}
+
+	if *gateways {
+		vr := candidates.VirtualRouterSource{Protocols: splitList(*virtual)}
+		if *groupList != "" {
+			vr.Groups, err = parseList(*groupList)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		findGateways(getTarget(flag.Arg(0), bind), vlans, vr)
+		return
+	}
+
+	var sources []candidates.Source
+	if *vendors != "" {
+		s := candidates.OuiSource{Vendors: splitList(*vendors), Count: *ouiCount}
+		if *ouiFile != "" {
+			f, err := os.Open(*ouiFile)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+			s.Ouis, err = candidates.LoadOuis(f)
+			f.Close()
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		sources = append(sources, s)
+	}
+	if *virtual != "" {
+		s := candidates.VirtualRouterSource{Protocols: splitList(*virtual)}
+		if *groupList != "" {
+			s.Groups, err = parseList(*groupList)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		sources = append(sources, s)
+	}
+	if *stpBase != "" {
+		mac, err := net.ParseMAC(*stpBase)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		sources = append(sources, candidates.StpSource{Base: mac})
+	}
+	if *arpFile != "" {
+		sources = append(sources, candidates.ArpSource{Filename: *arpFile})
+	}
+	if len(sources) == 0 {
+		log.Println("You need to specify at least one candidate source")
+		os.Exit(1)
+	}
+
+	cands, err := candidates.Generate(sources, vlans)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	t := getTarget(flag.Arg(0), bind)
+
+	var queries int
+	for _, c := range cands {
+		if c.Vlan != 0 {
+			queries++
+		} else {
+			queries += len(vlans)
+		}
+	}
+
+	bar, pChan := progressBar(queries)
+	found, errs := candidates.Sweep(t, cands, vlans, pChan)
+	bar.Finish()
+
+	fmt.Printf("\n%d of %d candidates found:\n", len(found), len(cands))
+	for _, c := range found {
+		fmt.Printf("  vlan %-4d  %s  %s\n", c.Vlan, c.Mac, c.Source)
+	}
+
+	if len(errs) != 0 {
+		log.Printf("%d queries failed, first error: %s", len(errs), errs[0])
+		os.Exit(3)
+	}
+}
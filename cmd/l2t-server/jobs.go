@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// job is a long running operation. Its state is read by HTTP handlers
+// while a worker goroutine updates it, so all access goes through methods.
+// The work is abandoned when ctx is done.
+type job struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	lock     sync.Mutex
+	id       string
+	kind     string
+	target   string
+	state    string
+	done     int
+	total    int
+	result   interface{}
+	err      error
+	created  time.Time
+	finished time.Time
+}
+
+// jobStatus is the JSON representation of a job.
+type jobStatus struct {
+	Id       string      `json:"id"`
+	Kind     string      `json:"kind"`
+	Target   string      `json:"target"`
+	State    string      `json:"state"`
+	Done     int         `json:"done"`
+	Total    int         `json:"total"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Created  time.Time   `json:"created"`
+	Finished *time.Time  `json:"finished,omitempty"`
+}
+
+func (o *job) status() jobStatus {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	s := jobStatus{
+		Id:      o.id,
+		Kind:    o.kind,
+		Target:  o.target,
+		State:   o.state,
+		Done:    o.done,
+		Total:   o.total,
+		Result:  o.result,
+		Created: o.created,
+	}
+	if o.err != nil {
+		s.Error = o.err.Error()
+	}
+	if !o.finished.IsZero() {
+		f := o.finished
+		s.Finished = &f
+	}
+	return s
+}
+
+func (o *job) setState(state string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.state = state
+}
+
+// setTotal records the number of steps the job expects to take.
+func (o *job) setTotal(total int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.total = total
+}
+
+// step records progress through the job.
+func (o *job) step() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.done++
+}
+
+// stop cancels the job. A job which is waiting for the target gives up
+// right away.
+func (o *job) stop() {
+	o.cancel()
+}
+
+func (o *job) finish(result interface{}, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.result = result
+	o.err = err
+	o.state = jobDone
+	if err != nil {
+		o.state = jobFailed
+	}
+	o.finished = time.Now()
+}
+
+// jobList keeps track of jobs. Finished jobs are forgotten after
+// the retention period. Jobs are cancelled when ctx is done. If timeout
+// isn't zero, jobs which haven't got hold of the target by then give up.
+type jobList struct {
+	ctx       context.Context
+	lock      sync.Mutex
+	next      int
+	jobs      map[string]*job
+	retention time.Duration
+	timeout   time.Duration
+}
+
+func newJobList(ctx context.Context, retention time.Duration, timeout time.Duration) *jobList {
+	return &jobList{
+		ctx:       ctx,
+		jobs:      make(map[string]*job),
+		retention: retention,
+		timeout:   timeout,
+	}
+}
+
+// start registers a new job and runs work in a goroutine. The work
+// function reports progress via the job, and returns the job's result.
+func (o *jobList) start(kind string, target string, work func(*job) (interface{}, error)) *job {
+	o.lock.Lock()
+	o.expire()
+	o.next++
+	j := &job{
+		id:      strconv.Itoa(o.next),
+		kind:    kind,
+		target:  target,
+		state:   jobQueued,
+		created: time.Now(),
+	}
+	if o.timeout > 0 {
+		j.ctx, j.cancel = context.WithTimeout(o.ctx, o.timeout)
+	} else {
+		j.ctx, j.cancel = context.WithCancel(o.ctx)
+	}
+	o.jobs[j.id] = j
+	o.lock.Unlock()
+
+	go func() {
+		j.finish(work(j))
+		j.cancel()
+	}()
+
+	return j
+}
+
+func (o *jobList) get(id string) *job {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.jobs[id]
+}
+
+func (o *jobList) list() []jobStatus {
+	o.lock.Lock()
+	o.expire()
+	jobs := make([]*job, 0, len(o.jobs))
+	for i := 1; i <= o.next; i++ {
+		if j, ok := o.jobs[strconv.Itoa(i)]; ok {
+			jobs = append(jobs, j)
+		}
+	}
+	o.lock.Unlock()
+
+	out := make([]jobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, j.status())
+	}
+	return out
+}
+
+// expire forgets finished jobs older than the retention period.
+// Caller must hold o.lock.
+func (o *jobList) expire() {
+	cutoff := time.Now().Add(-o.retention)
+	for id, j := range o.jobs {
+		j.lock.Lock()
+		old := !j.finished.IsZero() && j.finished.Before(cutoff)
+		j.lock.Unlock()
+		if old {
+			delete(o.jobs, id)
+		}
+	}
+}
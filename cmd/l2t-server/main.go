@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/target"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8228", "address:port for the HTTP listener")
+	perTarget := flag.Int("per-target", 2, "maximum concurrent operations per target")
+	retention := flag.Duration("job-retention", time.Hour, "how long finished jobs are remembered")
+	queueTimeout := flag.Duration("queue-timeout", 0, "how long a job may wait for the target before giving up (0 for no limit)")
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if *perTarget < 1 {
+		log.Fatal("-per-target must be at least 1")
+	}
+
+	// jobs are cancelled when we're asked to shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newBuilder := func() target.Builder {
+		return target.TargetBuilder().SetBind(bind)
+	}
+	s := newServer(newBuilder, *perTarget, newJobList(ctx, *retention, *queueTimeout))
+	hs := &http.Server{Addr: *listen, Handler: s.handler()}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Print("shutting down")
+		cancel()
+		_ = hs.Shutdown(context.Background())
+	}()
+
+	log.Printf("listening on %s", *listen)
+	err := hs.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+)
+
+const (
+	vlanMin = 1
+	vlanMax = 4094
+)
+
+// vlanResult is the result of a VLAN enumeration job.
+type vlanResult struct {
+	Vlans  []int    `json:"vlans"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// enumerateVlans asks the target about each VLAN in the range, reporting
+// progress via the job.
+func enumerateVlans(t target.Target, first int, last int, j *job) (interface{}, error) {
+	j.setTotal(last - first + 1)
+
+	progress := make(chan struct{})
+	go func() {
+		for range progress {
+			j.step()
+		}
+	}()
+	results, err := target.SweepVlans(t, first, last, progress)
+	close(progress)
+	if err != nil {
+		return nil, err
+	}
+
+	result := vlanResult{Vlans: []int{}}
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			result.Errors = append(result.Errors, fmt.Sprintf("vlan %d: %s", r.Vlan, r.Err))
+		case r.Found:
+			result.Vlans = append(result.Vlans, r.Vlan)
+		}
+	}
+	return result, nil
+}
+
+// traceHop is one switch along a layer 2 trace.
+type traceHop struct {
+	Address string         `json:"address"`
+	Reply   message.MsgDoc `json:"reply"`
+}
+
+// traceResult is the result of a trace job.
+type traceResult struct {
+	Hops []traceHop `json:"hops"`
+	Loop bool       `json:"loop,omitempty"`
+}
+
+// trace runs target.Trace(), reporting progress via the job.
+func trace(t target.Target, newBuilder func() target.Builder, src net.HardwareAddr, dst net.HardwareAddr, vlan int, j *job) (interface{}, error) {
+	j.setTotal(target.MaxTraceHops)
+	r, err := target.Trace(t, newBuilder, src, dst, vlan, func(target.TraceHop) {
+		j.step()
+	})
+
+	result := traceResult{Hops: []traceHop{}, Loop: r.Loop}
+	for _, h := range r.Hops {
+		result.Hops = append(result.Hops, traceHop{
+			Address: h.Address.String(),
+			Reply:   message.NewMsgDoc(h.Reply),
+		})
+	}
+	return result, err
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// managedTarget is a discovered target, along with the slots which limit
+// the number of operations running against it at once.
+type managedTarget struct {
+	id     string
+	target target.Target
+	slots  chan struct{}
+}
+
+// acquire waits for one of the target's slots, or for ctx to be done.
+func (o *managedTarget) acquire(ctx context.Context) error {
+	select {
+	case o.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (o *managedTarget) release() {
+	<-o.slots
+}
+
+// targetStatus is the JSON representation of a managedTarget.
+type targetStatus struct {
+	Id      string                 `json:"id"`
+	Summary string                 `json:"summary"`
+	Profile target.Profile         `json:"profile"`
+	Health  []target.AddressHealth `json:"health"`
+}
+
+func (o *managedTarget) status() targetStatus {
+	return targetStatus{
+		Id:      o.id,
+		Summary: o.target.String(),
+		Profile: o.target.Profile(),
+		Health:  o.target.Health(),
+	}
+}
+
+// server implements the HTTP API.
+type server struct {
+	newBuilder func() target.Builder
+	perTarget  int
+	jobs       *jobList
+
+	lock    sync.Mutex
+	targets map[string]*managedTarget
+}
+
+func newServer(newBuilder func() target.Builder, perTarget int, jobs *jobList) *server {
+	return &server{
+		newBuilder: newBuilder,
+		perTarget:  perTarget,
+		jobs:       jobs,
+		targets:    make(map[string]*managedTarget),
+	}
+}
+
+func (o *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/targets", o.handleTargets)
+	mux.HandleFunc("/targets/", o.handleTarget)
+	mux.HandleFunc("/jobs", o.handleJobs)
+	mux.HandleFunc("/jobs/", o.handleJob)
+	return mux
+}
+
+// httpError is an error with an associated HTTP status code.
+type httpError struct {
+	code int
+	err  error
+}
+
+func (o httpError) Error() string {
+	return o.err.Error()
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return httpError{code: http.StatusBadRequest, err: fmt.Errorf(format, a...)}
+}
+
+func notFound(format string, a ...interface{}) error {
+	return httpError{code: http.StatusNotFound, err: fmt.Errorf(format, a...)}
+}
+
+// statusFor picks an HTTP status code to go with an error.
+func statusFor(err error) int {
+	var he httpError
+	var ute target.UnreachableTargetError
+	switch {
+	case errors.As(err, &he):
+		return he.code
+	case errors.As(err, &ute), errors.Is(err, communicate.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, target.ErrVlanOutOfRange):
+		return http.StatusBadRequest
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusFor(err), struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return badRequest("cannot parse request body: %s", err)
+	}
+	return nil
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, httpError{
+		code: http.StatusMethodNotAllowed,
+		err:  fmt.Errorf("method not allowed, use %s", strings.Join(allowed, " or ")),
+	})
+}
+
+// handleTargets lists targets (GET) or discovers a new one (POST).
+func (o *server) handleTargets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		o.lock.Lock()
+		var ids []string
+		for id := range o.targets {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		out := make([]targetStatus, 0, len(ids))
+		for _, id := range ids {
+			out = append(out, o.targets[id].status())
+		}
+		o.lock.Unlock()
+		writeJSON(w, http.StatusOK, out)
+	case http.MethodPost:
+		mt, err := o.discover(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, mt.status())
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// discover builds a target from the addresses in the request. The target
+// is known by the first of those addresses.
+func (o *server) discover(r *http.Request) (*managedTarget, error) {
+	var req struct {
+		Addresses []string `json:"addresses"`
+	}
+	err := readJSON(r, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Addresses) == 0 {
+		return nil, badRequest("no addresses")
+	}
+
+	builder := o.newBuilder()
+	for _, a := range req.Addresses {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return nil, badRequest("cannot parse address `%s'", a)
+		}
+		builder.AddIp(ip)
+	}
+
+	t, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	mt := &managedTarget{
+		id:     net.ParseIP(req.Addresses[0]).String(),
+		target: t,
+		slots:  make(chan struct{}, o.perTarget),
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if existing, ok := o.targets[mt.id]; ok {
+		// keep the old slots, operations may be holding them
+		mt.slots = existing.slots
+	}
+	o.targets[mt.id] = mt
+	return mt, nil
+}
+
+func (o *server) getTarget(id string) (*managedTarget, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	mt, ok := o.targets[id]
+	if !ok {
+		return nil, notFound("unknown target `%s'", id)
+	}
+	return mt, nil
+}
+
+// handleTarget dispatches requests below /targets/<id>
+func (o *server) handleTarget(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/targets/"), "/"), "/")
+	mt, err := o.getTarget(parts[0])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		o.handleTargetRoot(w, r, mt)
+	case len(parts) == 2 && parts[1] == "vlans":
+		o.handleVlanScan(w, r, mt)
+	case len(parts) == 3 && parts[1] == "vlans":
+		o.handleVlan(w, r, mt, parts[2])
+	case len(parts) == 3 && parts[1] == "macs":
+		o.handleMac(w, r, mt, parts[2])
+	case len(parts) == 2 && parts[1] == "send":
+		o.handleSend(w, r, mt)
+	case len(parts) == 2 && parts[1] == "trace":
+		o.handleTrace(w, r, mt)
+	default:
+		writeError(w, notFound("no such resource `%s'", r.URL.Path))
+	}
+}
+
+func (o *server) handleTargetRoot(w http.ResponseWriter, r *http.Request, mt *managedTarget) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, mt.status())
+	case http.MethodDelete:
+		o.lock.Lock()
+		delete(o.targets, mt.id)
+		o.lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// handleVlanScan starts a VLAN enumeration job.
+func (o *server) handleVlanScan(w http.ResponseWriter, r *http.Request, mt *managedTarget) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	req := struct {
+		First int `json:"first"`
+		Last  int `json:"last"`
+	}{First: vlanMin, Last: vlanMax}
+	if r.ContentLength != 0 {
+		err := readJSON(r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if req.First < vlanMin || req.Last > vlanMax || req.First > req.Last {
+		writeError(w, badRequest("vlan range must fall within %d-%d", vlanMin, vlanMax))
+		return
+	}
+
+	j := o.jobs.start("vlans", mt.id, func(j *job) (interface{}, error) {
+		err := mt.acquire(j.ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer mt.release()
+		j.setState(jobRunning)
+		return enumerateVlans(mt.target, req.First, req.Last, j)
+	})
+	writeJSON(w, http.StatusAccepted, j.status())
+}
+
+func (o *server) handleVlan(w http.ResponseWriter, r *http.Request, mt *managedTarget, vlanString string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	vlan, err := strconv.Atoi(vlanString)
+	if err != nil || vlan < vlanMin || vlan > vlanMax {
+		writeError(w, badRequest("bad vlan `%s'", vlanString))
+		return
+	}
+
+	err = mt.acquire(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mt.release()
+
+	exists, err := mt.target.HasVlan(vlan)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Vlan   int  `json:"vlan"`
+		Exists bool `json:"exists"`
+	}{Vlan: vlan, Exists: exists})
+}
+
+func (o *server) handleMac(w http.ResponseWriter, r *http.Request, mt *managedTarget, macString string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	mac, err := net.ParseMAC(macString)
+	if err != nil {
+		writeError(w, badRequest("bad mac `%s'", macString))
+		return
+	}
+
+	vlan, err := strconv.Atoi(r.URL.Query().Get("vlan"))
+	if err != nil {
+		writeError(w, badRequest("vlan query parameter required"))
+		return
+	}
+
+	err = mt.acquire(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mt.release()
+
+	found, err := mt.target.MacInVlan(mac, vlan)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Mac   string `json:"mac"`
+		Vlan  int    `json:"vlan"`
+		Found bool   `json:"found"`
+	}{Mac: mac.String(), Vlan: vlan, Found: found})
+}
+
+// handleSend sends a message described by a message.MsgDoc, and returns
+// the reply in the same form.
+func (o *server) handleSend(w http.ResponseWriter, r *http.Request, mt *managedTarget) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var doc message.MsgDoc
+	err := readJSON(r, &doc)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	msg, err := doc.Msg()
+	if err != nil {
+		writeError(w, badRequest("%s", err))
+		return
+	}
+
+	err = mt.acquire(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mt.release()
+
+	reply, err := mt.target.Send(msg)
+	if err != nil && reply == nil {
+		writeError(w, err)
+		return
+	}
+
+	out := struct {
+		Reply message.MsgDoc `json:"reply"`
+		Error string         `json:"error,omitempty"`
+	}{Reply: message.NewMsgDoc(reply)}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleTrace starts a trace job.
+func (o *server) handleTrace(w http.ResponseWriter, r *http.Request, mt *managedTarget) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req struct {
+		SrcMac string `json:"src_mac"`
+		DstMac string `json:"dst_mac"`
+		Vlan   int    `json:"vlan"`
+	}
+	err := readJSON(r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var macs []net.HardwareAddr
+	for _, m := range []string{req.SrcMac, req.DstMac} {
+		mac, err := net.ParseMAC(m)
+		if err != nil {
+			writeError(w, badRequest("bad mac `%s'", m))
+			return
+		}
+		macs = append(macs, mac)
+	}
+	if req.Vlan < vlanMin || req.Vlan > vlanMax {
+		writeError(w, badRequest("bad vlan %d", req.Vlan))
+		return
+	}
+
+	j := o.jobs.start("trace", mt.id, func(j *job) (interface{}, error) {
+		err := mt.acquire(j.ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer mt.release()
+		j.setState(jobRunning)
+		return trace(mt.target, o.newBuilder, macs[0], macs[1], req.Vlan, j)
+	})
+	writeJSON(w, http.StatusAccepted, j.status())
+}
+
+func (o *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, o.jobs.list())
+}
+
+// handleJob reports on a job (GET) or cancels it (DELETE).
+func (o *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	j := o.jobs.get(id)
+	if j == nil {
+		writeError(w, notFound("unknown job `%s'", id))
+		return
+	}
+	if r.Method == http.MethodDelete {
+		j.stop()
+	}
+	writeJSON(w, http.StatusOK, j.status())
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testServer() *httptest.Server {
+	s := newServer(target.TestTargetBuilder, 1, newJobList(context.Background(), time.Hour, 0))
+	return httptest.NewServer(s.handler())
+}
+
+func do(t *testing.T, method string, url string, body string) (int, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, buf.Bytes()
+}
+
+func TestTargets(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	code, body := do(t, http.MethodPost, ts.URL+"/targets", `{"addresses": ["127.0.0.1", "127.0.0.2"]}`)
+	if code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, code, body)
+	}
+	var status targetStatus
+	err := json.Unmarshal(body, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Id != "127.0.0.1" || len(status.Profile.Addresses) != 2 || len(status.Health) != 2 {
+		t.Fatalf("unexpected target status: %s", body)
+	}
+
+	code, body = do(t, http.MethodGet, ts.URL+"/targets", "")
+	var list []targetStatus
+	err = json.Unmarshal(body, &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK || len(list) != 1 {
+		t.Fatalf("expected one target, got %d: %s", code, body)
+	}
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{http.MethodGet, "/targets/127.0.0.1", "", http.StatusOK},
+		{http.MethodGet, "/targets/192.0.2.1", "", http.StatusNotFound},
+		{http.MethodPost, "/targets", `{"addresses": []}`, http.StatusBadRequest},
+		{http.MethodPost, "/targets", `{"addresses": ["bogus"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/targets", `{"bogus": true}`, http.StatusBadRequest},
+		{http.MethodPut, "/targets", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/targets/127.0.0.1/vlans/0", "", http.StatusBadRequest},
+		{http.MethodGet, "/targets/127.0.0.1/vlans/4095", "", http.StatusBadRequest},
+		{http.MethodPost, "/targets/127.0.0.1/vlans", `{"first": 10, "last": 5}`, http.StatusBadRequest},
+		{http.MethodGet, "/targets/127.0.0.1/macs/bogus?vlan=1", "", http.StatusBadRequest},
+		{http.MethodGet, "/targets/127.0.0.1/macs/0011.2233.4455", "", http.StatusBadRequest},
+		{http.MethodPost, "/targets/127.0.0.1/send", `{"type": "bogus"}`, http.StatusBadRequest},
+		{http.MethodPost, "/targets/127.0.0.1/trace", `{"src_mac": "bogus", "dst_mac": "0011.2233.4455", "vlan": 1}`, http.StatusBadRequest},
+		{http.MethodGet, "/targets/127.0.0.1/bogus", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/1", "", http.StatusNotFound},
+		{http.MethodDelete, "/targets/127.0.0.1", "", http.StatusNoContent},
+		{http.MethodGet, "/targets/127.0.0.1", "", http.StatusNotFound},
+	} {
+		code, body := do(t, tc.method, ts.URL+tc.path, tc.body)
+		if code != tc.code {
+			t.Fatalf("%s %s: expected %d, got %d: %s", tc.method, tc.path, tc.code, code, body)
+		}
+	}
+}
+
+func TestJobList(t *testing.T) {
+	jl := newJobList(context.Background(), time.Hour, 0)
+	release := make(chan struct{})
+	j := jl.start("test", "192.0.2.1", func(j *job) (interface{}, error) {
+		j.setState(jobRunning)
+		j.setTotal(2)
+		j.step()
+		<-release
+		return nil, errors.New("broken")
+	})
+
+	if jl.get(j.id) != j {
+		t.Fatal("job not registered")
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for j.status().State != jobFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not fail: %+v", j.status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s := j.status()
+	if s.Done != 1 || s.Total != 2 || s.Error != "broken" || s.Finished == nil {
+		t.Fatalf("unexpected job status: %+v", s)
+	}
+	if len(jl.list()) != 1 {
+		t.Fatal("expected one job")
+	}
+
+	jl.retention = 0
+	time.Sleep(time.Millisecond)
+	if len(jl.list()) != 0 {
+		t.Fatal("finished job should have expired")
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	mt := &managedTarget{slots: make(chan struct{}, 1)}
+	mt.slots <- struct{}{} // target busy
+
+	work := func(j *job) (interface{}, error) {
+		err := mt.acquire(j.ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer mt.release()
+		return nil, nil
+	}
+	waitFailed := func(j *job) jobStatus {
+		deadline := time.Now().Add(time.Second)
+		for j.status().State != jobFailed {
+			if time.Now().After(deadline) {
+				t.Fatalf("job did not fail: %+v", j.status())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return j.status()
+	}
+
+	jl := newJobList(context.Background(), time.Hour, 0)
+	j := jl.start("test", "192.0.2.1", work)
+	j.stop()
+	if s := waitFailed(j); s.Error != context.Canceled.Error() {
+		t.Fatalf("unexpected job status: %+v", s)
+	}
+
+	jl = newJobList(context.Background(), time.Hour, 10*time.Millisecond)
+	j = jl.start("test", "192.0.2.1", work)
+	if s := waitFailed(j); s.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("unexpected job status: %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jl = newJobList(ctx, time.Hour, 0)
+	j = jl.start("test", "192.0.2.1", work)
+	cancel()
+	waitFailed(j)
+}
+
+func TestAcquire(t *testing.T) {
+	mt := &managedTarget{slots: make(chan struct{}, 1)}
+	err := mt.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = mt.acquire(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if statusFor(err) != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, statusFor(err))
+	}
+
+	mt.release()
+	err = mt.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
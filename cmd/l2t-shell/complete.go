@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"sort"
+	"strings"
+)
+
+// attrNames returns the AttrTypeString names in numeric order.
+func attrNames() []string {
+	var types []int
+	for t := range attribute.AttrTypeString {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+
+	var out []string
+	for _, t := range types {
+		out = append(out, attribute.AttrTypeString[attribute.AttrType(t)])
+	}
+	return out
+}
+
+// completionsFor returns the candidate completions for the word ending at
+// the cursor. The first word completes to command names. Words following
+// "-a" complete to attribute names (with a ':' appended).
+func completionsFor(words []string) []string {
+	var candidates []string
+	switch {
+	case len(words) <= 1:
+		for name := range commands {
+			candidates = append(candidates, name+" ")
+		}
+	case len(words) >= 2 && words[len(words)-2] == "-a":
+		for _, name := range attrNames() {
+			candidates = append(candidates, name+":")
+		}
+	default:
+		return nil
+	}
+
+	var prefix string
+	if len(words) > 0 {
+		prefix = words[len(words)-1]
+	}
+
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// complete implements tab completion for the terminal. When the word
+// ending at the cursor has exactly one completion it's filled in. When it
+// has several, it's extended to their longest common prefix.
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	before := line[:pos]
+	words := strings.Fields(before)
+	if len(before) == 0 || strings.HasSuffix(before, " ") {
+		words = append(words, "")
+	}
+
+	matches := completionsFor(words)
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	word := words[len(words)-1]
+	completion := commonPrefix(matches)
+	if len(completion) <= len(word) {
+		return "", 0, false
+	}
+
+	newBefore := before[:len(before)-len(word)] + completion
+	return newBefore + line[pos:], len(newBefore), true
+}
+
+// commonPrefix returns the longest string which prefixes each of in.
+func commonPrefix(in []string) string {
+	if len(in) == 0 {
+		return ""
+	}
+	prefix := in[0]
+	for _, s := range in[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/target"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+const (
+	historyFileName = ".l2t_shell_history"
+)
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+func main() {
+	historyFile := flag.String("history", defaultHistoryFile(), "command history file (empty to disable)")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(),
+			"\nUsage:\n  %s [options] <catalyst-ip-address>\n\nOptions:\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ip := net.ParseIP(flag.Arg(0))
+	if ip == nil {
+		addrs, err := net.LookupIP(flag.Arg(0))
+		if err != nil || len(addrs) == 0 {
+			log.Printf("cannot resolve target switch address `%s'", flag.Arg(0))
+			os.Exit(2)
+		}
+		ip = addrs[0]
+	}
+
+	t, err := target.TargetBuilder().SetBind(bind).AddIp(ip).Build()
+	if err != nil {
+		log.Println(err)
+		os.Exit(3)
+	}
+	fmt.Println(t.String())
+
+	var history []string
+	if *historyFile != "" {
+		history, err = readHistory(*historyFile)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	lr, err := newLineReader(history)
+	if err != nil {
+		log.Println(err)
+		os.Exit(4)
+	}
+
+	sh := newShell(t, lr)
+	sh.bind = bind
+	for {
+		line, err := lr.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(lr, err)
+			break
+		}
+
+		err = sh.exec(line)
+		if err == errQuit {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(lr, err)
+		}
+	}
+	lr.Close()
+
+	if *historyFile != "" {
+		err = appendHistory(*historyFile, sh.history)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/target"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	attrSep = ":"
+)
+
+// errQuit is returned by the quit command to end the session.
+var errQuit = errors.New("quit")
+
+type command struct {
+	usage string
+	help  string
+	run   func(*shell, []string) error
+}
+
+// commands is populated in init() because the help command refers to it.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"vlan": {
+			usage: "vlan <vlan>?",
+			help:  "check whether a VLAN exists on the switch",
+			run:   (*shell).vlan,
+		},
+		"mac": {
+			usage: "mac <mac> in <vlan>",
+			help:  "check whether the switch knows a MAC address in a VLAN",
+			run:   (*shell).mac,
+		},
+		"trace": {
+			usage: "trace <src-mac> <dst-mac> <vlan>",
+			help:  "trace the layer 2 path between two MACs, following CDP neighbors",
+			run:   (*shell).trace,
+		},
+		"swap": {
+			usage: "swap <mac> <mac> <vlan>",
+			help:  "query a MAC pair as src/dst both ways with both request types, combine the evidence",
+			run:   (*shell).swap,
+		},
+		"raw": {
+			usage: "raw [-t <type>] -a <type:value|hex> ...",
+			help:  "send a message built from attributes, print the reply",
+			run:   (*shell).raw,
+		},
+		"neighbors": {
+			usage: "neighbors",
+			help:  "list CDP neighbors revealed by replies during this session",
+			run:   (*shell).listNeighbors,
+		},
+		"info": {
+			usage: "info",
+			help:  "describe the target switch and the health of its addresses",
+			run:   (*shell).info,
+		},
+		"history": {
+			usage: "history",
+			help:  "list commands entered during this session",
+			run:   (*shell).listHistory,
+		},
+		"help": {
+			usage: "help",
+			help:  "list commands",
+			run:   (*shell).help,
+		},
+		"quit": {
+			usage: "quit",
+			help:  "leave the shell",
+			run:   func(*shell, []string) error { return errQuit },
+		},
+	}
+}
+
+// neighbor is a CDP neighbor revealed by a reply.
+type neighbor struct {
+	ip  string
+	id  string
+	via string
+}
+
+// shell holds the state of an interactive session with a switch.
+type shell struct {
+	target    target.Target
+	out       io.Writer
+	history   []string
+	neighbors map[string]neighbor
+	bind      communicate.Bind // used for targets found along the way
+}
+
+func newShell(t target.Target, out io.Writer) *shell {
+	return &shell{
+		target:    t,
+		out:       out,
+		neighbors: make(map[string]neighbor),
+	}
+}
+
+// exec runs one line of input. It returns errQuit when the session
+// should end.
+func (o *shell) exec(line string) error {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return nil
+	}
+	o.history = append(o.history, line)
+
+	if words[0] == "exit" {
+		words[0] = "quit"
+	}
+
+	c, ok := commands[words[0]]
+	if !ok {
+		return fmt.Errorf("unknown command `%s', try `help'", words[0])
+	}
+	return c.run(o, words[1:])
+}
+
+func (o *shell) vlan(args []string) error {
+	if len(args) != 1 {
+		return usageError("vlan")
+	}
+
+	vlan, err := strconv.Atoi(strings.TrimSuffix(args[0], "?"))
+	if err != nil {
+		return usageError("vlan")
+	}
+
+	found, err := o.target.HasVlan(vlan)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		fmt.Fprintf(o.out, "vlan %d exists\n", vlan)
+	} else {
+		fmt.Fprintf(o.out, "vlan %d not found\n", vlan)
+	}
+	return nil
+}
+
+func (o *shell) mac(args []string) error {
+	if len(args) == 3 && args[1] == "in" {
+		args = []string{args[0], args[2]}
+	}
+	if len(args) != 2 {
+		return usageError("mac")
+	}
+
+	mac, err := net.ParseMAC(args[0])
+	if err != nil {
+		return err
+	}
+
+	vlan, err := strconv.Atoi(strings.TrimSuffix(args[1], "?"))
+	if err != nil {
+		return usageError("mac")
+	}
+
+	found, err := o.target.MacInVlan(mac, vlan)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		fmt.Fprintf(o.out, "%s found in vlan %d\n", mac, vlan)
+	} else {
+		fmt.Fprintf(o.out, "%s not found in vlan %d\n", mac, vlan)
+	}
+	return nil
+}
+
+// trace follows the path between two MACs, printing each hop as it's
+// revealed.
+func (o *shell) trace(args []string) error {
+	if len(args) != 3 {
+		return usageError("trace")
+	}
+
+	var macs []net.HardwareAddr
+	for _, arg := range args[:2] {
+		mac, err := net.ParseMAC(arg)
+		if err != nil {
+			return err
+		}
+		macs = append(macs, mac)
+	}
+
+	vlan, err := strconv.Atoi(args[2])
+	if err != nil {
+		return usageError("trace")
+	}
+
+	newBuilder := func() target.Builder {
+		return target.TargetBuilder().SetBind(o.bind)
+	}
+	hops := 0
+	r, err := target.Trace(o.target, newBuilder, macs[0], macs[1], vlan, func(h target.TraceHop) {
+		hops++
+		fmt.Fprintf(o.out, "hop %d: %s\n", hops, h.Address)
+		printAttrs(o.out, h.Reply)
+		o.noteNeighbors(h.Reply, h.Address.String())
+	})
+	if r.Loop {
+		fmt.Fprintf(o.out, "loop detected at %s\n", r.Hops[len(r.Hops)-1].Reply.GetAttr(attribute.NbrIPv4Type))
+	}
+	return err
+}
+
+func (o *shell) swap(args []string) error {
+	if len(args) != 3 {
+		return usageError("swap")
+	}
+
+	var macs []net.HardwareAddr
+	for _, arg := range args[:2] {
+		mac, err := net.ParseMAC(arg)
+		if err != nil {
+			return err
+		}
+		macs = append(macs, mac)
+	}
+
+	vlan, err := strconv.Atoi(args[2])
+	if err != nil {
+		return usageError("swap")
+	}
+
+	r, err := target.SwapProbe(o.target, macs[0], macs[1], vlan)
+	for _, reply := range r.Replies {
+		result := reply.Status
+		if reply.Err != nil {
+			result = reply.Err.Error()
+		}
+		fmt.Fprintf(o.out, "  %-15s %s -> %s: %s\n",
+			message.MsgTypeToString[reply.Type], reply.Src, reply.Dst, result)
+		if reply.Reply != nil {
+			o.noteNeighbors(reply.Reply, o.target.GetIps()[0].String())
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range []target.MacEvidence{r.A, r.B} {
+		fmt.Fprintf(o.out, "%s %s in vlan %d", e.Mac, e.Presence, vlan)
+		if e.Port != "" {
+			fmt.Fprintf(o.out, " on %s", e.Port)
+		}
+		fmt.Fprintln(o.out)
+	}
+	for _, n := range r.Neighbors {
+		fmt.Fprintf(o.out, "neighbor %s\n", n)
+	}
+	return nil
+}
+
+func (o *shell) raw(args []string) error {
+	msg, err := parseRaw(args)
+	if err != nil {
+		return err
+	}
+
+	reply, err := o.target.Send(msg)
+	if reply != nil {
+		fmt.Fprintf(o.out, "Received: %s\n", reply.String())
+		printAttrs(o.out, reply)
+		o.noteNeighbors(reply, o.target.GetIps()[0].String())
+	}
+	return err
+}
+
+// parseRaw builds a message from "-t <type>" and "-a <attribute>" options.
+// Attributes take the form 'type:value' or a hex TLV string, like l2t_ss.
+func parseRaw(args []string) (message.Msg, error) {
+	builder := message.NewMsgBuilder()
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return nil, usageError("raw")
+		}
+		value := args[i+1]
+		switch args[i] {
+		case "-t":
+			t, err := message.MsgStringToType(value)
+			if err != nil {
+				return nil, err
+			}
+			builder.SetType(t)
+		case "-a":
+			a, err := parseAttr(value)
+			if err != nil {
+				return nil, err
+			}
+			builder.SetAttr(a)
+		default:
+			return nil, usageError("raw")
+		}
+		i++
+	}
+	return builder.Build(), nil
+}
+
+func parseAttr(in string) (attribute.Attribute, error) {
+	if strings.Contains(in, attrSep) {
+		result := strings.SplitN(in, attrSep, 2)
+		aType, err := attribute.AttrStringToType(result[0])
+		if err != nil {
+			return nil, err
+		}
+		return attribute.NewAttrBuilder().SetType(aType).SetString(result[1]).Build()
+	}
+
+	b, err := hex.DecodeString(in)
+	if err != nil {
+		return nil, err
+	}
+	return attribute.UnmarshalAttribute(b)
+}
+
+// noteNeighbors records any CDP neighbor revealed by a reply.
+func (o *shell) noteNeighbors(reply message.Msg, via string) {
+	ip := reply.GetAttr(attribute.NbrIPv4Type)
+	if ip == nil {
+		return
+	}
+	n := neighbor{ip: ip.String(), via: via}
+	if id := reply.GetAttr(attribute.NbrDevIDType); id != nil {
+		n.id = id.String()
+	}
+	o.neighbors[n.ip] = n
+}
+
+func (o *shell) listNeighbors([]string) error {
+	if len(o.neighbors) == 0 {
+		fmt.Fprintln(o.out, "no neighbors seen yet (try `trace')")
+		return nil
+	}
+
+	var ips []string
+	for ip := range o.neighbors {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	for _, ip := range ips {
+		n := o.neighbors[ip]
+		fmt.Fprintf(o.out, "  %-15s %-30s via %s\n", n.ip, n.id, n.via)
+	}
+	return nil
+}
+
+func (o *shell) info([]string) error {
+	fmt.Fprintln(o.out, o.target.String())
+	for _, h := range o.target.Health() {
+		state := "usable"
+		if !h.Usable {
+			state = "failed"
+		}
+		if h.Active {
+			state = "active"
+		}
+		fmt.Fprintf(o.out, "  %-15s %-6s srtt %s, %d consecutive failures\n",
+			h.Destination, state, h.Srtt, h.ConsecutiveFailures)
+	}
+	return nil
+}
+
+func (o *shell) listHistory([]string) error {
+	for i, h := range o.history {
+		fmt.Fprintf(o.out, "%4d  %s\n", i+1, h)
+	}
+	return nil
+}
+
+func (o *shell) help([]string) error {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(o.out, "  %-40s %s\n", commands[name].usage, commands[name].help)
+	}
+	return nil
+}
+
+func printAttrs(w io.Writer, msg message.Msg) {
+	for _, a := range attribute.SortAttributes(msg.Attributes()) {
+		fmt.Fprintf(w, "  %2d %-22s %s\n", a.Type(), attribute.AttrTypeString[a.Type()], a.String())
+	}
+}
+
+func usageError(name string) error {
+	return fmt.Errorf("usage: %s", commands[name].usage)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		expected string
+		ok       bool
+	}{
+		{"vl", "vlan ", true},
+		{"ne", "neighbors ", true},
+		{"h", "h", false}, // help, history
+		{"he", "help ", true},
+		{"raw -a L2_ATTR_V", "raw -a L2_ATTR_VLAN:", true},
+		{"raw -a L2_ATTR_SRC_", "raw -a L2_ATTR_SRC_", false}, // SRC_MAC, SRC_IP
+		{"raw -a L2_ATTR_IN", "raw -a L2_ATTR_INPORT_", true},
+		{"vlan 10", "vlan 10", false},
+	} {
+		line, pos, ok := complete(tc.line, len(tc.line), '\t')
+		if ok != tc.ok {
+			t.Fatalf("%q: expected ok %t, got %t", tc.line, tc.ok, ok)
+		}
+		if !ok {
+			continue
+		}
+		if line != tc.expected || pos != len(tc.expected) {
+			t.Fatalf("%q: expected %q, got %q (pos %d)", tc.line, tc.expected, line, pos)
+		}
+	}
+
+	_, _, ok := complete("vl", 2, 'x')
+	if ok {
+		t.Fatal("only tab should complete")
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	msg, err := parseRaw([]string{"-t", "1", "-a", "3:100", "-a", "0108ffffffffffff", "-a", "L2_ATTR_DST_MAC:0011.2233.4455"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type() != message.RequestDst {
+		t.Fatalf("expected type %d, got %d", message.RequestDst, msg.Type())
+	}
+	if msg.AttrCount() != 3 {
+		t.Fatalf("expected 3 attributes, got %d", msg.AttrCount())
+	}
+	if msg.GetAttr(attribute.VlanType).String() != "100" {
+		t.Fatalf("expected vlan 100, got %s", msg.GetAttr(attribute.VlanType).String())
+	}
+
+	for _, bad := range [][]string{{"-a"}, {"-x", "1"}, {"-a", "3:bogus"}, {"-a", "zz"}} {
+		_, err := parseRaw(bad)
+		if err == nil {
+			t.Fatalf("%v should have produced an error", bad)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	out := &bytes.Buffer{}
+	sh := newShell(nil, out)
+
+	if sh.exec("bogus") == nil {
+		t.Fatal("unknown command should produce an error")
+	}
+	if sh.exec("vlan") == nil {
+		t.Fatal("vlan without argument should produce an error")
+	}
+	if sh.exec("exit") != errQuit {
+		t.Fatal("exit should quit")
+	}
+	if err := sh.exec("history"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sh.history) != 4 {
+		t.Fatalf("expected 4 history entries, got %d", len(sh.history))
+	}
+	if err := sh.exec("neighbors"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	prompt         = "l2t> "
+	maxHistoryLoad = 100 // the terminal's history ring holds this many
+)
+
+// lineReader reads commands from the user.
+type lineReader interface {
+	ReadLine() (string, error)
+	io.Writer
+	Close() error
+}
+
+// newLineReader returns a line editing terminal with history and tab
+// completion if stdin is a terminal, or a plain line scanner otherwise.
+func newLineReader(history []string) (lineReader, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return &plainReader{scanner: bufio.NewScanner(os.Stdin)}, nil
+	}
+
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &preloadReadWriter{
+		Reader: os.Stdin,
+		Writer: os.Stdout,
+	}
+	t := terminal.NewTerminal(rw, prompt)
+	t.AutoCompleteCallback = complete
+	if w, h, err := terminal.GetSize(fd); err == nil {
+		_ = t.SetSize(w, h)
+	}
+
+	// The terminal offers no way to set its history, so we type the saved
+	// history into it with the output discarded.
+	if len(history) > maxHistoryLoad {
+		history = history[len(history)-maxHistoryLoad:]
+	}
+	rw.preload = bytes.NewBufferString(strings.Join(history, "\r") + "\r")
+	for range history {
+		_, _ = t.ReadLine()
+	}
+	rw.preload = nil
+
+	return &termReader{Terminal: t, fd: fd, state: state}, nil
+}
+
+// preloadReadWriter feeds the terminal from preload (silently)
+// until it runs dry, then from the real terminal.
+type preloadReadWriter struct {
+	io.Reader
+	io.Writer
+	preload *bytes.Buffer
+}
+
+func (o *preloadReadWriter) Read(p []byte) (int, error) {
+	if o.preload != nil && o.preload.Len() > 0 {
+		return o.preload.Read(p)
+	}
+	return o.Reader.Read(p)
+}
+
+func (o *preloadReadWriter) Write(p []byte) (int, error) {
+	if o.preload != nil {
+		return ioutil.Discard.Write(p)
+	}
+	return o.Writer.Write(p)
+}
+
+type termReader struct {
+	*terminal.Terminal
+	fd    int
+	state *terminal.State
+}
+
+func (o *termReader) Close() error {
+	return terminal.Restore(o.fd, o.state)
+}
+
+type plainReader struct {
+	scanner *bufio.Scanner
+}
+
+func (o *plainReader) ReadLine() (string, error) {
+	if !o.scanner.Scan() {
+		if o.scanner.Err() != nil {
+			return "", o.scanner.Err()
+		}
+		return "", io.EOF
+	}
+	return o.scanner.Text(), nil
+}
+
+func (o *plainReader) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (o *plainReader) Close() error {
+	return nil
+}
+
+// readHistory returns the lines in the history file. A missing
+// file is not an error.
+func readHistory(filename string) ([]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) != "" {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// appendHistory adds lines to the history file.
+func appendHistory(filename string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -35,7 +35,14 @@ const (
 	rttFlagHelp       = "estimate of round-trip latency in milliseconds (default 500)"
 	vasiliFlag        = "V"
 	vasiliFlagHelp    = "One ping only, Mr. Vasili"
+	specFlag          = "f"
+	specFlagHelp      = "JSON or YAML file describing a sequence of messages to send"
+	outFlag           = "o"
+	outFlagHelp       = "file for spec results, JSON if named *.json, YAML otherwise (default stdout)"
+	collectorFlag     = "C"
+	collectorFlagHelp = "collect the reply at this local address, ip[:port] (include '-a 14:<ip>' so the switch replies there)"
 	usageTextCmd      = "[options] <catalyst-ip-address>\n"
+	usageTextSpec     = "-f <spec-file> [-o <results-file>] [catalyst-ip-address]\n"
 	usageTextExplain  = "The following examples both create the same message:\n" +
 		"  -a 2:0004.f284.dbbf -a 1:00:50:56:98:e2:12 -a 3:18 -a 14:192.168.1.2 <catalyst-ip-address>\n" +
 		"  -t 2 -v 1 -l 31 -c 4 -a 02080004f284dbbf -a 010800505698e212 -a 03040012 -a 0e06c0a80102 <catalyst-ip-address>"
@@ -113,64 +120,125 @@ func flagProvided(name string) bool {
 	return found
 }
 
-func buildMsgBytes(t uint8, v uint8, l uint16, c uint8, asf attrStringFlags) ([]byte, error) {
-	payload, err := getAttsBytesFromStrings(asf)
+// buildMsgBytes assembles a message from the attribute strings. Header
+// values are calculated unless overridden in h.
+func buildMsgBytes(h msgHeader, attrStrings []string) ([]byte, error) {
+	payload, err := getAttsBytesFromStrings(attrStrings)
 	if err != nil {
-		log.Println(err)
-		os.Exit(11)
+		return nil, err
 	}
 
-	bb := bytes.Buffer{}
-
-	if flagProvided(typeFlag) {
-		_, err = bb.Write([]byte{t})
-	} else {
-		_, err = bb.Write([]byte{uint8(message.RequestDst)})
+	msgType := uint8(message.RequestDst)
+	if h.Type != nil {
+		msgType = *h.Type
 	}
-	if err != nil {
-		log.Println(err)
-		os.Exit(12)
+
+	msgVer := uint8(defaultVersion)
+	if h.Version != nil {
+		msgVer = *h.Version
 	}
 
-	if flagProvided(verFlag) {
-		_, err = bb.Write([]byte{v})
-	} else {
-		_, err = bb.Write([]byte{uint8(defaultVersion)})
+	msgLen := uint16(len(payload) + 5)
+	if h.Length != nil {
+		msgLen = *h.Length
 	}
-	if err != nil {
-		log.Println(err)
-		os.Exit(13)
+
+	attrCount := uint8(len(attrStrings))
+	if h.AttrCount != nil {
+		attrCount = *h.AttrCount
 	}
 
 	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, msgLen)
+
+	bb := bytes.Buffer{}
+	bb.Write([]byte{msgType, msgVer})
+	bb.Write(b)
+	bb.Write([]byte{attrCount})
+	bb.Write(payload)
+
+	return bb.Bytes(), nil
+}
+
+// headerFromFlags returns a msgHeader populated with any
+// header values provided on the command line.
+func headerFromFlags(t int, v int, l int, c int) msgHeader {
+	var h msgHeader
+	if flagProvided(typeFlag) {
+		t8 := uint8(t)
+		h.Type = &t8
+	}
+	if flagProvided(verFlag) {
+		v8 := uint8(v)
+		h.Version = &v8
+	}
 	if flagProvided(lenFlag) {
-		binary.BigEndian.PutUint16(b, l)
-	} else {
-		binary.BigEndian.PutUint16(b, uint16(len(payload)+5))
+		l16 := uint16(l)
+		h.Length = &l16
 	}
-	_, err = bb.Write(b)
+	if flagProvided(attrCountFlag) {
+		c8 := uint8(c)
+		h.AttrCount = &c8
+	}
+	return h
+}
+
+// runSpec runs the messages described in specFile, writes the results
+// and returns the exit status.
+func runSpec(specFile string, outFile string, defaultTarget string, rttGuess time.Duration, bind communicate.Bind) int {
+	f, err := os.Open(specFile)
 	if err != nil {
 		log.Println(err)
-		os.Exit(14)
+		return 2
+	}
+	s, err := readSpec(f)
+	f.Close()
+	if err != nil {
+		log.Printf("%s: %s", specFile, err)
+		return 2
 	}
 
-	if flagProvided(attrCountFlag) {
-		_, err = bb.Write([]byte{c})
-	} else {
-		_, err = bb.Write([]byte{uint8(len(asf))})
+	errs, mismatches := s.run(defaultTarget, rttGuess, bind)
+
+	out := os.Stdout
+	format := specFile
+	if outFile != "" {
+		out, err = os.Create(outFile)
+		if err != nil {
+			log.Println(err)
+			return 2
+		}
+		defer out.Close()
+		format = outFile
 	}
+	err = writeSpec(out, s, format)
 	if err != nil {
 		log.Println(err)
-		os.Exit(15)
+		return 2
 	}
 
-	_, err = bb.Write(payload)
-	if err != nil {
-		log.Println(err)
-		os.Exit(16)
+	switch {
+	case errs > 0:
+		log.Printf("%d of %d messages failed", errs, len(s.Messages))
+		return 3
+	case mismatches > 0:
+		log.Printf("%d of %d replies did not match the expected reply status", mismatches, len(s.Messages))
+		return 4
 	}
+	return 0
+}
 
-	return bb.Bytes(), nil
+// newCollector starts a collector on an address of the form ip[:port].
+func newCollector(in string) (*communicate.Collector, error) {
+	addr := &net.UDPAddr{IP: net.ParseIP(in)}
+	if addr.IP == nil {
+		var err error
+		addr, err = net.ResolveUDPAddr("udp", in)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return communicate.NewCollector(addr)
 }
 
 func main() {
@@ -183,28 +251,40 @@ func main() {
 	doPrint := flag.Bool(printFlag, false, printFlagHelp)
 	rttGuess := flag.Int(rttFlag, 500, rttFlagHelp)
 	vasili := flag.Bool(vasiliFlag, false, vasiliFlagHelp)
+	specFile := flag.String(specFlag, "", specFlagHelp)
+	outFile := flag.String(outFlag, "", outFlagHelp)
+	collectorAddr := flag.String(collectorFlag, "", collectorFlagHelp)
+	var bind communicate.Bind
+	bind.AddFlags(flag.CommandLine)
 
 	flag.Usage = func() {
 		_, _ = fmt.Fprintf(flag.CommandLine.Output(),
-			"\nUsage:\n  %s %s\n%s\n\nOptions:\n",
+			"\nUsage:\n  %s %s  %s %s\n%s\n\nOptions:\n",
 			os.Args[0],
 			usageTextCmd,
+			os.Args[0],
+			usageTextSpec,
 			usageTextExplain,
 		)
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
+	if *specFile != "" {
+		if flag.NArg() > 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		os.Exit(runSpec(*specFile, *outFile, flag.Arg(0), time.Duration(*rttGuess)*time.Millisecond, bind))
+	}
+
 	if flag.NArg() != 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	payload, err := buildMsgBytes(
-		uint8(*msgType),
-		uint8(*msgVer),
-		uint16(*msgLen),
-		uint8(*msgAC),
+		headerFromFlags(*msgType, *msgVer, *msgLen, *msgAC),
 		attrStringFlags,
 	)
 	if err != nil {
@@ -233,9 +313,22 @@ func main() {
 		},
 		RttGuess: time.Duration(*rttGuess) * time.Millisecond,
 		Vasili:   *vasili,
+		Bind:     bind,
 	}
 
-	result := communicate.Communicate(sendThis, nil)
+	var result communicate.SendResult
+	switch *collectorAddr {
+	case "":
+		result = communicate.Communicate(sendThis, nil)
+	default:
+		c, err := newCollector(*collectorAddr)
+		if err != nil {
+			log.Println(err)
+			os.Exit(3)
+		}
+		result = communicate.CommunicateVia(sendThis, c, nil)
+		c.Close()
+	}
 	if result.Err != nil {
 		log.Println(result.Err)
 		os.Exit(3)
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// duration is a time.Duration which reads and writes strings
+// like "250ms" in spec files.
+type duration time.Duration
+
+func (o duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(o).String())
+}
+
+func (o *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	return o.set(s)
+}
+
+func (o duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(o).String(), nil
+}
+
+func (o *duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	err := unmarshal(&s)
+	if err != nil {
+		return err
+	}
+	return o.set(s)
+}
+
+func (o *duration) set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*o = duration(d)
+	return nil
+}
+
+// msgHeader holds optional overrides for the calculated message header.
+type msgHeader struct {
+	Type      *uint8  `json:"type,omitempty" yaml:"type,omitempty"`
+	Version   *uint8  `json:"version,omitempty" yaml:"version,omitempty"`
+	Length    *uint16 `json:"length,omitempty" yaml:"length,omitempty"`
+	AttrCount *uint8  `json:"attr_count,omitempty" yaml:"attr_count,omitempty"`
+}
+
+// msgSpec describes one message to be sent, and after the run, the reply.
+type msgSpec struct {
+	Name         string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Target       string   `json:"target,omitempty" yaml:"target,omitempty"`
+	Delay        duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	msgHeader    `yaml:",inline"`
+	Attributes   []string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	ExpectStatus string   `json:"expect_status,omitempty" yaml:"expect_status,omitempty"`
+
+	// These fields are filled in by run().
+	ReplyFrom string          `json:"reply_from,omitempty" yaml:"reply_from,omitempty"`
+	Rtt       duration        `json:"rtt,omitempty" yaml:"rtt,omitempty"`
+	Reply     *message.MsgDoc `json:"reply,omitempty" yaml:"reply,omitempty"`
+	ReplyHex  string          `json:"reply_hex,omitempty" yaml:"reply_hex,omitempty"`
+	Error     string          `json:"error,omitempty" yaml:"error,omitempty"`
+	Mismatch  string          `json:"mismatch,omitempty" yaml:"mismatch,omitempty"`
+}
+
+// spec is a sequence of messages, read from a JSON or YAML file. Target
+// and Rtt apply to every message which doesn't specify its own.
+type spec struct {
+	Target   string    `json:"target,omitempty" yaml:"target,omitempty"`
+	Rtt      duration  `json:"rtt,omitempty" yaml:"rtt,omitempty"`
+	Messages []msgSpec `json:"messages" yaml:"messages"`
+}
+
+// readSpec parses a spec file. YAML is a superset of JSON, so one
+// parser handles both formats.
+func readSpec(r io.Reader) (spec, error) {
+	var s spec
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return s, err
+	}
+	err = yaml.UnmarshalStrict(b, &s)
+	if err != nil {
+		return s, err
+	}
+	if len(s.Messages) == 0 {
+		return s, fmt.Errorf("spec contains no messages")
+	}
+	return s, nil
+}
+
+// writeSpec writes the spec (presumably with results filled in) as JSON
+// if the filename ends with ".json", YAML otherwise.
+func writeSpec(w io.Writer, s spec, filename string) error {
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// run sends each message in the spec in order, recording the results
+// alongside the message spec. It returns the number of messages which
+// produced errors and the number whose reply status didn't match.
+func (o *spec) run(defaultTarget string, rttGuess time.Duration, bind communicate.Bind) (int, int) {
+	if o.Rtt != 0 {
+		rttGuess = time.Duration(o.Rtt)
+	}
+
+	var errs, mismatches int
+	for i := range o.Messages {
+		ms := &o.Messages[i]
+
+		target := ms.Target
+		if target == "" {
+			target = o.Target
+		}
+		if target == "" {
+			target = defaultTarget
+		}
+
+		if ms.Delay > 0 {
+			time.Sleep(time.Duration(ms.Delay))
+		}
+
+		err := ms.send(target, rttGuess, bind)
+		if err != nil {
+			ms.Error = err.Error()
+			errs++
+			continue
+		}
+
+		ms.Mismatch = ms.checkStatus()
+		if ms.Mismatch != "" {
+			mismatches++
+		}
+	}
+	return errs, mismatches
+}
+
+// send builds and sends the message, recording the reply.
+func (o *msgSpec) send(target string, rttGuess time.Duration, bind communicate.Bind) error {
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return fmt.Errorf("cannot parse target address `%s'", target)
+	}
+
+	payload, err := buildMsgBytes(o.msgHeader, o.Attributes)
+	if err != nil {
+		return err
+	}
+
+	result := communicate.Communicate(communicate.SendThis{
+		Payload: payload,
+		Destination: &net.UDPAddr{
+			IP:   ip,
+			Port: communicate.CiscoL2TPort,
+		},
+		RttGuess: rttGuess,
+		Bind:     bind,
+	}, nil)
+	if result.Err != nil {
+		return result.Err
+	}
+
+	o.ReplyFrom = result.ReplyFrom.String()
+	o.Rtt = duration(result.Rtt)
+
+	reply, err := message.UnmarshalMessageUnsafe(result.ReplyData)
+	if err != nil {
+		o.ReplyHex = hex.EncodeToString(result.ReplyData)
+		return err
+	}
+	doc := message.NewMsgDoc(reply)
+	o.Reply = &doc
+
+	return nil
+}
+
+// checkStatus compares the reply status against ExpectStatus, which may
+// be a status string ("Success") or number ("7"). It returns a description
+// of the mismatch, or an empty string if there's nothing to complain about.
+func (o *msgSpec) checkStatus() string {
+	if o.ExpectStatus == "" {
+		return ""
+	}
+
+	var status attribute.Attribute
+	if o.Reply != nil {
+		reply, err := o.Reply.Msg()
+		if err == nil {
+			status = reply.GetAttr(attribute.ReplyStatusType)
+		}
+	}
+	if status == nil {
+		return fmt.Sprintf("expected reply status `%s', reply has no status", o.ExpectStatus)
+	}
+
+	if n, err := strconv.Atoi(o.ExpectStatus); err == nil {
+		if len(status.Bytes()) == 1 && int(status.Bytes()[0]) == n {
+			return ""
+		}
+	} else if strings.EqualFold(status.String(), o.ExpectStatus) {
+		return ""
+	}
+
+	return fmt.Sprintf("expected reply status `%s', got `%s'", o.ExpectStatus, status.String())
+}
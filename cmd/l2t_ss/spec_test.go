@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/chrismarget/cisco-l2t/message"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSpec = `
+target: 192.0.2.1
+rtt: 250ms
+messages:
+  - name: names
+    delay: 1s
+    attributes:
+      - 2:0004.f284.dbbf
+      - 1:00:50:56:98:e2:12
+      - 3:18
+      - 14:192.168.1.2
+  - name: hex
+    type: 2
+    version: 1
+    length: 31
+    attr_count: 4
+    attributes: [02080004f284dbbf, 010800505698e212, 03040012, 0e06c0a80102]
+    expect_status: Success
+`
+
+func TestReadSpec(t *testing.T) {
+	s, err := readSpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(s.Messages))
+	}
+	if time.Duration(s.Rtt) != 250*time.Millisecond {
+		t.Fatalf("expected rtt 250ms, got %s", time.Duration(s.Rtt))
+	}
+	if time.Duration(s.Messages[0].Delay) != time.Second {
+		t.Fatalf("expected delay 1s, got %s", time.Duration(s.Messages[0].Delay))
+	}
+
+	var results [][]byte
+	for _, ms := range s.Messages {
+		b, err := buildMsgBytes(ms.msgHeader, ms.Attributes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, b)
+	}
+
+	// the header type defaults differ, otherwise these are the same message
+	results[0][0] = 2
+	if !bytes.Equal(results[0], results[1]) {
+		t.Fatalf("expected matching messages, got %s and %s",
+			hex.EncodeToString(results[0]), hex.EncodeToString(results[1]))
+	}
+}
+
+func TestReadSpecEmpty(t *testing.T) {
+	_, err := readSpec(strings.NewReader("target: 192.0.2.1\n"))
+	if err == nil {
+		t.Fatal("spec without messages should produce an error")
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	reply, err := message.UnmarshalMessage([]byte{4, 1, 0, 8, 1, 15, 3, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := message.NewMsgDoc(reply)
+
+	for expect, ok := range map[string]bool{
+		"":                             true,
+		"7":                            true,
+		"source mac address not found": true,
+		"Success":                      false,
+		"1":                            false,
+	} {
+		ms := msgSpec{ExpectStatus: expect, Reply: &doc}
+		if (ms.checkStatus() == "") != ok {
+			t.Fatalf("expect_status `%s': got mismatch `%s'", expect, ms.checkStatus())
+		}
+	}
+
+	ms := msgSpec{ExpectStatus: "Success"}
+	if ms.checkStatus() == "" {
+		t.Fatal("missing reply should not match")
+	}
+}
+
+func TestWriteSpec(t *testing.T) {
+	s, err := readSpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Messages[0].Error = "timed out"
+
+	for _, name := range []string{"out.json", "out.yaml"} {
+		buf := &bytes.Buffer{}
+		err = writeSpec(buf, s, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := readSpec(buf)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if again.Messages[0].Error != "timed out" || *again.Messages[1].Length != 31 {
+			t.Fatalf("%s: results did not survive round trip", name)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package communicate
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// PortRange is a range of local UDP ports. The zero value means any
+// ephemeral port. It implements flag.Value, accepting "port" or "min-max".
+type PortRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func (o PortRange) String() string {
+	switch {
+	case o.Min == 0 && o.Max == 0:
+		return ""
+	case o.Min == o.Max:
+		return strconv.Itoa(o.Min)
+	}
+	return strconv.Itoa(o.Min) + "-" + strconv.Itoa(o.Max)
+}
+
+// Set parses a port or range of ports.
+func (o *PortRange) Set(s string) error {
+	parts := strings.SplitN(s, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return fmt.Errorf("bad port range `%s'", s)
+	}
+	max := min
+	if len(parts) == 2 {
+		max, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("bad port range `%s'", s)
+		}
+	}
+	if min < 1 || max > 65535 || min > max {
+		return fmt.Errorf("bad port range `%s'", s)
+	}
+	o.Min, o.Max = min, max
+	return nil
+}
+
+// ports returns the ports to try, in order: all of them, starting from a
+// random spot so that concurrent users of the range don't all fight over
+// its first port. The zero PortRange gets a single 0 (ephemeral port).
+func (o PortRange) ports() []int {
+	if o.Min == 0 && o.Max == 0 {
+		return []int{0}
+	}
+	n := o.Max - o.Min + 1
+	start := rand.Intn(n)
+	out := make([]int, n)
+	for i := range out {
+		out[i] = o.Min + (start+i)%n
+	}
+	return out
+}
+
+// Bind pins the local end of the sockets used to talk to switches. The
+// zero value leaves everything up to the operating system: the local
+// address comes from a route lookup, and the port is ephemeral.
+//
+// Sockets linger after Communicate() returns, waiting for replies to
+// retransmissions, and the target builder uses two sockets per address.
+// A port range needs room for several sockets per concurrent conversation,
+// and the builder refuses a range of just one port.
+type Bind struct {
+	Ip        net.IP    `json:"ip,omitempty"`        // local address
+	Interface string    `json:"interface,omitempty"` // SO_BINDTODEVICE, Linux only
+	Ports     PortRange `json:"ports"`               // source port range
+
+	// Advertise, if set, is named as the source address in queries
+	// instead of the local address. Use it when we're behind NAT: it's
+	// the public address which the switch can reply to.
+	Advertise net.IP `json:"advertise,omitempty"`
+}
+
+// IsZero returns a boolean indicating whether nothing is pinned.
+func (o Bind) IsZero() bool {
+	return o.Ip == nil && o.Interface == "" && o.Ports == PortRange{} && o.Advertise == nil
+}
+
+// Nat returns a boolean indicating whether we're advertising an address
+// other than our own.
+func (o Bind) Nat() bool {
+	return o.Advertise != nil
+}
+
+// SrcIp returns the address queries sent from local should name as their
+// source: the advertised address, if there is one, otherwise local.
+func (o Bind) SrcIp(local net.IP) net.IP {
+	if o.Advertise != nil {
+		return o.Advertise
+	}
+	return local
+}
+
+// AddFlags registers -bind-ip, -bind-if, -bind-ports and -advertise-ip
+// with fs.
+func (o *Bind) AddFlags(fs *flag.FlagSet) {
+	fs.Var((*ipValue)(&o.Ip), "bind-ip", "local address for talking to switches")
+	fs.StringVar(&o.Interface, "bind-if", "", "local interface for talking to switches (Linux only)")
+	fs.Var(&o.Ports, "bind-ports", "local UDP port or range of ports (min-max) for talking to switches")
+	fs.Var((*ipValue)(&o.Advertise), "advertise-ip", "address switches should reply to, when it's not ours (NAT)")
+}
+
+// LocalIp returns the local address to use when talking to destination:
+// the pinned address, if there is one, or an address of the pinned
+// interface, or the result of a route lookup.
+func (o Bind) LocalIp(destination net.IP) (net.IP, error) {
+	family := UdpProtocolFor(destination)
+	switch {
+	case o.Ip != nil:
+		if UdpProtocolFor(o.Ip) != family {
+			return nil, fmt.Errorf("%w: local address %s can't talk to %s", ErrBind, o.Ip, destination)
+		}
+		return o.Ip, nil
+	case o.Interface != "":
+		return interfaceIp(o.Interface, family)
+	}
+	return GetOutgoingIpForDestination(destination)
+}
+
+// interfaceIp returns an address of the named interface suitable for use
+// with the network family (UdpProtocol or UdpProtocol6). Link-local
+// addresses are used only if there's nothing else.
+func interfaceIp(name string, family string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBind, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBind, err)
+	}
+
+	var linkLocal net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || UdpProtocolFor(ipNet.IP) != family {
+			continue
+		}
+		if ipNet.IP.IsLinkLocalUnicast() {
+			if linkLocal == nil {
+				linkLocal = ipNet.IP
+			}
+			continue
+		}
+		return ipNet.IP, nil
+	}
+	if linkLocal != nil {
+		return linkLocal, nil
+	}
+	return nil, fmt.Errorf("%w: interface %s has no %s address", ErrBind, name, family)
+}
+
+// control returns the function used to configure sockets before they're
+// bound, or nil if there's nothing to do.
+func (o Bind) control() func(string, string, syscall.RawConn) error {
+	if o.Interface == "" {
+		return nil
+	}
+	return func(_ string, _ string, c syscall.RawConn) error {
+		return bindToDevice(c, o.Interface)
+	}
+}
+
+// listen returns a "non-connected" socket bound to local and one of the
+// pinned ports.
+func (o Bind) listen(local net.IP) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: o.control()}
+	return o.tryPorts(func(port int) (net.Conn, error) {
+		addr := &net.UDPAddr{IP: local, Port: port}
+		pc, err := lc.ListenPacket(context.Background(), UdpProtocolFor(local), addr.String())
+		if err != nil {
+			return nil, err
+		}
+		return pc.(*net.UDPConn), nil
+	})
+}
+
+// dial returns a "connected" socket bound to local and one of the pinned
+// ports.
+func (o Bind) dial(local net.IP, remote *net.UDPAddr) (*net.UDPConn, error) {
+	return o.tryPorts(func(port int) (net.Conn, error) {
+		d := net.Dialer{
+			LocalAddr: &net.UDPAddr{IP: local, Port: port},
+			Control:   o.control(),
+		}
+		return d.Dial(UdpProtocolFor(local), remote.String())
+	})
+}
+
+// tryPorts calls f with each pinned port until one isn't in use.
+func (o Bind) tryPorts(f func(int) (net.Conn, error)) (*net.UDPConn, error) {
+	for _, port := range o.Ports.ports() {
+		c, err := f(port)
+		if errors.Is(err, syscall.EADDRINUSE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return c.(*net.UDPConn), nil
+	}
+	return nil, fmt.Errorf("%w: no free port in range %s", ErrBind, o.Ports)
+}
+
+// ipValue adapts a net.IP to flag.Value.
+type ipValue net.IP
+
+func (o *ipValue) String() string {
+	if o == nil || *o == nil {
+		return ""
+	}
+	return net.IP(*o).String()
+}
+
+func (o *ipValue) Set(s string) error {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return fmt.Errorf("cannot parse `%s' as an IP address", s)
+	}
+	*o = ipValue(ip)
+	return nil
+}
@@ -0,0 +1,21 @@
+package communicate
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDevice restricts the socket to the named interface.
+func bindToDevice(c syscall.RawConn, name string) error {
+	var err error
+	cErr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+	})
+	if cErr != nil {
+		return cErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: binding to interface %s: %s", ErrBind, name, err)
+	}
+	return nil
+}
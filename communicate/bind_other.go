@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package communicate
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDevice restricts the socket to the named interface, which only
+// works on Linux.
+func bindToDevice(_ syscall.RawConn, name string) error {
+	return fmt.Errorf("%w: binding to interface %s is only supported on linux", ErrBind, name)
+}
@@ -0,0 +1,184 @@
+package communicate
+
+import (
+	"errors"
+	"flag"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPortRange(t *testing.T) {
+	var pr PortRange
+	for _, bad := range []string{"", "x", "0", "10-5", "1-65536", "1-x"} {
+		if pr.Set(bad) == nil {
+			t.Fatalf("%q should not parse", bad)
+		}
+	}
+
+	err := pr.Set("4000-4003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.String() != "4000-4003" {
+		t.Fatalf("unexpected string %s", pr.String())
+	}
+
+	seen := make(map[int]bool)
+	for _, p := range pr.ports() {
+		if p < 4000 || p > 4003 || seen[p] {
+			t.Fatalf("unexpected port list %v", pr.ports())
+		}
+		seen[p] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected 4 ports, got %v", pr.ports())
+	}
+
+	if ports := (PortRange{}).ports(); len(ports) != 1 || ports[0] != 0 {
+		t.Fatalf("zero PortRange should mean an ephemeral port, got %v", ports)
+	}
+}
+
+func TestBindFlags(t *testing.T) {
+	var b Bind
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	b.AddFlags(fs)
+	err := fs.Parse([]string{"-bind-ip", "192.0.2.1", "-bind-if", "eth9", "-bind-ports", "5000-5010"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Ip.Equal(net.ParseIP("192.0.2.1")) || b.Interface != "eth9" || b.Ports != (PortRange{Min: 5000, Max: 5010}) {
+		t.Fatalf("unexpected Bind: %+v", b)
+	}
+	if b.IsZero() || !(Bind{}).IsZero() {
+		t.Fatal("IsZero is wrong")
+	}
+}
+
+func TestBindLocalIp(t *testing.T) {
+	b := Bind{Ip: net.ParseIP("127.0.0.1")}
+	ip, err := b.LocalIp(net.ParseIP("192.0.2.1"))
+	if err != nil || !ip.Equal(b.Ip) {
+		t.Fatalf("expected %s, got %s (%v)", b.Ip, ip, err)
+	}
+
+	_, err = b.LocalIp(net.ParseIP("2001:db8::1"))
+	if !errors.Is(err, ErrBind) {
+		t.Fatalf("expected ErrBind, got %v", err)
+	}
+
+	_, err = Bind{Interface: "no-such-interface"}.LocalIp(net.ParseIP("192.0.2.1"))
+	if !errors.Is(err, ErrBind) {
+		t.Fatalf("expected ErrBind, got %v", err)
+	}
+}
+
+// sourcePortServer answers one datagram with the source port it came from.
+func sourcePortServer(t *testing.T) *net.UDPAddr {
+	cxn, err := net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer cxn.Close()
+		_ = cxn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		buf := make([]byte, 1500)
+		_, from, err := cxn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		_, _ = cxn.WriteToUDP([]byte(from.String()), from)
+	}()
+	return cxn.LocalAddr().(*net.UDPAddr)
+}
+
+// freePort returns a UDP port which nobody is using right now.
+func freePort(t *testing.T) int {
+	cxn, err := net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cxn.Close()
+	return cxn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestCommunicateBind(t *testing.T) {
+	// connected socket, then listener socket
+	for _, connected := range []bool{true, false} {
+		server := sourcePortServer(t)
+		port := freePort(t)
+		out := SendThis{
+			Payload:     []byte("hello"),
+			Destination: server,
+			MaxWait:     time.Second,
+			Bind: Bind{
+				Ip:    net.ParseIP("127.0.0.1"),
+				Ports: PortRange{Min: port, Max: port},
+			},
+		}
+		if connected {
+			out.ExpectReplyFrom = server.IP
+		}
+		result := Communicate(out, nil)
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		expected := (&net.UDPAddr{IP: out.Bind.Ip, Port: port}).String()
+		if string(result.ReplyData) != expected {
+			t.Fatalf("expected query from %s, server saw %s", expected, result.ReplyData)
+		}
+	}
+}
+
+func TestCommunicateBindPortsInUse(t *testing.T) {
+	busy, err := net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := busy.LocalAddr().(*net.UDPAddr).Port
+
+	result := Communicate(SendThis{
+		Payload:     []byte("hello"),
+		Destination: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: CiscoL2TPort},
+		Bind: Bind{
+			Ip:    net.ParseIP("127.0.0.1"),
+			Ports: PortRange{Min: port, Max: port},
+		},
+	}, nil)
+	if !errors.Is(result.Err, ErrBind) {
+		t.Fatalf("expected ErrBind, got %v", result.Err)
+	}
+}
+
+func TestCommunicateBindInterface(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lo string
+	for _, i := range ifaces {
+		if i.Flags&net.FlagLoopback != 0 {
+			lo = i.Name
+		}
+	}
+	if lo == "" {
+		t.Skip("no loopback interface")
+	}
+
+	server := sourcePortServer(t)
+	result := Communicate(SendThis{
+		Payload:         []byte("hello"),
+		Destination:     server,
+		ExpectReplyFrom: server.IP,
+		MaxWait:         time.Second,
+		Bind:            Bind{Interface: lo},
+	}, nil)
+	if errors.Is(result.Err, ErrBind) {
+		t.Skipf("cannot bind to %s: %s", lo, result.Err)
+	}
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+}
@@ -0,0 +1,227 @@
+package communicate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrCollectorClosed is returned when waiting on a Collector which has been
+// closed.
+var ErrCollectorClosed = errors.New("collector closed")
+
+// Collector receives replies which switches send to a third-party address.
+// L2T queries carry a source IP attribute, and switches reply to that
+// address rather than to the query's source. A Collector listens on that
+// address (another local address, a loopback alias...) and hands each
+// reply to the outstanding query it answers.
+//
+// Replies don't identify the query they answer, so they're matched by the
+// address they come from: each reply goes to the oldest outstanding query
+// expecting a reply from that address. Keep one query outstanding per
+// switch for unambiguous results.
+type Collector struct {
+	listener *Listener
+	lock     sync.Mutex // protects pending, closed and strays
+	pending  []*pendingReply
+	closed   bool
+	strays   int
+}
+
+type pendingReply struct {
+	sources []net.IP
+	result  chan Record // buffered, receives at most one reply
+}
+
+// NewCollector returns a Collector listening on addr.
+func NewCollector(addr *net.UDPAddr) (*Collector, error) {
+	o := &Collector{}
+	listener, err := Listen(addr, o.deliver)
+	if err != nil {
+		return nil, err
+	}
+	o.listener = listener
+	return o, nil
+}
+
+// Addr returns the address the Collector is listening on.
+func (o *Collector) Addr() *net.UDPAddr {
+	return o.listener.Addr()
+}
+
+// Strays returns the number of datagrams which arrived at the Collector
+// without a matching outstanding query.
+func (o *Collector) Strays() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.strays
+}
+
+// Close stops the Collector. Outstanding queries give up immediately.
+func (o *Collector) Close() error {
+	o.lock.Lock()
+	o.closed = true
+	for _, p := range o.pending {
+		close(p.result)
+	}
+	o.pending = nil
+	o.lock.Unlock()
+	return o.listener.Close()
+}
+
+// expect registers interest in a reply from any of the sources.
+func (o *Collector) expect(sources []net.IP) (*pendingReply, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.closed {
+		return nil, ErrCollectorClosed
+	}
+	p := &pendingReply{
+		sources: sources,
+		result:  make(chan Record, 1),
+	}
+	o.pending = append(o.pending, p)
+	return p, nil
+}
+
+// forget withdraws interest in a reply.
+func (o *Collector) forget(p *pendingReply) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i := range o.pending {
+		if o.pending[i] == p {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// deliver hands a reply to the oldest query expecting it.
+func (o *Collector) deliver(r Record) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i, p := range o.pending {
+		for _, s := range p.sources {
+			if s.Equal(r.From.IP) {
+				p.result <- r
+				o.pending = append(o.pending[:i], o.pending[i+1:]...)
+				return
+			}
+		}
+	}
+	o.strays++
+}
+
+// CommunicateVia is like Communicate, except that the reply is expected at
+// the Collector rather than at the socket the query was sent from. The
+// payload should name the Collector's IP in its source IP attribute.
+//
+// The query is sent from the local address best suited for the
+// destination, using the Collector's port number as the source port, so
+// replies addressed to either the query's source port or the well-known
+// port (when the Collector listens there) reach the Collector.
+//
+// Replies are accepted from SendThis.Destination.IP and, if they're set,
+// from SendThis.ExpectReplyFrom and SendThis.AcceptFrom. SendThis.Late is closed without being used:
+// replies arriving after the first one are counted as Collector strays.
+func CommunicateVia(out SendThis, c *Collector, quit chan struct{}) SendResult {
+	if out.Late != nil {
+		defer close(out.Late)
+	}
+
+	ourIp, err := out.Bind.LocalIp(out.Destination.IP)
+	if err != nil {
+		return SendResult{Err: newSendError(out.Destination, err)}
+	}
+
+	collectorPort := out.Bind
+	collectorPort.Ports = PortRange{Min: c.Addr().Port, Max: c.Addr().Port}
+	cxn, err := collectorPort.listen(ourIp)
+	if err != nil {
+		// port in use here? any port will do if the switch replies to
+		// the well-known port.
+		cxn, err = out.Bind.listen(ourIp)
+		if err != nil {
+			return SendResult{Err: newSendError(out.Destination, err)}
+		}
+	}
+	defer cxn.Close()
+
+	sources := []net.IP{out.Destination.IP}
+	if out.ExpectReplyFrom != nil && !out.ExpectReplyFrom.Equal(out.Destination.IP) {
+		sources = append(sources, out.ExpectReplyFrom)
+	}
+	sources = append(sources, out.AcceptFrom...)
+	pending, err := c.expect(sources)
+	if err != nil {
+		return SendResult{Err: newSendError(out.Destination, err)}
+	}
+	defer c.forget(pending)
+
+	wait := MaxRTT
+	if out.MaxWait > 0 {
+		wait = out.MaxWait
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	var bot *BackoffTicker
+	if out.RttGuess > time.Millisecond {
+		bot = NewBackoffTicker(out.RttGuess)
+	} else {
+		bot = NewBackoffTicker(InitialRTTGuess)
+	}
+	defer bot.Stop()
+
+	start := time.Now()
+	var sent []time.Time
+	var attempts int
+	var aborted bool
+	for {
+		select {
+		case <-bot.C:
+			if !out.Vasili || attempts == 0 {
+				err := transmit(cxn, out.Destination, out.Payload)
+				if err != nil {
+					return SendResult{Err: newSendError(out.Destination, err), Sent: sent}
+				}
+				sent = append(sent, time.Now())
+				attempts++
+			}
+		case r, ok := <-pending.result:
+			if !ok {
+				return SendResult{Attempts: attempts, Err: newSendError(out.Destination, ErrCollectorClosed), Sent: sent}
+			}
+			return SendResult{
+				Attempts:  attempts,
+				Rtt:       time.Now().Sub(start),
+				SentTo:    out.Destination.IP,
+				SentFrom:  ourIp,
+				ReplyFrom: r.From.IP,
+				ReplyData: r.Data,
+				Sent:      sent,
+				Answered:  likelyAnswered(sent, nil, r.Received, out.RttGuess),
+			}
+		case <-quit:
+			aborted = true
+			quit = nil
+			deadline.Reset(0)
+		case <-deadline.C:
+			return SendResult{
+				Attempts: attempts,
+				Aborted:  aborted,
+				SentTo:   out.Destination.IP,
+				SentFrom: ourIp,
+				Sent:     sent,
+				Answered: -1,
+				Err: &SendError{
+					Destination: out.Destination,
+					Kind:        ErrTimeout,
+					Err:         fmt.Errorf("%w at collector %s", ErrTimeout, c.Addr()),
+				},
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package communicate
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSwitch answers each datagram by echoing it, with a 'R' prefix, to
+// the collector IP at the query's source port. It returns the switch's
+// address.
+func fakeSwitch(t *testing.T, ip string, collectorIp net.IP) *net.UDPAddr {
+	cxn, err := net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: net.ParseIP(ip)})
+	if err != nil {
+		t.Skipf("cannot listen on %s (loopback alias missing?): %s", ip, err)
+	}
+	go func() {
+		defer cxn.Close()
+		buf := make([]byte, 1500)
+		_ = cxn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			n, from, err := cxn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			reply := append([]byte{'R'}, buf[:n]...)
+			_, _ = cxn.WriteToUDP(reply, &net.UDPAddr{IP: collectorIp, Port: from.Port})
+		}
+	}()
+	return cxn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestCommunicateVia(t *testing.T) {
+	c, err := NewCollector(&net.UDPAddr{IP: net.ParseIP("127.0.0.3")})
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.3 (loopback alias missing?): %s", err)
+	}
+	defer c.Close()
+
+	sw := fakeSwitch(t, "127.0.0.2", c.Addr().IP)
+	result := CommunicateVia(SendThis{
+		Payload:     []byte("hello"),
+		Destination: sw,
+		MaxWait:     time.Second,
+	}, c, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if !bytes.Equal(result.ReplyData, []byte("Rhello")) {
+		t.Fatalf("unexpected reply `%s'", result.ReplyData)
+	}
+	if !result.ReplyFrom.Equal(sw.IP) {
+		t.Fatalf("expected reply from %s, got %s", sw.IP, result.ReplyFrom)
+	}
+}
+
+func TestCommunicateViaTimeout(t *testing.T) {
+	c, err := NewCollector(&net.UDPAddr{IP: net.ParseIP("127.0.0.3")})
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.3 (loopback alias missing?): %s", err)
+	}
+	defer c.Close()
+
+	// nobody home
+	silent, err := net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: net.ParseIP("127.0.0.2")})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer silent.Close()
+
+	result := CommunicateVia(SendThis{
+		Payload:     []byte("hello"),
+		Destination: silent.LocalAddr().(*net.UDPAddr),
+		MaxWait:     300 * time.Millisecond,
+	}, c, nil)
+	if !errors.Is(result.Err, ErrTimeout) {
+		t.Fatalf("expected timeout, got %v", result.Err)
+	}
+	if ne, ok := result.Err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatal("timeout should be a net.Error with Timeout() true")
+	}
+}
+
+func TestCollectorDeliver(t *testing.T) {
+	c, err := NewCollector(&net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := net.ParseIP("192.0.2.1")
+	b := net.ParseIP("192.0.2.2")
+	first, _ := c.expect([]net.IP{a})
+	second, _ := c.expect([]net.IP{a, b})
+
+	c.deliver(Record{From: &net.UDPAddr{IP: b}, Data: []byte("1")})
+	c.deliver(Record{From: &net.UDPAddr{IP: a}, Data: []byte("2")})
+	c.deliver(Record{From: &net.UDPAddr{IP: a}, Data: []byte("3")})
+
+	if r := <-first.result; string(r.Data) != "2" {
+		t.Fatalf("first query got reply `%s'", r.Data)
+	}
+	if r := <-second.result; string(r.Data) != "1" {
+		t.Fatalf("second query got reply `%s'", r.Data)
+	}
+	if c.Strays() != 1 {
+		t.Fatalf("expected 1 stray, got %d", c.Strays())
+	}
+
+	pending, _ := c.expect([]net.IP{a})
+	c.Close()
+	if _, ok := <-pending.result; ok {
+		t.Fatal("closing the collector should release outstanding queries")
+	}
+	if _, err := c.expect([]net.IP{a}); !errors.Is(err, ErrCollectorClosed) {
+		t.Fatalf("expected ErrCollectorClosed, got %v", err)
+	}
+}
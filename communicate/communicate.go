@@ -3,7 +3,6 @@ package communicate
 import (
 	"fmt"
 	"net"
-	"strconv"
 	"time"
 )
 
@@ -12,6 +11,7 @@ const (
 	InitialRTTGuess = 250 * time.Millisecond
 	MaxRTT          = 2500 * time.Millisecond
 	UdpProtocol     = "udp4"
+	UdpProtocol6    = "udp6"
 	CiscoL2TPort    = 2228
 )
 
@@ -23,14 +23,30 @@ type SendResult struct {
 	SentTo    net.IP // the address we tried talking to
 	SentFrom  net.IP // our IP address
 	ReplyFrom net.IP // the address they replied from
+	ReplyTo   net.IP // the address their reply was sent to, if known
 	ReplyData []byte
+	Sent      []time.Time // when each transmission went out
+	Answered  int         // index into Sent of the transmission the reply likely answered, if there was a reply
+}
+
+// Reply describes a reply received after Communicate() has returned: a
+// reply to a retransmission, a duplicate, or a reply which arrived after
+// we'd given up.
+type Reply struct {
+	From     net.IP
+	Data     []byte
+	Received time.Time
+	Answered int           // index into SendResult.Sent of the transmission it likely answered
+	Rtt      time.Duration // time since that transmission
 }
 
 type receiveResult struct {
 	err error
 	//	Rtt       time.Duration
 	replyFrom net.IP // the address they replied from
+	replyTo   net.IP // the address their reply was sent to, if known
 	replyData []byte
+	received  time.Time
 }
 
 // temporaryErr returns a boolean indicating whether the receiveResult has an error
@@ -62,12 +78,41 @@ type SendThis struct {
 	RttGuess        time.Duration
 	Vasili          bool // one ping only
 	MaxWait         time.Duration
+	Bind            Bind // pins our address, interface and port
+
+	// AcceptFrom lists more addresses from which replies are accepted,
+	// for switches which might reply from any of several addresses
+	// (through NAT, for example). Setting it forces the use of a
+	// "non-connected" socket.
+	AcceptFrom []net.IP
+
+	// ListenAny has a "non-connected" socket listen on all of our
+	// addresses rather than just one, and report which of them the reply
+	// was sent to (Linux only). It's ignored when Bind pins the local
+	// address.
+	ListenAny bool
+
+	// Late, if not nil, receives a Reply for each reply (including
+	// duplicates) which arrives after Communicate() returns, until
+	// MaxWait runs out. It's closed when Communicate() stops listening,
+	// and must be drained.
+	Late chan<- Reply
+}
+
+// UdpProtocolFor returns the network name (UdpProtocol or UdpProtocol6)
+// for talking to the specified address. IPv4-mapped IPv6 addresses, and
+// nil, get UdpProtocol.
+func UdpProtocolFor(ip net.IP) string {
+	if ip == nil || ip.To4() != nil {
+		return UdpProtocol
+	}
+	return UdpProtocol6
 }
 
 // GetOutgoingIpForDestination returns a net.IP representing the local interface
 // that's best suited for talking to the passed target address
 func GetOutgoingIpForDestination(t net.IP) (net.IP, error) {
-	c, err := net.Dial("udp4", t.String()+":1")
+	c, err := net.Dial(UdpProtocolFor(t), net.JoinHostPort(t.String(), "1"))
 	if err != nil {
 		return nil, err
 	}
@@ -75,33 +120,58 @@ func GetOutgoingIpForDestination(t net.IP) (net.IP, error) {
 	return c.LocalAddr().(*net.UDPAddr).IP, c.Close()
 }
 
+// unspecified returns the unspecified ("any") address of ip's family.
+func unspecified(ip net.IP) net.IP {
+	if UdpProtocolFor(ip) == UdpProtocol {
+		return net.IPv4zero
+	}
+	return net.IPv6unspecified
+}
+
 // getRemote returns the remote *net.UDPAddr associated with a
 // connected UDP socket.
 func getRemote(in net.UDPConn) (*net.UDPAddr, error) {
 	if in.RemoteAddr() == nil {
 		// not a connected socket - un-answerable question
-		return nil, fmt.Errorf("un-connected socket doesn't have a remote address")
+		return nil, fmt.Errorf("%w: un-connected socket doesn't have a remote address", ErrNotConnected)
 	}
 
-	hostString, portString, err := net.SplitHostPort(in.RemoteAddr().String())
-	if err != nil {
-		return &net.UDPAddr{}, err
+	// a *net.UDPAddr keeps the IPv6 zone, which doesn't survive the
+	// round trip through a string
+	remote, ok := in.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return &net.UDPAddr{}, fmt.Errorf("unexpected remote address type %T", in.RemoteAddr())
 	}
 
-	IP := net.ParseIP(hostString)
-	if IP == nil {
-		return &net.UDPAddr{}, fmt.Errorf("could not parse host: %s", hostString)
-	}
+	return &net.UDPAddr{
+		IP:   remote.IP,
+		Port: remote.Port,
+		Zone: remote.Zone,
+	}, nil
+}
 
-	port, err := strconv.Atoi(portString)
-	if err != nil {
-		return &net.UDPAddr{}, err
+// replySources returns the addresses from which replies are acceptable,
+// or nil if replies from anywhere will do.
+func (o SendThis) replySources() []net.IP {
+	var out []net.IP
+	if o.ExpectReplyFrom != nil {
+		out = append(out, o.ExpectReplyFrom)
 	}
+	return append(out, o.AcceptFrom...)
+}
 
-	return &net.UDPAddr{
-		IP:   IP,
-		Port: port,
-	}, nil
+// fromAny returns a boolean indicating whether ip is one of sources. Every
+// ip matches an empty list of sources.
+func fromAny(sources []net.IP, ip net.IP) bool {
+	if len(sources) == 0 {
+		return true
+	}
+	for _, s := range sources {
+		if s.Equal(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 // receiveOneMsg loops until a "good" inbound message arrives on the socket,
@@ -109,6 +179,16 @@ func getRemote(in net.UDPConn) (*net.UDPAddr, error) {
 // expectedSource) unless expectedSource is <nil>. It is guaranteed to
 // write to the result channel exactly once.
 func receiveOneMsg(cxn *net.UDPConn, expectedSource net.IP, result chan<- receiveResult) {
+	var sources []net.IP
+	if expectedSource != nil {
+		sources = append(sources, expectedSource)
+	}
+	receiveFromAny(cxn, sources, result)
+}
+
+// receiveFromAny is receiveOneMsg with a list of acceptable sources. An
+// empty list accepts replies from anywhere.
+func receiveFromAny(cxn *net.UDPConn, sources []net.IP, result chan<- receiveResult) {
 	buffIn := make([]byte, inBufferSize)
 	var err error
 	var received int
@@ -126,6 +206,14 @@ func receiveOneMsg(cxn *net.UDPConn, expectedSource net.IP, result chan<- receiv
 		}
 	}
 
+	// the socket's own address is where replies went, unless it's
+	// listening on all of them, in which case we hope the kernel says.
+	var replyTo net.IP
+	oob := make([]byte, 128)
+	if local := cxn.LocalAddr().(*net.UDPAddr).IP; !local.IsUnspecified() {
+		replyTo = local
+	}
+
 	// read until we have some data to return.
 	for received == 0 {
 		// read from the socket using the appropriate call
@@ -133,7 +221,11 @@ func receiveOneMsg(cxn *net.UDPConn, expectedSource net.IP, result chan<- receiv
 		case true:
 			received, err = cxn.Read(buffIn)
 		case false:
-			received, respondent, err = cxn.ReadFromUDP(buffIn)
+			var oobn int
+			received, oobn, _, respondent, err = cxn.ReadMsgUDP(buffIn, oob)
+			if dst := pktDst(oob[:oobn]); dst != nil {
+				replyTo = dst
+			}
 		}
 
 		switch {
@@ -141,9 +233,9 @@ func receiveOneMsg(cxn *net.UDPConn, expectedSource net.IP, result chan<- receiv
 			result <- receiveResult{err: err}
 			return
 		case received >= len(buffIn): // Unexpectedly large read
-			result <- receiveResult{err: fmt.Errorf("got full buffer: %d bytes", len(buffIn))}
+			result <- receiveResult{err: fmt.Errorf("%w: got %d bytes", ErrBufferFull, len(buffIn))}
 			return
-		case expectedSource != nil && !expectedSource.Equal(respondent.IP):
+		case !fromAny(sources, respondent.IP):
 			// Alien reply. Ignore.
 			received = 0
 		}
@@ -151,7 +243,9 @@ func receiveOneMsg(cxn *net.UDPConn, expectedSource net.IP, result chan<- receiv
 
 	result <- receiveResult{
 		replyFrom: respondent.IP,
+		replyTo:   replyTo,
 		replyData: buffIn[:received],
+		received:  time.Now(),
 	}
 }
 
@@ -174,9 +268,9 @@ func transmit(cxn *net.UDPConn, destination *net.UDPAddr, payload []byte) error
 	case err != nil:
 		return err
 	case n < pLen:
-		return fmt.Errorf("short write to socket, only manged %d of %d bytes", n, pLen)
+		return fmt.Errorf("%w, only manged %d of %d bytes", ErrShortWrite, n, pLen)
 	case n > pLen:
-		return fmt.Errorf("long write to socket, only wanted %d bytes, wrote %d bytes", pLen, n)
+		return fmt.Errorf("%w, only wanted %d bytes, wrote %d bytes", ErrLongWrite, pLen, n)
 	}
 	return nil
 }
@@ -187,7 +281,9 @@ func transmit(cxn *net.UDPConn, destination *net.UDPAddr, payload []byte) error
 //
 // If SendThis.ExpectReplyFrom is populated and matches
 // SendThis.Destination.IP, then a "connected" UDP socket (which can respond to
-// incoming ICMP unreachables) is used.
+// incoming ICMP unreachables) is used. ICMP port unreachable ends the
+// exchange early with an error satisfying errors.Is(err, ErrRefused). Host
+// and network unreachables produce ErrUnreachable.
 //
 // If SendThis.ExpectReplyFrom is populated and doesn't match
 // SendThis.Destination.IP, then a "non-connected" (listener) UDP socket is
@@ -198,34 +294,60 @@ func transmit(cxn *net.UDPConn, destination *net.UDPAddr, payload []byte) error
 // socket is used and incoming datagrams from any source are considered valid
 // replies.
 //
+// Populating SendThis.AcceptFrom also selects a "non-connected" socket.
+// Replies from any of those addresses, or from SendThis.ExpectReplyFrom,
+// are considered.
+//
 // Close the quit channel to abort the operation. This channel can be nil if
 // no need to abort. The operation is aborted by setting the receive timeout
 // to "now". This has a side-effect of returning a timeout error on abort via
 // the quit channel.
 func Communicate(out SendThis, quit chan struct{}) SendResult {
+	// the Late channel gets closed here, unless we get as far as handing
+	// it off to closeListenerAfterNReplies
+	var lateHandedOff bool
+	if out.Late != nil {
+		defer func() {
+			if !lateHandedOff {
+				close(out.Late)
+			}
+		}()
+	}
+
 	// determine the local interface IP
-	ourIp, err := GetOutgoingIpForDestination(out.Destination.IP)
+	ourIp, err := out.Bind.LocalIp(out.Destination.IP)
 	if err != nil {
-		return SendResult{Err: err}
+		return SendResult{Err: newSendError(out.Destination, err)}
 	}
 
 	// create the socket
 	var cxn *net.UDPConn
-	switch out.Destination.IP.Equal(out.ExpectReplyFrom) {
+	switch out.Destination.IP.Equal(out.ExpectReplyFrom) && len(out.AcceptFrom) == 0 {
 	case true:
-		cxn, err = net.DialUDP(UdpProtocol, &net.UDPAddr{IP: ourIp}, out.Destination)
+		cxn, err = out.Bind.dial(ourIp, out.Destination)
 		if err != nil {
-			return SendResult{Err: err}
+			return SendResult{Err: newSendError(out.Destination, err)}
 		}
 	case false:
-		cxn, err = net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: ourIp})
+		listenIp := ourIp
+		if out.ListenAny && out.Bind.Ip == nil {
+			listenIp = unspecified(ourIp)
+		}
+		cxn, err = out.Bind.listen(listenIp)
 		if err != nil {
-			return SendResult{Err: err}
+			return SendResult{Err: newSendError(out.Destination, err)}
+		}
+		if out.ListenAny {
+			err = setPktInfo(cxn)
+			if err != nil {
+				_ = cxn.Close()
+				return SendResult{Err: newSendError(out.Destination, err)}
+			}
 		}
 	}
 
 	replyChan := make(chan receiveResult, 1)
-	go receiveOneMsg(cxn, out.ExpectReplyFrom, replyChan)
+	go receiveFromAny(cxn, out.replySources(), replyChan)
 
 	// socket timeout stuff
 	var rtt time.Duration
@@ -238,12 +360,28 @@ func Communicate(out SendThis, quit chan struct{}) SendResult {
 	end := start.Add(rtt)
 	err = cxn.SetReadDeadline(end)
 	if err != nil {
-		return SendResult{Err: err}
+		return SendResult{Err: newSendError(out.Destination, err)}
 	}
 
 	var outstandingMsgs int
+	var sent []time.Time
+	answered := -1
 	defer func() {
-		go closeListenerAfterNReplies(cxn, outstandingMsgs, end)
+		var late *lateReplies
+		if out.Late != nil {
+			late = &lateReplies{
+				out:      out.Late,
+				sent:     sent,
+				claimed:  make([]bool, len(sent)),
+				rttGuess: out.RttGuess,
+				sources:  out.replySources(),
+			}
+			if answered >= 0 {
+				late.claimed[answered] = true
+			}
+			lateHandedOff = true
+		}
+		go closeListenerAfterNReplies(cxn, outstandingMsgs, end, late)
 	}()
 
 	// retransmit backoff timer tells us when to re-send. Use the supplied
@@ -267,8 +405,9 @@ func Communicate(out SendThis, quit chan struct{}) SendResult {
 			if !out.Vasili || outstandingMsgs == 0 {
 				err := transmit(cxn, out.Destination, out.Payload)
 				if err != nil {
-					return SendResult{Err: err}
+					return SendResult{Err: newSendError(out.Destination, err), Sent: sent}
 				}
+				sent = append(sent, time.Now())
 				outstandingMsgs++
 			}
 		case result := <-replyChan: // reply or timeout
@@ -276,14 +415,20 @@ func Communicate(out SendThis, quit chan struct{}) SendResult {
 				// decrement outstanding counter on inbound reply
 				outstandingMsgs--
 			}
+			if result.err == nil {
+				answered = likelyAnswered(sent, nil, result.received, out.RttGuess)
+			}
 			return SendResult{
 				Attempts:  outstandingMsgs + 1,
 				Aborted:   aborted,
-				Err:       result.err,
+				Err:       newSendError(out.Destination, result.err),
 				Rtt:       time.Now().Sub(start),
 				SentTo:    out.Destination.IP,
 				ReplyFrom: result.replyFrom,
+				ReplyTo:   result.replyTo,
 				ReplyData: result.replyData,
+				Sent:      sent,
+				Answered:  answered,
 			}
 		case <-quit: // abort
 			aborted = true
@@ -293,20 +438,67 @@ func Communicate(out SendThis, quit chan struct{}) SendResult {
 				// SetReadDeadline errored (unlikely). The return on abort
 				// happens on the next loop iteration via timeout error on
 				// replyChan.
-				return SendResult{Err: err}
+				return SendResult{Err: newSendError(out.Destination, err)}
+			}
+		}
+	}
+}
+
+// lateReplies describes where to report replies read by
+// closeListenerAfterNReplies, and how to work out what they answered.
+type lateReplies struct {
+	out      chan<- Reply
+	sent     []time.Time
+	claimed  []bool // transmissions which have been answered
+	rttGuess time.Duration
+	sources  []net.IP // acceptable reply sources, empty for any
+}
+
+// likelyAnswered returns the index of the transmission a reply received at
+// the specified time most likely answers, or -1 if nothing had been sent.
+// Transmissions which have already been claimed by other replies are
+// passed over if possible. With a useful RTT estimate, the transmission
+// whose age best matches the estimate wins. Otherwise, the oldest does.
+func likelyAnswered(sent []time.Time, claimed []bool, received time.Time, rttGuess time.Duration) int {
+	best := -1
+	var bestDistance time.Duration
+	for _, unclaimedOnly := range []bool{true, false} {
+		for i, t := range sent {
+			if t.After(received) || (unclaimedOnly && claimed != nil && claimed[i]) {
+				continue
 			}
+			if rttGuess <= time.Millisecond {
+				return i
+			}
+			distance := received.Sub(t) - rttGuess
+			if distance < 0 {
+				distance = -distance
+			}
+			if best < 0 || distance < bestDistance {
+				best, bestDistance = i, distance
+			}
+		}
+		if best >= 0 {
+			return best
 		}
 	}
+	return best
 }
 
 // closeListenerAfterNReplies closes the specified *net.UDPConn after reading
 // the specified number of replies, or reaching the specified deadline
-// - whichever happens first.
+// - whichever happens first. If late is not nil, the replies are reported
+// there, and listening continues until the deadline so that duplicates
+// are caught too.
 //
 // This allows us to gracefully handle replies to outstanding messages,
 // rather than closing the socket, and forcing the operating system to
 // send ICMP "f-off" replies.
-func closeListenerAfterNReplies(cxn *net.UDPConn, pendingReplies int, deadline time.Time) {
+func closeListenerAfterNReplies(cxn *net.UDPConn, pendingReplies int, deadline time.Time, late *lateReplies) {
+	if late != nil {
+		defer close(late.out)
+	}
+
 	// restore the socket deadline (may have been changed due to abort)
 	setDeadlineErr := cxn.SetReadDeadline(deadline)
 	if setDeadlineErr != nil {
@@ -324,16 +516,49 @@ func closeListenerAfterNReplies(cxn *net.UDPConn, pendingReplies int, deadline t
 	isNetDialSocket := cxn.RemoteAddr() != nil
 	buffIn := make([]byte, inBufferSize)
 
-	// collect pending replies -- we really don't care what happens here.
-	for i := 0; i < pendingReplies; i++ {
+	// collect pending replies. Errors don't matter here, beyond ending
+	// the loop: the only thing that matters is running it out.
+	for i := 0; late != nil || i < pendingReplies; i++ {
+		var n int
+		var from net.IP
+		var err error
 		// read from the socket using the appropriate call
-		// Yes I am not handling the error.
-		// The only thing that matters is running out the loop.
 		if isNetDialSocket {
-			_, _ = cxn.Read(buffIn)
+			n, err = cxn.Read(buffIn)
+			from = cxn.RemoteAddr().(*net.UDPAddr).IP
 		} else {
-			_, _, _ = cxn.ReadFromUDP(buffIn)
+			var addr *net.UDPAddr
+			n, addr, err = cxn.ReadFromUDP(buffIn)
+			if addr != nil {
+				from = addr.IP
+			}
+		}
+		if err != nil {
+			if isRefused(err) || isUnreachable(err) {
+				continue // ICMP in response to one of our transmissions
+			}
+			break
+		}
+		if late == nil {
+			continue
+		}
+
+		if !fromAny(late.sources, from) {
+			continue
+		}
+
+		r := Reply{
+			From:     from,
+			Data:     make([]byte, n),
+			Received: time.Now(),
+		}
+		copy(r.Data, buffIn[:n])
+		r.Answered = likelyAnswered(late.sent, late.claimed, r.Received, late.rttGuess)
+		if r.Answered >= 0 {
+			late.claimed[r.Answered] = true
+			r.Rtt = r.Received.Sub(late.sent[r.Answered])
 		}
+		late.out <- r
 	}
 
 	_ = cxn.Close()
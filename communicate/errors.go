@@ -0,0 +1,110 @@
+package communicate
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// These values describe the kinds of problems reported by SendError. Test
+// for them with errors.Is().
+var (
+	ErrTimeout      = errors.New("timed out waiting for reply")
+	ErrRefused      = errors.New("port unreachable (service disabled?)")
+	ErrUnreachable  = errors.New("host or network unreachable")
+	ErrBufferFull   = errors.New("receive buffer full")
+	ErrShortWrite   = errors.New("short write to socket")
+	ErrLongWrite    = errors.New("long write to socket")
+	ErrNotConnected = errors.New("socket not connected")
+	ErrBind         = errors.New("cannot bind local socket")
+	ErrSocket       = errors.New("socket error")
+)
+
+// SendError describes a problem encountered by Communicate() while talking
+// to Destination. Kind is one of the Err* values above, and satisfies
+// errors.Is(). Err holds the underlying error. SendError implements
+// net.Error, so it can be inspected for Timeout() and Temporary() errors
+// just like the socket errors it wraps.
+type SendError struct {
+	Destination *net.UDPAddr
+	Kind        error
+	Err         error
+}
+
+func (o *SendError) Error() string {
+	if o.Destination == nil {
+		return o.Err.Error()
+	}
+	return "communicating with " + o.Destination.String() + ": " + o.Err.Error()
+}
+
+// Is returns a boolean indicating whether target matches the kind of error.
+func (o *SendError) Is(target error) bool {
+	return target == o.Kind
+}
+
+// Unwrap returns the underlying error.
+func (o *SendError) Unwrap() error {
+	return o.Err
+}
+
+// Timeout returns a boolean indicating whether we gave up waiting for a reply.
+func (o *SendError) Timeout() bool {
+	return o.Kind == ErrTimeout
+}
+
+// Temporary returns a boolean indicating whether the underlying socket
+// error is temporary.
+func (o *SendError) Temporary() bool {
+	if ne, ok := o.Err.(net.Error); ok {
+		return ne.Temporary()
+	}
+	return false
+}
+
+// newSendError wraps err in a *SendError, classifying it along the way.
+// It returns nil if err is nil.
+func newSendError(destination *net.UDPAddr, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if se, ok := err.(*SendError); ok {
+		return se
+	}
+
+	kind := ErrSocket
+	switch {
+	case isRefused(err):
+		kind = ErrRefused
+	case isUnreachable(err):
+		kind = ErrUnreachable
+	default:
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			kind = ErrTimeout
+		}
+	}
+	for _, k := range []error{ErrBufferFull, ErrShortWrite, ErrLongWrite, ErrNotConnected, ErrBind} {
+		if errors.Is(err, k) {
+			kind = k
+		}
+	}
+
+	return &SendError{
+		Destination: destination,
+		Kind:        kind,
+		Err:         err,
+	}
+}
+
+// isRefused returns a boolean indicating whether err is the result of an
+// ICMP port unreachable, which only connected sockets get to hear about.
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// isUnreachable returns a boolean indicating whether err is the result of
+// an ICMP host or network unreachable.
+func isUnreachable(err error) bool {
+	return errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
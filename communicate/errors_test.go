@@ -0,0 +1,71 @@
+package communicate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewSendError(t *testing.T) {
+	if newSendError(nil, nil) != nil {
+		t.Fatal("nil error should stay nil")
+	}
+
+	dst := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: CiscoL2TPort}
+	err := newSendError(dst, fmt.Errorf("%w, only manged 1 of 2 bytes", ErrShortWrite))
+	if !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("expected ErrShortWrite, got %v", err)
+	}
+
+	var se *SendError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *SendError, got %T", err)
+	}
+	if !se.Destination.IP.Equal(dst.IP) {
+		t.Fatalf("expected destination %s, got %s", dst, se.Destination)
+	}
+
+	ne, ok := err.(net.Error)
+	if !ok || ne.Timeout() {
+		t.Fatal("short write should be a non-timeout net.Error")
+	}
+}
+
+func TestNewSendErrorIcmp(t *testing.T) {
+	refused := &net.OpError{Op: "read", Net: "udp", Err: os.NewSyscallError("recvfrom", syscall.ECONNREFUSED)}
+	if err := newSendError(nil, refused); !errors.Is(err, ErrRefused) || err.(net.Error).Timeout() {
+		t.Fatalf("expected non-timeout ErrRefused, got %v", err)
+	}
+
+	unreachable := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.EHOSTUNREACH)}
+	if err := newSendError(nil, unreachable); !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("expected ErrUnreachable, got %v", err)
+	}
+}
+
+func TestCommunicateRefused(t *testing.T) {
+	// find a port nobody is listening on
+	cxn, err := net.ListenUDP(UdpProtocol, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := cxn.LocalAddr().(*net.UDPAddr)
+	cxn.Close()
+
+	start := time.Now()
+	result := Communicate(SendThis{
+		Payload:         []byte("hello"),
+		Destination:     dst,
+		ExpectReplyFrom: dst.IP,
+	}, nil)
+	if !errors.Is(result.Err, ErrRefused) {
+		t.Fatalf("expected ErrRefused, got %v", result.Err)
+	}
+	if time.Since(start) >= MaxRTT {
+		t.Fatal("refusal should end the exchange before MaxRTT")
+	}
+}
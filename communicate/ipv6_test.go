@@ -0,0 +1,102 @@
+package communicate
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUdpProtocolFor(t *testing.T) {
+	expected := map[string]string{
+		"192.0.2.1":        UdpProtocol,
+		"::ffff:192.0.2.1": UdpProtocol,
+		"2001:db8::1":      UdpProtocol6,
+		"::1":              UdpProtocol6,
+	}
+	for ip, network := range expected {
+		if result := UdpProtocolFor(net.ParseIP(ip)); result != network {
+			t.Fatalf("%s: expected %s, got %s", ip, network, result)
+		}
+	}
+	if UdpProtocolFor(nil) != UdpProtocol {
+		t.Fatal("nil should get UdpProtocol")
+	}
+}
+
+func TestGetOutgoingIpForDestinationIpv6(t *testing.T) {
+	ip, err := GetOutgoingIpForDestination(net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.IPv6loopback) {
+		t.Fatalf("expected ::1, got %s", ip)
+	}
+}
+
+func TestCommunicateIpv6(t *testing.T) {
+	// connected socket, then listener socket
+	for _, expect := range []bool{true, false} {
+		server := echoServer(t, "::1", 1, 0)
+		out := SendThis{
+			Payload:     []byte("hello"),
+			Destination: server,
+			MaxWait:     time.Second,
+		}
+		if expect {
+			out.ExpectReplyFrom = server.IP
+		}
+		result := Communicate(out, nil)
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if string(result.ReplyData) != "0hello" || !result.ReplyFrom.Equal(net.IPv6loopback) {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	}
+}
+
+func TestCommunicateRefusedIpv6(t *testing.T) {
+	cxn, err := net.ListenUDP(UdpProtocol6, &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := cxn.LocalAddr().(*net.UDPAddr)
+	cxn.Close()
+
+	result := Communicate(SendThis{
+		Payload:         []byte("hello"),
+		Destination:     dst,
+		ExpectReplyFrom: dst.IP,
+	}, nil)
+	if !errors.Is(result.Err, ErrRefused) {
+		t.Fatalf("expected ErrRefused, got %v", result.Err)
+	}
+}
+
+func TestListenIpv6(t *testing.T) {
+	l, records, err := ListenChan(&net.UDPAddr{IP: net.IPv6loopback}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	cxn, err := net.DialUDP(UdpProtocol6, nil, l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cxn.Close()
+	_, err = cxn.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-records:
+		if string(r.Data) != "hello" || !r.From.IP.Equal(net.IPv6loopback) {
+			t.Fatalf("unexpected record: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no record received")
+	}
+}
@@ -0,0 +1,136 @@
+package communicate
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// echoServer listens on ip, replies to the first datagram it receives
+// several times, with a delay before each reply, then ignores everything
+// else.
+func echoServer(t *testing.T, ip string, copies int, delay time.Duration) *net.UDPAddr {
+	addr := &net.UDPAddr{IP: net.ParseIP(ip)}
+	cxn, err := net.ListenUDP(UdpProtocolFor(addr.IP), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer cxn.Close()
+		_ = cxn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		buf := make([]byte, 1500)
+		n, from, err := cxn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		for i := 0; i < copies; i++ {
+			time.Sleep(delay)
+			reply := append([]byte{byte('0' + i)}, buf[:n]...)
+			_, _ = cxn.WriteToUDP(reply, from)
+		}
+		for {
+			_, _, err := cxn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return cxn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestLateReplies(t *testing.T) {
+	server := echoServer(t, "127.0.0.1", 3, 20*time.Millisecond)
+	late := make(chan Reply)
+	result := Communicate(SendThis{
+		Payload:         []byte("hello"),
+		Destination:     server,
+		ExpectReplyFrom: server.IP,
+		RttGuess:        200 * time.Millisecond,
+		MaxWait:         500 * time.Millisecond,
+		Late:            late,
+	}, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if string(result.ReplyData) != "0hello" || len(result.Sent) != 1 || result.Answered != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// both duplicates answer the only transmission
+	var got []Reply
+	for r := range late {
+		got = append(got, r)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 late replies, got %d", len(got))
+	}
+	for i, r := range got {
+		if string(r.Data) != string(rune('1'+i))+"hello" || r.Answered != 0 || r.Rtt <= 0 {
+			t.Fatalf("unexpected late reply %d: %+v", i, r)
+		}
+	}
+}
+
+func TestLateRepliesRetransmit(t *testing.T) {
+	// server answers slowly, so we retransmit before the first reply
+	server := echoServer(t, "127.0.0.1", 1, 150*time.Millisecond)
+	late := make(chan Reply)
+	result := Communicate(SendThis{
+		Payload:         []byte("hello"),
+		Destination:     server,
+		ExpectReplyFrom: server.IP,
+		RttGuess:        50 * time.Millisecond,
+		MaxWait:         400 * time.Millisecond,
+		Late:            late,
+	}, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if len(result.Sent) < 2 {
+		t.Fatalf("expected retransmissions, got %d transmissions", len(result.Sent))
+	}
+
+	// the server answers only once, so nothing arrives late
+	for r := range late {
+		t.Fatalf("unexpected late reply: %+v", r)
+	}
+}
+
+func TestLateClosedOnError(t *testing.T) {
+	late := make(chan Reply)
+	go Communicate(SendThis{
+		Payload:     []byte("hello"),
+		Destination: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0},
+		Late:        late,
+	}, nil)
+	select {
+	case _, ok := <-late:
+		if ok {
+			t.Fatal("no replies expected")
+		}
+	case <-time.After(MaxRTT + time.Second):
+		t.Fatal("late channel not closed")
+	}
+}
+
+func TestLikelyAnswered(t *testing.T) {
+	start := time.Now()
+	sent := []time.Time{start, start.Add(100 * time.Millisecond), start.Add(300 * time.Millisecond)}
+	received := start.Add(320 * time.Millisecond)
+
+	if i := likelyAnswered(sent, nil, received, 0); i != 0 {
+		t.Fatalf("without an RTT estimate, expected the oldest, got %d", i)
+	}
+	if i := likelyAnswered(sent, nil, received, 200*time.Millisecond); i != 1 {
+		t.Fatalf("expected transmission 1, got %d", i)
+	}
+	if i := likelyAnswered(sent, []bool{false, true, false}, received, 200*time.Millisecond); i != 0 {
+		t.Fatalf("expected transmission 0 once 1 is claimed, got %d", i)
+	}
+	if i := likelyAnswered(sent, []bool{true, true, true}, received, 200*time.Millisecond); i != 1 {
+		t.Fatalf("expected a duplicate of transmission 1, got %d", i)
+	}
+	if i := likelyAnswered(nil, nil, received, 0); i != -1 {
+		t.Fatalf("expected -1 with nothing sent, got %d", i)
+	}
+}
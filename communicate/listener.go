@@ -0,0 +1,102 @@
+package communicate
+
+import (
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"time"
+)
+
+// Record describes a datagram received by a Listener.
+type Record struct {
+	From     *net.UDPAddr
+	Received time.Time
+	Data     []byte
+	Msg      message.Msg // nil if Data couldn't be decoded
+	Err      error       // why Data couldn't be decoded
+}
+
+// Listener receives whatever arrives on a UDP socket without sending
+// anything: late replies, replies to other tools, replies redirected
+// by a query's source IP attribute. Each datagram is decoded with
+// message.UnmarshalMessageUnsafe() and handed to the Listener's handler
+// as a Record.
+type Listener struct {
+	cxn     *net.UDPConn
+	handler func(Record)
+	done    chan struct{}
+}
+
+// Listen returns a Listener bound to addr, which calls handler with a
+// Record for each datagram received. The handler is called from a single
+// goroutine, so a slow handler delays (and may cause the loss of) the
+// datagrams behind it.
+func Listen(addr *net.UDPAddr, handler func(Record)) (*Listener, error) {
+	var ip net.IP
+	if addr != nil {
+		ip = addr.IP
+	}
+	cxn, err := net.ListenUDP(UdpProtocolFor(ip), addr)
+	if err != nil {
+		return nil, err
+	}
+	o := &Listener{
+		cxn:     cxn,
+		handler: handler,
+		done:    make(chan struct{}),
+	}
+	go o.receive()
+	return o, nil
+}
+
+// ListenChan is like Listen, but delivers Records on a channel with room
+// for buffer Records. The channel is closed when the Listener is closed.
+// Keep the channel drained: the Listener waits for room.
+func ListenChan(addr *net.UDPAddr, buffer int) (*Listener, <-chan Record, error) {
+	records := make(chan Record, buffer)
+	o, err := Listen(addr, func(r Record) {
+		records <- r
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		<-o.done
+		close(records)
+	}()
+	return o, records, nil
+}
+
+// Addr returns the address the Listener is bound to.
+func (o *Listener) Addr() *net.UDPAddr {
+	return o.cxn.LocalAddr().(*net.UDPAddr)
+}
+
+// Close stops the Listener. The handler isn't called after Close returns.
+func (o *Listener) Close() error {
+	err := o.cxn.Close()
+	<-o.done
+	return err
+}
+
+func (o *Listener) receive() {
+	defer close(o.done)
+	buffIn := make([]byte, inBufferSize)
+	for {
+		n, from, err := o.cxn.ReadFromUDP(buffIn)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return // closed
+		}
+
+		r := Record{
+			From:     from,
+			Received: time.Now(),
+			Data:     make([]byte, n),
+		}
+		copy(r.Data, buffIn[:n])
+		r.Msg, r.Err = message.UnmarshalMessageUnsafe(r.Data)
+		o.handler(r)
+	}
+}
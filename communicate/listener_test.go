@@ -0,0 +1,61 @@
+package communicate
+
+import (
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenChan(t *testing.T) {
+	l, records, err := ListenChan(&net.UDPAddr{IP: net.ParseIP("127.0.0.1")}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := message.TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cxn, err := net.DialUDP(UdpProtocol, nil, l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cxn.Close()
+	for _, payload := range [][]byte{msg.Marshal(nil), {1, 2}} {
+		_, err = cxn.Write(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []Record
+	timeout := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case r := <-records:
+			got = append(got, r)
+		case <-timeout:
+			t.Fatalf("expected 2 records, got %d", len(got))
+		}
+	}
+
+	if got[0].Msg == nil || got[0].Err != nil || got[0].Msg.Type() != msg.Type() {
+		t.Fatalf("first record should decode: %+v", got[0])
+	}
+	if got[1].Msg != nil || got[1].Err == nil {
+		t.Fatalf("second record shouldn't decode: %+v", got[1])
+	}
+	if !got[0].From.IP.Equal(cxn.LocalAddr().(*net.UDPAddr).IP) || got[0].Received.IsZero() {
+		t.Fatalf("bad sender or time: %+v", got[0])
+	}
+
+	err = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-records; ok {
+		t.Fatal("channel should close with the listener")
+	}
+}
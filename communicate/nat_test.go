@@ -0,0 +1,47 @@
+package communicate
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcceptFrom(t *testing.T) {
+	server := echoServer(t, "127.0.0.2", 1, 0)
+	out := SendThis{
+		Payload:         []byte("hello"),
+		Destination:     server,
+		ExpectReplyFrom: net.ParseIP("127.0.0.1"),
+		RttGuess:        50 * time.Millisecond,
+		MaxWait:         300 * time.Millisecond,
+	}
+
+	// reply comes from an address we weren't expecting
+	result := Communicate(out, nil)
+	if result.Err == nil {
+		t.Fatal("expected alien reply to be ignored")
+	}
+
+	server = echoServer(t, "127.0.0.2", 1, 0)
+	out.Destination = server
+	out.AcceptFrom = []net.IP{server.IP}
+	result = Communicate(out, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if !result.ReplyFrom.Equal(server.IP) || string(result.ReplyData) != "0hello" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestBindSrcIp(t *testing.T) {
+	local := net.ParseIP("10.0.0.1")
+	var b Bind
+	if b.Nat() || !b.SrcIp(local).Equal(local) {
+		t.Fatal("zero Bind shouldn't advertise")
+	}
+	b.Advertise = net.ParseIP("192.0.2.1")
+	if !b.Nat() || !b.SrcIp(local).Equal(b.Advertise) || b.IsZero() {
+		t.Fatalf("expected to advertise %s", b.Advertise)
+	}
+}
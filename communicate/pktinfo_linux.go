@@ -0,0 +1,50 @@
+package communicate
+
+import (
+	"net"
+	"syscall"
+)
+
+// setPktInfo asks the kernel to report the destination address of each
+// datagram read from the socket.
+func setPktInfo(c *net.UDPConn) error {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	v4 := c.LocalAddr().(*net.UDPAddr).IP.To4() != nil
+	cErr := rc.Control(func(fd uintptr) {
+		switch v4 {
+		case true:
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1)
+		case false:
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO, 1)
+		}
+	})
+	if cErr != nil {
+		return cErr
+	}
+	return err
+}
+
+// pktDst returns the destination address found in the ancillary data read
+// along with a datagram, or nil if there isn't one.
+func pktDst(oob []byte) net.IP {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_PKTINFO &&
+			len(m.Data) >= syscall.SizeofInet4Pktinfo:
+			// ifindex (4 bytes), local address (4), header destination (4)
+			return net.IP(append([]byte{}, m.Data[8:12]...))
+		case m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_PKTINFO &&
+			len(m.Data) >= syscall.SizeofInet6Pktinfo:
+			// destination (16 bytes), ifindex (4)
+			return net.IP(append([]byte{}, m.Data[0:16]...))
+		}
+	}
+	return nil
+}
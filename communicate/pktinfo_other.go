@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package communicate
+
+import "net"
+
+// setPktInfo does nothing: reporting the destination address of received
+// datagrams is only supported on Linux.
+func setPktInfo(*net.UDPConn) error {
+	return nil
+}
+
+// pktDst returns nil, because setPktInfo() doesn't ask for anything.
+func pktDst([]byte) net.IP {
+	return nil
+}
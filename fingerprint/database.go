@@ -0,0 +1,88 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrEmptyDatabase means there are no signatures to match against, so no
+// guess can be made.
+var ErrEmptyDatabase = errors.New("signature database is empty")
+
+// Entry associates a (possibly partial) Signature with a platform family
+// and firmware class.
+type Entry struct {
+	Family    string    `json:"family"`
+	Firmware  string    `json:"firmware"`
+	Signature Signature `json:"signature"`
+}
+
+// Database is a list of known signatures.
+type Database []Entry
+
+// Match is a database Entry scored against an observed Signature.
+type Match struct {
+	Entry
+	Score    float64 `json:"score"`    // fraction of compared keys which agree
+	Compared int     `json:"compared"` // keys present in both signatures
+}
+
+// bundledSignatures is the built-in database. Entries only need to list
+// the keys that distinguish them. Each should come from running
+// l2t-fingerprint with -signature against a switch of known family and
+// firmware. None have been contributed yet, so until then, entries have to
+// be supplied with LoadDatabase(). Matching against the bundled database
+// alone guesses nothing.
+const bundledSignatures = `[]`
+
+// Bundled returns the built-in signature database.
+func Bundled() (Database, error) {
+	return LoadDatabase(strings.NewReader(bundledSignatures))
+}
+
+// LoadDatabase reads a JSON format Database from r.
+func LoadDatabase(r io.Reader) (Database, error) {
+	var db Database
+	err := json.NewDecoder(r).Decode(&db)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Match scores every entry in the database against the signature, best
+// match first. Keys missing from either signature aren't compared, and
+// entries with nothing to compare are left out.
+func (o Database) Match(s Signature) []Match {
+	var out []Match
+	for _, e := range o {
+		m := Match{Entry: e}
+		agree := 0
+		for k, v := range e.Signature {
+			observed, ok := s[k]
+			if !ok {
+				continue
+			}
+			m.Compared++
+			if observed == v {
+				agree++
+			}
+		}
+		if m.Compared == 0 {
+			continue
+		}
+		m.Score = float64(agree) / float64(m.Compared)
+		out = append(out, m)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Compared > out[j].Compared
+	})
+	return out
+}
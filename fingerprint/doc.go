@@ -0,0 +1,5 @@
+// Package fingerprint guesses a switch's platform family and firmware class
+// from the way it answers a fixed battery of L2T probes: which reply status
+// codes it uses, how it handles malformed queries, and which address it
+// replies from. This works even when the switch doesn't send DEV_TYPE.
+package fingerprint
@@ -0,0 +1,91 @@
+package fingerprint
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+	"time"
+)
+
+// MinScore is the lowest Match score reported as a guess by Result.Guess.
+const MinScore = 0.75
+
+// Result is the outcome of fingerprinting a switch.
+type Result struct {
+	Platform  string              `json:"platform,omitempty"` // from DEV_TYPE, if the switch sent it
+	Responses map[string]Response `json:"responses"`
+	Signature Signature           `json:"signature"`
+	Matches   []Match             `json:"matches"`
+}
+
+// Guess returns the best Match, and a boolean indicating whether it scored
+// at least MinScore.
+func (o Result) Guess() (Match, bool) {
+	if len(o.Matches) == 0 {
+		return Match{}, false
+	}
+	return o.Matches[0], o.Matches[0].Score >= MinScore
+}
+
+// Fingerprint sends the probe battery to the target's current best address
+// and matches the resulting Signature against db. Probes are sent directly
+// rather than through the target, so that probes the switch ignores don't
+// count against the address's health, and so that replies from any of the
+// switch's addresses are accepted.
+func Fingerprint(t target.Target, db Database) (Result, error) {
+	p := t.Profile()
+	if len(p.Addresses) == 0 || p.Best >= len(p.Addresses) {
+		return Result{}, errors.New("target has no addresses")
+	}
+	destination := &net.UDPAddr{
+		IP:   p.Addresses[p.Best].Destination,
+		Port: communicate.CiscoL2TPort,
+	}
+
+	var bind communicate.Bind
+	if p.Bind != nil {
+		bind = *p.Bind
+	}
+
+	var rttGuess time.Duration
+	for _, h := range t.Health() {
+		if h.Active {
+			rttGuess = h.Srtt
+		}
+	}
+
+	responses := make(map[string]Response)
+	for _, probe := range Battery {
+		in := communicate.Communicate(communicate.SendThis{
+			Payload:     probe.Payload(t.GetSrcIp()),
+			Destination: destination,
+			RttGuess:    rttGuess,
+			Bind:        bind,
+		}, nil)
+		responses[probe.Name] = classify(in)
+	}
+
+	r := newResult(responses, db)
+	if r.Platform == "" {
+		r.Platform = p.Platform
+	}
+	return r, nil
+}
+
+// newResult builds a Result from the responses to the probe battery.
+func newResult(responses map[string]Response, db Database) Result {
+	r := Result{
+		Responses: responses,
+		Signature: signatureOf(responses),
+	}
+	r.Matches = db.Match(r.Signature)
+
+	if baseline, ok := responses["baseline"]; ok && baseline.Msg != nil {
+		if devType := baseline.Msg.GetAttr(attribute.DevTypeType); devType != nil {
+			r.Platform = devType.String()
+		}
+	}
+	return r
+}
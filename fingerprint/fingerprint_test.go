@@ -0,0 +1,217 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBatteryPayloads(t *testing.T) {
+	local := net.ParseIP("192.0.2.100")
+	names := make(map[string]bool)
+	for _, p := range Battery {
+		if names[p.Name] {
+			t.Fatalf("duplicate probe name `%s'", p.Name)
+		}
+		names[p.Name] = true
+
+		b := p.Payload(local)
+		_, err := message.UnmarshalMessage(b)
+		switch p.Name {
+		case "baseline", "request_dst", "unicast_macs", "multicast_macs", "reply_type", "no_src_ip":
+			if err != nil {
+				t.Fatalf("probe `%s' should parse: %s", p.Name, err)
+			}
+		case "vlan_0", "vlan_4095", "bad_version", "short_header":
+			if err == nil {
+				t.Fatalf("probe `%s' should not parse", p.Name)
+			}
+		default:
+			t.Fatalf("no expectation for probe `%s'", p.Name)
+		}
+	}
+}
+
+func TestBaselineMatchesTestMsg(t *testing.T) {
+	local := net.ParseIP("192.0.2.100")
+	msg, err := message.TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := attribute.NewAttrBuilder().SetType(attribute.SrcIPv4Type).SetString(local.String()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.SetAttr(a)
+
+	expected := fmt.Sprintf("%x", msg.Marshal(nil))
+	got := fmt.Sprintf("%x", Battery[0].Payload(local))
+	if expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+}
+
+func reply(t *testing.T, status uint32, from string, devType bool) communicate.SendResult {
+	builder := message.NewMsgBuilder().SetType(message.ReplySrc)
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.DevNameType, "sw1"},
+		{attribute.DevTypeType, "cisco WS-C3560"},
+		{attribute.DevIPv4Type, "192.0.2.1"},
+	} {
+		if a.t == attribute.DevTypeType && !devType {
+			continue
+		}
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.SetAttr(att)
+	}
+	att, err := attribute.NewAttrBuilder().SetType(attribute.ReplyStatusType).SetInt(status).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetAttr(att)
+
+	return communicate.SendResult{
+		SentTo:    net.ParseIP("192.0.2.1"),
+		ReplyFrom: net.ParseIP(from),
+		ReplyData: builder.Build().Marshal(nil),
+	}
+}
+
+func TestClassify(t *testing.T) {
+	timeout := communicate.SendResult{Err: &communicate.SendError{Kind: communicate.ErrTimeout, Err: errors.New("i/o timeout")}}
+	other := communicate.SendResult{Err: errors.New("network is unreachable")}
+	garbage := communicate.SendResult{ReplyData: []byte{1, 2}}
+
+	for _, test := range []struct {
+		in       communicate.SendResult
+		expected string
+	}{
+		{timeout, OutcomeTimeout},
+		{other, OutcomeError},
+		{garbage, OutcomeMalformed},
+		{reply(t, 7, "192.0.2.1", true), "status=7"},
+		{reply(t, 3, "192.0.2.1", true), "status=3"},
+	} {
+		got := classify(test.in).String()
+		if got != test.expected {
+			t.Fatalf("expected `%s', got `%s'", test.expected, got)
+		}
+	}
+
+	r := classify(reply(t, 7, "198.51.100.1", true))
+	if !r.OtherSource {
+		t.Fatal("reply from another address not noticed")
+	}
+}
+
+// responsesFor fakes the battery's responses from an entry's signature.
+func responsesFor(t *testing.T, e Entry) map[string]Response {
+	from := "192.0.2.1"
+	if e.Signature[keyReplySource] == replySourceOther {
+		from = "198.51.100.1"
+	}
+
+	var devType bool
+	for _, a := range strings.Split(e.Signature[keyBaselineAttrs], ",") {
+		devType = devType || a == strconv.Itoa(int(attribute.DevTypeType))
+	}
+
+	responses := make(map[string]Response)
+	for _, p := range Battery {
+		v, ok := e.Signature[p.Name]
+		if !ok {
+			continue
+		}
+		var status uint32
+		switch {
+		case v == OutcomeTimeout || v == OutcomeMalformed:
+			responses[p.Name] = Response{Outcome: v, Status: -1}
+			continue
+		case strings.HasPrefix(v, "status="):
+			fmt.Sscanf(v, "status=%d", &status)
+		}
+		responses[p.Name] = classify(reply(t, status, from, devType))
+	}
+	return responses
+}
+
+// testDatabase holds made up entries, one for each of several ways of
+// answering the probes. They don't describe real platforms.
+var testDatabase = Database{
+	{Family: "synthetic A", Firmware: "1", Signature: Signature{
+		"baseline": "status=7", "request_dst": "status=8", "vlan_0": "status=3", "vlan_4095": "status=3",
+		"bad_version": "timeout", "reply_type": "timeout", "no_src_ip": "timeout", "short_header": "timeout",
+		"reply_source": "same", "baseline_attrs": "4,5,6,15",
+	}},
+	{Family: "synthetic A", Firmware: "2", Signature: Signature{
+		"baseline": "status=7", "request_dst": "status=8", "vlan_0": "status=3", "vlan_4095": "status=3",
+		"bad_version": "timeout", "reply_type": "timeout", "no_src_ip": "status=7", "short_header": "timeout",
+		"reply_source": "same", "baseline_attrs": "4,5,6,15",
+	}},
+	{Family: "synthetic B", Firmware: "1", Signature: Signature{
+		"baseline": "status=7", "request_dst": "status=8", "vlan_0": "timeout", "vlan_4095": "timeout",
+		"bad_version": "timeout", "reply_type": "timeout", "no_src_ip": "timeout", "short_header": "timeout",
+		"reply_source": "other", "baseline_attrs": "4,5,6,15",
+	}},
+	{Family: "synthetic C", Firmware: "1", Signature: Signature{
+		"baseline": "status=7", "request_dst": "status=8", "vlan_0": "status=3", "vlan_4095": "timeout",
+		"bad_version": "timeout", "reply_type": "timeout", "no_src_ip": "timeout", "short_header": "malformed",
+		"reply_source": "other", "baseline_attrs": "4,5,6,15",
+	}},
+	{Family: "synthetic D", Firmware: "1", Signature: Signature{
+		"baseline": "status=7", "request_dst": "status=8", "vlan_0": "status=3", "vlan_4095": "status=3",
+		"bad_version": "timeout", "reply_type": "timeout", "no_src_ip": "timeout", "short_header": "timeout",
+		"reply_source": "other", "baseline_attrs": "4,6,15",
+	}},
+}
+
+func TestBundled(t *testing.T) {
+	_, err := Bundled()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchDatabase(t *testing.T) {
+	db := testDatabase
+	for _, e := range db {
+		r := newResult(responsesFor(t, e), db)
+		m, ok := r.Guess()
+		if !ok {
+			t.Fatalf("no confident guess for %s, %s", e.Family, e.Firmware)
+		}
+		if m.Family != e.Family {
+			t.Fatalf("expected %s, %s, got %s, %s", e.Family, e.Firmware, m.Family, m.Firmware)
+		}
+		if r.Signature[keyBaselineAttrs] == "4,5,6,15" && r.Platform != "cisco WS-C3560" {
+			t.Fatalf("DEV_TYPE not noticed: `%s'", r.Platform)
+		}
+	}
+}
+
+func TestMatchPartial(t *testing.T) {
+	db := Database{
+		{Family: "a", Signature: Signature{"baseline": "status=7", "vlan_0": "status=3"}},
+		{Family: "b", Signature: Signature{"baseline": "status=7", "vlan_0": OutcomeTimeout}},
+		{Family: "c", Signature: Signature{"short_header": OutcomeTimeout}},
+	}
+	matches := db.Match(Signature{"baseline": "status=7", "vlan_0": OutcomeTimeout})
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	if matches[0].Family != "b" || matches[0].Score != 1 || matches[1].Score != 0.5 {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+}
@@ -0,0 +1,97 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+)
+
+// Probe is one query in the fingerprinting battery. Payload returns the
+// bytes to send. Many of the probes are deliberately malformed, so they're
+// assembled by hand rather than with the message and attribute builders.
+type Probe struct {
+	Name    string
+	Payload func(local net.IP) []byte
+}
+
+var (
+	broadcastMac = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	cdpMac       = []byte{0x01, 0x00, 0x0c, 0xcc, 0xcc, 0xcc}
+	unicastMac   = []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+)
+
+// Battery is the list of probes sent to every switch. Signatures in the
+// database refer to these probes by name, so don't rename them.
+var Battery = []Probe{
+	{"baseline", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1, broadcastMac, broadcastMac, vlan(1), srcIp(l))
+	}},
+	{"request_dst", func(l net.IP) []byte {
+		return query(message.RequestDst, message.Version1, broadcastMac, broadcastMac, vlan(1), srcIp(l))
+	}},
+	{"vlan_0", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1, broadcastMac, broadcastMac, vlan(0), srcIp(l))
+	}},
+	{"vlan_4095", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1, broadcastMac, broadcastMac, vlan(4095), srcIp(l))
+	}},
+	{"unicast_macs", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1, unicastMac, unicastMac, vlan(1), srcIp(l))
+	}},
+	{"multicast_macs", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1, cdpMac, cdpMac, vlan(1), srcIp(l))
+	}},
+	{"bad_version", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1+1, broadcastMac, broadcastMac, vlan(1), srcIp(l))
+	}},
+	{"reply_type", func(l net.IP) []byte {
+		return query(message.ReplySrc, message.Version1, broadcastMac, broadcastMac, vlan(1), srcIp(l))
+	}},
+	{"no_src_ip", func(l net.IP) []byte {
+		return query(message.RequestSrc, message.Version1, broadcastMac, broadcastMac, vlan(1), nil)
+	}},
+	{"short_header", func(l net.IP) []byte {
+		b := query(message.RequestSrc, message.Version1, broadcastMac, broadcastMac, vlan(1), srcIp(l))
+		binary.BigEndian.PutUint16(b[2:4], uint16(len(b)-1))
+		return b
+	}},
+}
+
+// query assembles a query message. The destination MAC attribute is placed
+// first on the wire, as with messages built by the message package. A nil
+// srcIp omits the source IP attribute.
+func query(t message.MsgType, v message.MsgVer, dstMac []byte, srcMac []byte, vlan []byte, srcIp []byte) []byte {
+	attrs := [][]byte{
+		attr(attribute.DstMacType, dstMac),
+		attr(attribute.SrcMacType, srcMac),
+		attr(attribute.VlanType, vlan),
+	}
+	if srcIp != nil {
+		attrs = append(attrs, attr(attribute.SrcIPv4Type, srcIp))
+	}
+
+	b := []byte{byte(t), byte(v), 0, 0, byte(len(attrs))}
+	for _, a := range attrs {
+		b = append(b, a...)
+	}
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	return b
+}
+
+func attr(t attribute.AttrType, payload []byte) []byte {
+	return append([]byte{byte(t), byte(attribute.TLsize + len(payload))}, payload...)
+}
+
+func vlan(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// srcIp returns the source IP attribute payload for our address. There's
+// no way to express an IPv6 source address, so that gets nil, which
+// leaves the attribute out.
+func srcIp(ip net.IP) []byte {
+	return ip.To4()
+}
@@ -0,0 +1,124 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of a probe.
+const (
+	OutcomeReply     = "reply"
+	OutcomeTimeout   = "timeout"
+	OutcomeError     = "error"
+	OutcomeMalformed = "malformed"
+)
+
+// Signature keys which aren't probe names.
+const (
+	keyReplySource   = "reply_source"
+	keyBaselineAttrs = "baseline_attrs"
+
+	replySourceSame  = "same"
+	replySourceOther = "other"
+)
+
+// Response summarizes the switch's answer to one probe.
+type Response struct {
+	Outcome     string               `json:"outcome"`
+	Status      int                  `json:"status"` // reply status code, -1 if none
+	Attrs       []attribute.AttrType `json:"attrs,omitempty"`
+	OtherSource bool                 `json:"other_source,omitempty"` // reply came from an address we didn't send to
+	Msg         message.Msg          `json:"-"`
+}
+
+// String renders the Response the way it appears in a Signature.
+func (o Response) String() string {
+	switch {
+	case o.Outcome != OutcomeReply:
+		return o.Outcome
+	case o.Status < 0:
+		return "no_status"
+	}
+	return "status=" + strconv.Itoa(o.Status)
+}
+
+// classify interprets the result of sending a probe.
+func classify(in communicate.SendResult) Response {
+	r := Response{Status: -1}
+	switch {
+	case errors.Is(in.Err, communicate.ErrTimeout):
+		r.Outcome = OutcomeTimeout
+		return r
+	case in.Err != nil:
+		r.Outcome = OutcomeError
+		return r
+	}
+
+	r.OtherSource = in.SentTo != nil && !in.SentTo.Equal(in.ReplyFrom)
+
+	msg, err := message.UnmarshalMessageUnsafe(in.ReplyData)
+	if err != nil {
+		r.Outcome = OutcomeMalformed
+		return r
+	}
+	r.Outcome = OutcomeReply
+	r.Msg = msg
+
+	for t := range msg.Attributes() {
+		r.Attrs = append(r.Attrs, t)
+	}
+	sort.Slice(r.Attrs, func(i, j int) bool { return r.Attrs[i] < r.Attrs[j] })
+
+	if status := msg.GetAttr(attribute.ReplyStatusType); status != nil && len(status.Bytes()) == 1 {
+		r.Status = int(status.Bytes()[0])
+	}
+	return r
+}
+
+// Signature describes a switch's behavior. Keys are probe names (the value
+// is the probe's Response in string form), plus a couple of keys
+// describing the baseline reply in more detail.
+type Signature map[string]string
+
+// signatureOf builds a Signature from the responses to the probe battery.
+func signatureOf(responses map[string]Response) Signature {
+	s := make(Signature)
+	for name, r := range responses {
+		s[name] = r.String()
+	}
+
+	if baseline, ok := responses["baseline"]; ok && baseline.Outcome == OutcomeReply {
+		s[keyReplySource] = replySourceSame
+		if baseline.OtherSource {
+			s[keyReplySource] = replySourceOther
+		}
+
+		var attrs []string
+		for _, a := range baseline.Attrs {
+			attrs = append(attrs, strconv.Itoa(int(a)))
+		}
+		s[keyBaselineAttrs] = strings.Join(attrs, ",")
+	}
+	return s
+}
+
+// String renders the signature one key per line, sorted by key.
+func (o Signature) String() string {
+	var keys []string
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", k, o[k]))
+	}
+	return sb.String()
+}
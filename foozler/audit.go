@@ -0,0 +1,194 @@
+package foozler
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+)
+
+const (
+	// L2TDisableCommand is the global configuration command recommended
+	// by the Cisco advisory for turning off the L2T listener.
+	L2TDisableCommand = "no l2 traceroute"
+
+	invalidInputMarker = "% Invalid input"
+)
+
+// L2TraceState is what "show l2trace" says about the L2T service.
+type L2TraceState int
+
+const (
+	// L2TraceUnsupported means the switch doesn't know the command.
+	L2TraceUnsupported L2TraceState = iota
+
+	// L2TraceUnknown means the output doesn't say whether the service
+	// is enabled.
+	L2TraceUnknown
+
+	L2TraceEnabled
+	L2TraceDisabled
+)
+
+func (o L2TraceState) String() string {
+	switch o {
+	case L2TraceUnsupported:
+		return "unsupported"
+	case L2TraceEnabled:
+		return "enabled"
+	case L2TraceDisabled:
+		return "disabled"
+	}
+	return "unknown"
+}
+
+// parseShowL2Trace works out the state of the L2T service from the output
+// of "show l2trace".
+func parseShowL2Trace(out string) L2TraceState {
+	if strings.Contains(out, invalidInputMarker) {
+		return L2TraceUnsupported
+	}
+	lower := strings.ToLower(out)
+	switch {
+	case strings.Contains(lower, "not enabled"), strings.Contains(lower, "disabled"):
+		return L2TraceDisabled
+	case strings.Contains(lower, "enabled"):
+		return L2TraceEnabled
+	}
+	return L2TraceUnknown
+}
+
+// L2TConfig describes what a switch's CLI tells us about its L2T service.
+type L2TConfig struct {
+	// Disabled is true when the running configuration
+	// contains the L2TDisableCommand.
+	Disabled bool
+
+	// ShowL2Trace holds the output of "show l2trace". It's empty if the
+	// switch doesn't support the command.
+	ShowL2Trace string
+
+	// L2TraceState is what ShowL2Trace says about the service.
+	L2TraceState L2TraceState
+}
+
+// Off returns a boolean indicating whether the CLI says the service is
+// off: it's disabled in the running configuration, and "show l2trace"
+// doesn't claim otherwise.
+func (o L2TConfig) Off() bool {
+	return o.Disabled && o.L2TraceState != L2TraceEnabled
+}
+
+// Auditor represents an SSH connection to a Cisco switch used for
+// inspecting (and optionally remediating) its L2T configuration.
+type Auditor struct {
+	client *ssh.Client
+}
+
+// AuditorFor connects to a Cisco switch via SSH to facilitate auditing.
+func AuditorFor(address string, port int, clientConfig *ssh.ClientConfig) (*Auditor, error) {
+	client, err := dial(address, port, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Auditor{client: client}, nil
+}
+
+// Close closes the SSH connection.
+func (o *Auditor) Close() error {
+	return o.client.Close()
+}
+
+// Run runs the supplied commands in a new interactive shell on the switch,
+// and returns the output of each one. Each command is sent only once the
+// switch has prompted for it. Paging is disabled before the commands run,
+// and the shell is exited afterward.
+func (o *Auditor) Run(commands ...string) ([]string, error) {
+	session, err := o.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	outR, outW := io.Pipe()
+	defer outW.Close()
+	session.Stdout = outW
+	session.Stderr = outW
+
+	err = session.Shell()
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCli(stdin, outR, promptTimeout)
+	outputs, err := converse(c, append([]string{"terminal length 0"}, commands...))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(stdin, "exit\r\n")
+	if err != nil {
+		return nil, err
+	}
+
+	err = session.Wait()
+	if _, ok := err.(*ssh.ExitMissingError); ok {
+		// IOS doesn't always send an exit status. That's fine.
+		err = nil
+	}
+
+	return outputs[1:], err
+}
+
+// L2TConfig inspects the switch's L2T service configuration.
+func (o *Auditor) L2TConfig() (L2TConfig, error) {
+	out, err := o.Run("show running-config | include l2 traceroute", "show l2trace")
+	if err != nil {
+		return L2TConfig{}, err
+	}
+	return l2tConfigFrom(out[0], out[1]), nil
+}
+
+// l2tConfigFrom interprets the output of the commands run by L2TConfig().
+func l2tConfigFrom(runningConfig string, showL2Trace string) L2TConfig {
+	result := L2TConfig{
+		Disabled:     strings.Contains(runningConfig, L2TDisableCommand),
+		L2TraceState: parseShowL2Trace(showL2Trace),
+	}
+	if result.L2TraceState != L2TraceUnsupported {
+		result.ShowL2Trace = showL2Trace
+	}
+	return result
+}
+
+// DisableL2T applies the remediation recommended by the Cisco advisory.
+// When save is true, the running configuration is also written to memory.
+func (o *Auditor) DisableL2T(save bool) error {
+	commands := []string{
+		"configure terminal",
+		L2TDisableCommand,
+		"end",
+	}
+	if save {
+		commands = append(commands, "write memory")
+	}
+
+	out, err := o.Run(commands...)
+	if err != nil {
+		return err
+	}
+
+	for i, output := range out {
+		if strings.Contains(output, invalidInputMarker) {
+			return fmt.Errorf("switch rejected remediation command `%s':\n%s", commands[i], output)
+		}
+	}
+
+	return nil
+}
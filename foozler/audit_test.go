@@ -0,0 +1,163 @@
+package foozler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSwitch imitates an IOS shell on the far end of a pair of pipes. It
+// echoes each command, prints canned output, then prompts. A command which
+// arrives before the prompt for it is recorded in early.
+type fakeSwitch struct {
+	outputs map[string]string
+	delay   time.Duration // before each prompt
+	early   []string
+	got     []string
+}
+
+func (o *fakeSwitch) run(in io.Reader, out io.WriteCloser) {
+	defer out.Close()
+	mode := "sw1#"
+	prompted := make(chan struct{}, 1)
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- strings.TrimRight(scanner.Text(), "\r")
+		}
+		close(lines)
+	}()
+
+	// prompted is signalled before the prompt is written, so that a
+	// command sent in response to the prompt is never counted as early
+	prompt := func(mode string) {
+		time.Sleep(o.delay)
+		prompted <- struct{}{}
+		fmt.Fprintf(out, "\r\n%s", mode)
+	}
+	go prompt(mode)
+
+	for line := range lines {
+		select {
+		case <-prompted:
+		default:
+			o.early = append(o.early, line)
+			<-prompted
+		}
+		o.got = append(o.got, line)
+		fmt.Fprintf(out, "%s\r\n", line)
+		switch line {
+		case "configure terminal":
+			mode = "sw1(config)#"
+		case "end":
+			mode = "sw1#"
+		case "exit":
+			return
+		}
+		fmt.Fprint(out, strings.Replace(o.outputs[line], "\n", "\r\n", -1))
+		go prompt(mode)
+	}
+}
+
+func TestConverse(t *testing.T) {
+	sw := &fakeSwitch{
+		delay: 20 * time.Millisecond,
+		outputs: map[string]string{
+			"show running-config | include l2 traceroute": "no l2 traceroute",
+			"show l2trace": "L2 trace server is disabled",
+		},
+	}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go sw.run(inR, outW)
+
+	commands := []string{
+		"show running-config | include l2 traceroute",
+		"configure terminal",
+		L2TDisableCommand,
+		"end",
+		"show l2trace",
+	}
+	out, err := converse(newCli(inW, outR, time.Second), commands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sw.early) != 0 {
+		t.Fatalf("commands sent before their prompt: %v", sw.early)
+	}
+	if len(out) != len(commands) || len(sw.got) != len(commands) {
+		t.Fatalf("expected %d outputs, got %q", len(commands), out)
+	}
+	if out[0] != "no l2 traceroute" || out[4] != "L2 trace server is disabled" || out[2] != "" {
+		t.Fatalf("unexpected outputs: %q", out)
+	}
+	_ = inW.Close()
+}
+
+func TestConverseNoPrompt(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, inR)
+	}()
+	go fmt.Fprint(outW, "Password required\r\n")
+
+	_, err := converse(newCli(inW, outR, 50*time.Millisecond), []string{"show clock"})
+	if !errors.Is(err, errNoPrompt) {
+		t.Fatalf("expected errNoPrompt, got %v", err)
+	}
+
+	_ = outW.Close()
+	_, err = converse(newCli(inW, outR, time.Second), []string{"show clock"})
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestPromptPattern(t *testing.T) {
+	for _, test := range []struct {
+		out    string
+		prompt bool
+	}{
+		{"\nsw1#", true},
+		{"\nsw1>", true},
+		{"sw-1.lab(config)#", true},
+		{"\nsw1(config-if)# ", true},
+		{"show clock\n*10:00:00.000 UTC Mon Oct 12 2026\n", false},
+		{"\nsw1#show clock", false},
+	} {
+		if promptPattern.MatchString(test.out) != test.prompt {
+			t.Fatalf("%q: expected %t", test.out, test.prompt)
+		}
+	}
+}
+
+func TestL2TConfigFrom(t *testing.T) {
+	for _, test := range []struct {
+		runningConfig string
+		showL2Trace   string
+		disabled      bool
+		state         L2TraceState
+		off           bool
+	}{
+		{"", "% Invalid input detected at '^' marker.\n", false, L2TraceUnsupported, false},
+		{"no l2 traceroute\n", "% Invalid input detected at '^' marker.\n", true, L2TraceUnsupported, true},
+		{"no l2 traceroute\n", "L2 trace server is not enabled\n", true, L2TraceDisabled, true},
+		{"no l2 traceroute\n", "L2 trace server is enabled\n", true, L2TraceEnabled, false},
+		{"", "L2 trace server is enabled\n", false, L2TraceEnabled, false},
+		{"", "something else\n", false, L2TraceUnknown, false},
+	} {
+		c := l2tConfigFrom(test.runningConfig, test.showL2Trace)
+		if c.Disabled != test.disabled || c.L2TraceState != test.state || c.Off() != test.off {
+			t.Fatalf("%q, %q: unexpected result %+v", test.runningConfig, test.showL2Trace, c)
+		}
+		if (c.ShowL2Trace == "") != (test.state == L2TraceUnsupported) {
+			t.Fatalf("%q: unexpected ShowL2Trace %q", test.showL2Trace, c.ShowL2Trace)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package foozler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// promptTimeout is how long we wait for the switch to prompt for
+	// the next command.
+	promptTimeout = 30 * time.Second
+)
+
+// promptPattern matches an IOS prompt at the end of the output: the
+// hostname, maybe a mode in parentheses, then '>' or '#'.
+var promptPattern = regexp.MustCompile(`(^|\n)[\w.\-]+(\([\w.\-]+\))?[>#] ?$`)
+
+// errNoPrompt is returned when the switch doesn't prompt for the next
+// command in time.
+var errNoPrompt = errors.New("timed out waiting for a prompt")
+
+// cli talks to an interactive IOS shell, one command at a time.
+type cli struct {
+	in      io.Writer
+	timeout time.Duration
+	lock    sync.Mutex
+	buf     bytes.Buffer  // output not yet claimed by a command
+	readErr error         // why reading stopped
+	changed chan struct{} // signals that buf or readErr changed
+}
+
+// newCli starts reading the shell's output. It keeps reading until out
+// returns an error, so the shell never blocks on a full pipe.
+func newCli(in io.Writer, out io.Reader, timeout time.Duration) *cli {
+	c := &cli{
+		in:      in,
+		timeout: timeout,
+		changed: make(chan struct{}, 1),
+	}
+	go c.read(out)
+	return c
+}
+
+func (o *cli) read(out io.Reader) {
+	b := make([]byte, 4096)
+	for {
+		n, err := out.Read(b)
+		o.lock.Lock()
+		o.buf.Write(bytes.Replace(b[:n], []byte("\r"), nil, -1))
+		if err != nil {
+			o.readErr = err
+		}
+		o.lock.Unlock()
+
+		select {
+		case o.changed <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// waitForPrompt waits for the switch to print a prompt, then returns
+// everything it printed before the prompt.
+func (o *cli) waitForPrompt() (string, error) {
+	deadline := time.NewTimer(o.timeout)
+	defer deadline.Stop()
+	for {
+		o.lock.Lock()
+		s := o.buf.String()
+		if loc := promptPattern.FindStringIndex(s); loc != nil {
+			o.buf.Reset()
+			o.lock.Unlock()
+			return s[:loc[0]], nil
+		}
+		readErr := o.readErr
+		o.lock.Unlock()
+
+		if readErr != nil {
+			return s, fmt.Errorf("session ended before the switch prompted: %w", readErr)
+		}
+
+		select {
+		case <-o.changed:
+		case <-deadline.C:
+			return s, errNoPrompt
+		}
+	}
+}
+
+// command sends a command once the switch has prompted for it, and
+// returns its output. The switch's echo of the command is left out.
+func (o *cli) command(c string) (string, error) {
+	_, err := io.WriteString(o.in, c+"\r\n")
+	if err != nil {
+		return "", err
+	}
+
+	out, err := o.waitForPrompt()
+	if err != nil {
+		return out, fmt.Errorf("%s: %w", c, err)
+	}
+
+	lines := strings.SplitN(out, "\n", 2)
+	if strings.Contains(lines[0], c) {
+		if len(lines) == 1 {
+			return "", nil
+		}
+		return lines[1], nil
+	}
+	return out, nil
+}
+
+// converse waits for the switch's first prompt, then runs each command
+// in turn, waiting for the prompt before sending the next one. It returns
+// the output of each command.
+func converse(c *cli, commands []string) ([]string, error) {
+	var outputs []string
+	_, err := c.waitForPrompt()
+	if err != nil {
+		return outputs, err
+	}
+
+	for _, command := range commands {
+		out, err := c.command(command)
+		if err != nil {
+			return outputs, err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,199 @@
+package foozler
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"sync"
+)
+
+// TaggedOutput is a line of debug output, tagged with the
+// name of the switch that produced it.
+type TaggedOutput struct {
+	Switch string
+	Line   string
+}
+
+// SwitchError describes a switch that could not be connected to, or
+// whose session ended abnormally.
+type SwitchError struct {
+	Switch string
+	Err    error
+}
+
+func (o SwitchError) Error() string {
+	return fmt.Sprintf("%s: %s", o.Switch, o.Err.Error())
+}
+
+// DebugeeGroup manages debug sessions on several switches at once, and
+// merges their output into a single stream.
+type DebugeeGroup struct {
+	lock     sync.Mutex
+	debugees map[string]*Debugee
+	enabled  bool
+	out      chan TaggedOutput
+	errs     chan SwitchError
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// ConnectToAll concurrently connects to each of the named switches via SSH
+// to facilitate debugging. It returns immediately. Connection failures are
+// reported via Errors().
+func ConnectToAll(switches []string, port int, clientConfig *ssh.ClientConfig) *DebugeeGroup {
+	g := &DebugeeGroup{
+		debugees: make(map[string]*Debugee),
+		out:      make(chan TaggedOutput),
+		errs:     make(chan SwitchError, len(switches)),
+		stop:     make(chan struct{}),
+	}
+
+	g.wg.Add(len(switches))
+	for _, s := range switches {
+		go g.run(s, port, clientConfig)
+	}
+
+	// Close the output channels once every session has finished.
+	go func() {
+		g.wg.Wait()
+		close(g.out)
+		close(g.errs)
+	}()
+
+	return g
+}
+
+// run connects to a single switch and forwards its output until the
+// session ends or the group is closed.
+func (o *DebugeeGroup) run(name string, port int, clientConfig *ssh.ClientConfig) {
+	defer o.wg.Done()
+
+	d, err := ConnectTo(name, port, clientConfig)
+	if err != nil {
+		o.errs <- SwitchError{Switch: name, Err: err}
+		return
+	}
+
+	// Register the new session, unless the group was closed while we
+	// were connecting.
+	o.lock.Lock()
+	select {
+	case <-o.stop:
+		o.lock.Unlock()
+		closeDebugee(d)
+		return
+	default:
+	}
+	o.debugees[name] = d
+	o.lock.Unlock()
+
+	// Output from the switch always flows. The group's enabled state is
+	// applied as we forward it, so that toggling it never blocks.
+	d.Enable()
+
+	defer func() {
+		o.lock.Lock()
+		delete(o.debugees, name)
+		o.lock.Unlock()
+	}()
+
+	for {
+		select {
+		case err := <-d.Wait():
+			if err != nil {
+				o.errs <- SwitchError{Switch: name, Err: err}
+			}
+			closeDebugee(d)
+			return
+		case s := <-d.Output():
+			if !o.isEnabled() {
+				continue
+			}
+			select {
+			case o.out <- TaggedOutput{Switch: name, Line: s}:
+			case <-o.stop:
+				closeDebugee(d)
+				return
+			}
+		case <-o.stop:
+			closeDebugee(d)
+			return
+		}
+	}
+}
+
+// closeDebugee closes a Debugee, draining its output so that the
+// session's goroutine can't block on delivery while we wait for it.
+func closeDebugee(d *Debugee) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-d.Output():
+			case <-done:
+				return
+			}
+		}
+	}()
+	d.Close()
+	close(done)
+}
+
+// Enable enables output from every switch in the group, including
+// those that have not finished connecting yet.
+func (o *DebugeeGroup) Enable() {
+	o.setEnabled(true)
+}
+
+// Disable disables output from every switch in the group.
+func (o *DebugeeGroup) Disable() {
+	o.setEnabled(false)
+}
+
+func (o *DebugeeGroup) setEnabled(enabled bool) {
+	o.lock.Lock()
+	o.enabled = enabled
+	o.lock.Unlock()
+}
+
+func (o *DebugeeGroup) isEnabled() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.enabled
+}
+
+// Output returns a channel that receives debug output from all of the
+// switches when output is enabled. The channel is closed when every
+// session has ended.
+func (o *DebugeeGroup) Output() <-chan TaggedOutput {
+	return o.out
+}
+
+// Errors returns a channel that receives connection failures and abnormal
+// session endings. The channel is closed when every session has ended.
+func (o *DebugeeGroup) Errors() <-chan SwitchError {
+	return o.errs
+}
+
+// Connected returns the names of the switches with active sessions.
+func (o *DebugeeGroup) Connected() []string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var out []string
+	for name := range o.debugees {
+		out = append(out, name)
+	}
+	return out
+}
+
+// Close closes every SSH session in the group. It waits for connection
+// attempts which are still in progress to finish (subject to the
+// ssh.ClientConfig Timeout), then closes those sessions as well.
+func (o *DebugeeGroup) Close() {
+	o.stopOnce.Do(func() {
+		o.lock.Lock()
+		close(o.stop)
+		o.lock.Unlock()
+	})
+	o.wg.Wait()
+}
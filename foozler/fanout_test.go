@@ -0,0 +1,52 @@
+package foozler
+
+import (
+	"golang.org/x/crypto/ssh"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectToAllUnreachable(t *testing.T) {
+	// Grab a local port, then close it so that nobody is listening there.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	err = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            "nobody",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Second,
+	}
+
+	switches := []string{"127.0.0.1", "localhost"}
+	g := ConnectToAll(switches, port, config)
+	g.Enable()
+
+	var errCount int
+	for e := range g.Errors() {
+		errCount++
+		if e.Switch != switches[0] && e.Switch != switches[1] {
+			t.Fatalf("unexpected switch name in error: %s", e.Error())
+		}
+	}
+	if errCount != len(switches) {
+		t.Fatalf("expected %d errors, got %d", len(switches), errCount)
+	}
+
+	for o := range g.Output() {
+		t.Fatalf("unexpected output: %v", o)
+	}
+
+	if len(g.Connected()) != 0 {
+		t.Fatalf("expected no connected switches")
+	}
+
+	g.Close()
+}
@@ -60,9 +60,14 @@ func (o *Debugee) Execute(command string) error {
 	return nil
 }
 
+// dial opens an SSH connection to a Cisco switch.
+func dial(address string, port int, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	return ssh.Dial("tcp", fmt.Sprintf("%s:%d", address, port), clientConfig)
+}
+
 // ConnectTo connects to a Cisco switch via SSH to facilitate debugging.
 func ConnectTo(address string, port int, clientConfig *ssh.ClientConfig) (*Debugee, error) {
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", address, port), clientConfig)
+	client, err := dial(address, port, clientConfig)
 	if err != nil {
 		return nil, err
 	}
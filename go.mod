@@ -1,9 +1,11 @@
 module github.com/chrismarget/cisco-l2t
 
-go 1.12
+go 1.13
 
 require (
-	github.com/cheggaaa/pb/v3 v3.0.1 // indirect
-	github.com/stephen-fox/sshutil v0.0.1 // indirect
-	golang.org/x/crypto v0.0.0-20190820162420-60c769a6c586
+	github.com/cheggaaa/pb/v3 v3.0.1
+	github.com/stephen-fox/sshutil v0.0.1
+	github.com/stephen-fox/userutil v1.0.0
+	golang.org/x/crypto v0.1.0
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,139 @@
+package inventory
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Kinds of Change.
+const (
+	ChangeReachability    = "reachability"
+	ChangeVlanAdded       = "vlan_added"
+	ChangeVlanRemoved     = "vlan_removed"
+	ChangeName            = "name"
+	ChangePlatform        = "platform"
+	ChangeMgmtIp          = "mgmt_ip"
+	ChangeNeighborAdded   = "neighbor_added"
+	ChangeNeighborRemoved = "neighbor_removed"
+)
+
+// Change describes one difference between two Snapshots of a switch.
+type Change struct {
+	Switch string    `json:"switch"`
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Old    string    `json:"old,omitempty"`
+	New    string    `json:"new,omitempty"`
+}
+
+func (o Change) String() string {
+	switch o.Kind {
+	case ChangeVlanAdded, ChangeNeighborAdded:
+		return fmt.Sprintf("%s: %s %s", o.Switch, o.Kind, o.New)
+	case ChangeVlanRemoved, ChangeNeighborRemoved:
+		return fmt.Sprintf("%s: %s %s", o.Switch, o.Kind, o.Old)
+	}
+	return fmt.Sprintf("%s: %s changed from `%s' to `%s'", o.Switch, o.Kind, o.Old, o.New)
+}
+
+// Changes returns the changes shown by a new Snapshot of a switch.
+// Reachability is compared with previous, the switch's latest Snapshot,
+// and everything else with baseline, its latest reachable one, so that
+// changes made while the switch was unreachable are still reported. newer
+// should already have been through Carry().
+func Changes(previous Snapshot, baseline Snapshot, newer Snapshot) []Change {
+	var out []Change
+	if previous.Reachable != newer.Reachable {
+		out = append(out, Change{
+			Switch: newer.Switch,
+			Time:   newer.Time,
+			Kind:   ChangeReachability,
+			Old:    strconv.FormatBool(previous.Reachable),
+			New:    strconv.FormatBool(newer.Reachable),
+		})
+	}
+	if baseline.Reachable && newer.Reachable {
+		out = append(out, Diff(baseline, newer)...)
+	}
+	return out
+}
+
+// Diff returns the changes between two Snapshots of a switch. Nothing
+// beyond reachability is compared when either Snapshot is of an
+// unreachable switch. Removals are only reported when the newer snapshot
+// got answers to the relevant queries.
+func Diff(older Snapshot, newer Snapshot) []Change {
+	var out []Change
+	change := func(kind string, o string, n string) {
+		out = append(out, Change{
+			Switch: newer.Switch,
+			Time:   newer.Time,
+			Kind:   kind,
+			Old:    o,
+			New:    n,
+		})
+	}
+
+	if older.Reachable != newer.Reachable {
+		change(ChangeReachability, strconv.FormatBool(older.Reachable), strconv.FormatBool(newer.Reachable))
+	}
+	if !older.Reachable || !newer.Reachable {
+		return out
+	}
+
+	if older.Name != newer.Name {
+		change(ChangeName, older.Name, newer.Name)
+	}
+	if older.Platform != newer.Platform {
+		change(ChangePlatform, older.Platform, newer.Platform)
+	}
+	if older.MgmtIp != newer.MgmtIp {
+		change(ChangeMgmtIp, older.MgmtIp, newer.MgmtIp)
+	}
+
+	oldVlans := make(map[int]bool)
+	for _, v := range older.Vlans {
+		oldVlans[v] = true
+	}
+	newVlans := make(map[int]bool)
+	for _, v := range newer.Vlans {
+		newVlans[v] = true
+		if !oldVlans[v] {
+			change(ChangeVlanAdded, "", strconv.Itoa(v))
+		}
+	}
+	for _, v := range older.Vlans {
+		if !newVlans[v] && newer.vlanAnswered(v) {
+			change(ChangeVlanRemoved, strconv.Itoa(v), "")
+		}
+	}
+
+	oldNeighbors := make(map[string]Neighbor)
+	for _, n := range older.Neighbors {
+		oldNeighbors[n.Ip] = n
+	}
+	newNeighbors := make(map[string]Neighbor)
+	for _, n := range newer.Neighbors {
+		newNeighbors[n.Ip] = n
+		if _, ok := oldNeighbors[n.Ip]; !ok {
+			change(ChangeNeighborAdded, "", n.String())
+		}
+	}
+	if newer.VlansComplete && newer.ProbesOk {
+		for _, n := range older.Neighbors {
+			if _, ok := newNeighbors[n.Ip]; !ok {
+				change(ChangeNeighborRemoved, n.String(), "")
+			}
+		}
+	}
+
+	return out
+}
+
+func (o Neighbor) String() string {
+	if o.DevId == "" {
+		return o.Ip
+	}
+	return o.Ip + " (" + o.DevId + ")"
+}
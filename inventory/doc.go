@@ -0,0 +1,3 @@
+// Package inventory takes periodic snapshots of switches (VLANs, identity
+// and CDP neighbors), stores them, and reports what changed between them.
+package inventory
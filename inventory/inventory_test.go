@@ -0,0 +1,226 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		Switch:        "192.0.2.1",
+		Time:          time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+		Reachable:     true,
+		Name:          "sw1",
+		Platform:      "cisco WS-C3560",
+		MgmtIp:        "192.0.2.1",
+		Vlans:         []int{1, 10, 20},
+		VlansComplete: true,
+		Neighbors:     []Neighbor{{Ip: "192.0.2.2", DevId: "sw2"}},
+		ProbesOk:      true,
+	}
+}
+
+func kinds(changes []Change) []string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, c.Kind+" "+c.Old+"/"+c.New)
+	}
+	return out
+}
+
+func TestDiff(t *testing.T) {
+	older := testSnapshot()
+
+	if len(Diff(older, testSnapshot())) != 0 {
+		t.Fatal("identical snapshots should produce no changes")
+	}
+
+	newer := testSnapshot()
+	newer.Name = "sw1-new"
+	newer.MgmtIp = "192.0.2.9"
+	newer.Vlans = []int{1, 20, 30}
+	newer.Neighbors = []Neighbor{{Ip: "192.0.2.3"}}
+	expected := []string{
+		"name sw1/sw1-new",
+		"mgmt_ip 192.0.2.1/192.0.2.9",
+		"vlan_added /30",
+		"vlan_removed 10/",
+		"neighbor_added /192.0.2.3",
+		"neighbor_removed 192.0.2.2 (sw2)/",
+	}
+	if !reflect.DeepEqual(kinds(Diff(older, newer)), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(Diff(older, newer)))
+	}
+
+	// incomplete answers shouldn't report removals
+	newer.VlansComplete = false
+	expected = []string{
+		"name sw1/sw1-new",
+		"mgmt_ip 192.0.2.1/192.0.2.9",
+		"vlan_added /30",
+		"neighbor_added /192.0.2.3",
+	}
+	if !reflect.DeepEqual(kinds(Diff(older, newer)), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(Diff(older, newer)))
+	}
+
+	// unreachable switch: only reachability is reported
+	gone := Snapshot{Switch: older.Switch}
+	expected = []string{"reachability true/false"}
+	if !reflect.DeepEqual(kinds(Diff(older, gone)), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(Diff(older, gone)))
+	}
+}
+
+func TestDiffIncomplete(t *testing.T) {
+	baseline := testSnapshot()
+
+	// VLAN 10's query times out: it's carried forward, not removed
+	timedOut := testSnapshot()
+	timedOut.Vlans = []int{1, 20}
+	timedOut.VlansComplete = false
+	timedOut.VlansUnknown = []int{10}
+	timedOut.Neighbors = []Neighbor{}
+	carried := Carry(baseline, timedOut)
+	if changes := Diff(baseline, carried); len(changes) != 0 {
+		t.Fatalf("unanswered queries produced changes: %v", kinds(changes))
+	}
+	if !reflect.DeepEqual(carried.Vlans, []int{1, 10, 20}) || len(carried.Neighbors) != 1 {
+		t.Fatalf("nothing carried forward: %+v", carried)
+	}
+
+	// the next complete pass finds VLAN 10 again: no spurious addition
+	complete := testSnapshot()
+	if changes := Diff(carried, Carry(carried, complete)); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", kinds(changes))
+	}
+
+	// or finds it gone: the removal isn't missed
+	complete.Vlans = []int{1, 20}
+	expected := []string{"vlan_removed 10/"}
+	if changes := Diff(carried, Carry(carried, complete)); !reflect.DeepEqual(kinds(changes), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(changes))
+	}
+
+	// a VLAN which went away while other queries timed out is still
+	// reported
+	partial := testSnapshot()
+	partial.Vlans = []int{1}
+	partial.VlansComplete = false
+	partial.VlansUnknown = []int{10}
+	expected = []string{"vlan_removed 20/"}
+	if changes := Diff(baseline, Carry(baseline, partial)); !reflect.DeepEqual(kinds(changes), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(changes))
+	}
+}
+
+func TestChangesAfterOutage(t *testing.T) {
+	baseline := testSnapshot()
+	gone := Snapshot{Switch: baseline.Switch, Time: baseline.Time.Add(time.Hour)}
+
+	expected := []string{"reachability true/false"}
+	if changes := Changes(baseline, baseline, gone); !reflect.DeepEqual(kinds(changes), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(changes))
+	}
+	if changes := Changes(gone, baseline, gone); len(changes) != 0 {
+		t.Fatalf("still unreachable shouldn't be reported again: %v", kinds(changes))
+	}
+
+	// VLAN 10 was removed while we couldn't see the switch
+	back := testSnapshot()
+	back.Vlans = []int{1, 20}
+	expected = []string{"reachability false/true", "vlan_removed 10/"}
+	if changes := Changes(gone, baseline, Carry(baseline, back)); !reflect.DeepEqual(kinds(changes), expected) {
+		t.Fatalf("expected %v, got %v", expected, kinds(changes))
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok, err := store.Latest("192.0.2.1")
+	if err != nil || ok {
+		t.Fatalf("empty store should have no snapshot: %t %v", ok, err)
+	}
+
+	first := testSnapshot()
+	second := testSnapshot()
+	second.Vlans = []int{1}
+	for _, s := range []Snapshot{first, second} {
+		err = store.Save(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, ok, err := store.Latest("192.0.2.1")
+	if err != nil || !ok {
+		t.Fatalf("expected a snapshot: %t %v", ok, err)
+	}
+	if !reflect.DeepEqual(latest, second) {
+		t.Fatalf("expected %+v, got %+v", second, latest)
+	}
+
+	history, err := store.History("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || !reflect.DeepEqual(history[0], first) {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	err = store.RecordChanges(Diff(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unreachable snapshots don't replace the baseline
+	gone := Snapshot{Switch: first.Switch}
+	err = store.Save(gone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, _, err = store.Latest("192.0.2.1")
+	if err != nil || latest.Reachable {
+		t.Fatalf("expected the unreachable snapshot: %+v %v", latest, err)
+	}
+	baseline, ok, err := store.Baseline("192.0.2.1")
+	if err != nil || !ok || !reflect.DeepEqual(baseline, second) {
+		t.Fatalf("expected %+v, got %+v (%t %v)", second, baseline, ok, err)
+	}
+
+	// a store without a baseline falls back to the latest reachable
+	// snapshot
+	err = os.Remove(filepath.Join(store.switchDir("192.0.2.1"), baselineFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = store.Baseline("192.0.2.1")
+	if err != nil || ok {
+		t.Fatalf("unreachable latest snapshot isn't a baseline: %t %v", ok, err)
+	}
+
+	v6 := testSnapshot()
+	v6.Switch = "2001:db8::1"
+	err = store.Save(v6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = store.Latest("2001:db8::1")
+	if err != nil || !ok {
+		t.Fatalf("expected an IPv6 snapshot: %t %v", ok, err)
+	}
+}
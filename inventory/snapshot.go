@@ -0,0 +1,229 @@
+package inventory
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"github.com/chrismarget/cisco-l2t/target"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	vlanMin = 1
+	vlanMax = 4094
+)
+
+// Probe names a MAC address and VLAN to ask a switch about. When the MAC
+// lives behind a CDP neighbor, the reply reveals that neighbor.
+type Probe struct {
+	Mac  string `json:"mac" yaml:"mac"`
+	Vlan int    `json:"vlan" yaml:"vlan"`
+}
+
+// Switch describes a switch to be inventoried.
+type Switch struct {
+	Address string  `json:"address" yaml:"address"`
+	Probes  []Probe `json:"probes,omitempty" yaml:"probes,omitempty"`
+}
+
+// Neighbor is a CDP neighbor revealed by a reply.
+type Neighbor struct {
+	Ip    string `json:"ip"`
+	DevId string `json:"dev_id,omitempty"`
+}
+
+// Snapshot is the state of a switch at a point in time.
+type Snapshot struct {
+	Switch        string     `json:"switch"`
+	Time          time.Time  `json:"time"`
+	Reachable     bool       `json:"reachable"`
+	Name          string     `json:"name,omitempty"`
+	Platform      string     `json:"platform,omitempty"`
+	MgmtIp        string     `json:"mgmt_ip,omitempty"`
+	Vlans         []int      `json:"vlans"`
+	VlansComplete bool       `json:"vlans_complete"`          // every VLAN query was answered
+	VlansUnknown  []int      `json:"vlans_unknown,omitempty"` // VLAN queries which weren't answered
+	Neighbors     []Neighbor `json:"neighbors"`
+	ProbesOk      bool       `json:"probes_ok"` // every neighbor probe was answered
+	Errors        []string   `json:"errors,omitempty"`
+}
+
+// Collect builds a target for the switch and takes a Snapshot of it.
+// Problems talking to the switch are recorded in the Snapshot rather
+// than returned.
+func Collect(sw Switch, newBuilder func() target.Builder) Snapshot {
+	s := Snapshot{
+		Switch:    sw.Address,
+		Time:      time.Now(),
+		Vlans:     []int{},
+		Neighbors: []Neighbor{},
+	}
+
+	ip := net.ParseIP(sw.Address)
+	if ip == nil {
+		s.Errors = append(s.Errors, fmt.Sprintf("cannot parse address `%s'", sw.Address))
+		return s
+	}
+
+	t, err := newBuilder().AddIp(ip).Build()
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+		return s
+	}
+
+	p := t.Profile()
+	s.Reachable = true
+	s.Name = p.Name
+	s.Platform = p.Platform
+	if p.MgmtIp != nil {
+		s.MgmtIp = p.MgmtIp.String()
+	}
+
+	neighbors := make(map[string]Neighbor)
+	s.Vlans, s.VlansUnknown, err = vlans(t, neighbors)
+	s.VlansComplete = err == nil && len(s.VlansUnknown) == 0
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+
+	s.ProbesOk = true
+	for _, probe := range sw.Probes {
+		err := probeNeighbor(t, probe, neighbors)
+		if err != nil {
+			s.ProbesOk = false
+			s.Errors = append(s.Errors, fmt.Sprintf("probe %s vlan %d: %s", probe.Mac, probe.Vlan, err))
+		}
+	}
+
+	for _, n := range neighbors {
+		s.Neighbors = append(s.Neighbors, n)
+	}
+	sort.Slice(s.Neighbors, func(i, j int) bool {
+		return s.Neighbors[i].Ip < s.Neighbors[j].Ip
+	})
+
+	return s
+}
+
+// vlans asks the target about every VLAN. It returns the VLANs found, and
+// the VLANs whose queries weren't answered.
+func vlans(t target.Target, neighbors map[string]Neighbor) ([]int, []int, error) {
+	results, err := target.SweepVlans(t, vlanMin, vlanMax, nil)
+	if err != nil {
+		return []int{}, nil, err
+	}
+
+	found := []int{}
+	var unknown []int
+	for _, r := range results {
+		if r.Reply != nil {
+			noteNeighbor(r.Reply, neighbors)
+		}
+		switch {
+		case r.Err != nil:
+			unknown = append(unknown, r.Vlan)
+		case r.Found:
+			found = append(found, r.Vlan)
+		}
+	}
+
+	return found, unknown, nil
+}
+
+// vlanAnswered returns a boolean indicating whether the Snapshot's query
+// about the VLAN was answered.
+func (o Snapshot) vlanAnswered(vlan int) bool {
+	if o.VlansComplete {
+		return true
+	}
+	if len(o.VlansUnknown) == 0 {
+		// the sweep failed outright: nothing was answered
+		return false
+	}
+	for _, v := range o.VlansUnknown {
+		if v == vlan {
+			return false
+		}
+	}
+	return true
+}
+
+// Carry fills in what newer couldn't find out from baseline, the switch's
+// previous reachable Snapshot: VLANs whose queries went unanswered keep
+// their old state, and when some queries went unanswered, neighbors
+// which weren't seen again are kept. Diffing the result against baseline
+// then reports neither spurious additions nor missed removals. An
+// unreachable newer Snapshot is returned as is.
+func Carry(baseline Snapshot, newer Snapshot) Snapshot {
+	if !baseline.Reachable || !newer.Reachable {
+		return newer
+	}
+
+	out := newer
+	out.Vlans = append([]int{}, newer.Vlans...)
+	for _, v := range baseline.Vlans {
+		if !newer.vlanAnswered(v) {
+			out.Vlans = append(out.Vlans, v)
+		}
+	}
+	sort.Ints(out.Vlans)
+
+	if !newer.VlansComplete || !newer.ProbesOk {
+		seen := make(map[string]bool)
+		for _, n := range newer.Neighbors {
+			seen[n.Ip] = true
+		}
+		out.Neighbors = append([]Neighbor{}, newer.Neighbors...)
+		for _, n := range baseline.Neighbors {
+			if !seen[n.Ip] {
+				out.Neighbors = append(out.Neighbors, n)
+			}
+		}
+		sort.Slice(out.Neighbors, func(i, j int) bool {
+			return out.Neighbors[i].Ip < out.Neighbors[j].Ip
+		})
+	}
+
+	return out
+}
+
+// probeNeighbor asks the target about a MAC address, noting any
+// neighbor revealed in the reply.
+func probeNeighbor(t target.Target, probe Probe, neighbors map[string]Neighbor) error {
+	builder := message.NewMsgBuilder().SetType(message.RequestSrc)
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.SrcMacType, "ffff.ffff.ffff"},
+		{attribute.DstMacType, probe.Mac},
+		{attribute.VlanType, fmt.Sprintf("%d", probe.Vlan)},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			return err
+		}
+		builder.SetAttr(att)
+	}
+
+	reply, err := t.Send(builder.Build())
+	if err != nil {
+		return err
+	}
+	noteNeighbor(reply, neighbors)
+	return nil
+}
+
+func noteNeighbor(reply message.Msg, neighbors map[string]Neighbor) {
+	ip := reply.GetAttr(attribute.NbrIPv4Type)
+	if ip == nil {
+		return
+	}
+	n := Neighbor{Ip: ip.String()}
+	if id := reply.GetAttr(attribute.NbrDevIDType); id != nil {
+		n.DevId = id.String()
+	}
+	neighbors[n.Ip] = n
+}
@@ -0,0 +1,177 @@
+package inventory
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	latestFileName   = "latest.json"
+	baselineFileName = "baseline.json"
+	historyFileName  = "history.jsonl"
+	changesFileName  = "changes.jsonl"
+)
+
+// Store keeps Snapshots and Changes in a directory. Each switch gets a
+// subdirectory holding its latest Snapshot, its latest reachable Snapshot
+// (the baseline for finding changes) and a history of every Snapshot
+// (one JSON document per line). Changes to all switches are
+// appended to a single log.
+type Store struct {
+	dir string
+}
+
+// OpenStore returns a Store using dir, which is created if necessary.
+func OpenStore(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// switchDir returns the directory for a switch. Characters which don't
+// belong in a file name (IPv6 colons, mostly) are replaced.
+func (o *Store) switchDir(sw string) string {
+	return filepath.Join(o.dir, strings.Map(func(r rune) rune {
+		if r == ':' || r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, sw))
+}
+
+// Latest returns the most recent Snapshot of the switch, and a boolean
+// indicating whether there was one.
+func (o *Store) Latest(sw string) (Snapshot, bool, error) {
+	return o.read(sw, latestFileName)
+}
+
+// Baseline returns the most recent Snapshot in which the switch was
+// reachable, and a boolean indicating whether there was one.
+func (o *Store) Baseline(sw string) (Snapshot, bool, error) {
+	s, ok, err := o.read(sw, baselineFileName)
+	if ok || err != nil {
+		return s, ok, err
+	}
+
+	// stores written before baselines were kept
+	s, ok, err = o.Latest(sw)
+	if err != nil || !s.Reachable {
+		return Snapshot{}, false, err
+	}
+	return s, ok, nil
+}
+
+func (o *Store) read(sw string, filename string) (Snapshot, bool, error) {
+	var s Snapshot
+	b, err := ioutil.ReadFile(filepath.Join(o.switchDir(sw), filename))
+	if os.IsNotExist(err) {
+		return s, false, nil
+	}
+	if err != nil {
+		return s, false, err
+	}
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return s, false, err
+	}
+	return s, true, nil
+}
+
+// History returns every Snapshot of the switch, oldest first.
+func (o *Store) History(sw string) ([]Snapshot, error) {
+	f, err := os.Open(filepath.Join(o.switchDir(sw), historyFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Snapshot
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var s Snapshot
+		err := json.Unmarshal(scanner.Bytes(), &s)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, s)
+	}
+	return out, scanner.Err()
+}
+
+// Save records the Snapshot as the latest for its switch (and as the
+// baseline, if the switch was reachable), and adds it to the switch's
+// history.
+func (o *Store) Save(s Snapshot) error {
+	dir := o.switchDir(s.Switch)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = appendLine(filepath.Join(dir, historyFileName), b)
+	if err != nil {
+		return err
+	}
+
+	if s.Reachable {
+		err = writeFile(filepath.Join(dir, baselineFileName), b)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFile(filepath.Join(dir, latestFileName), b)
+}
+
+// writeFile writes then renames, so that a crash can't leave us with
+// half a file.
+func writeFile(filename string, b []byte) error {
+	tmp := filename + ".tmp"
+	err := ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// RecordChanges appends the Changes to the change log.
+func (o *Store) RecordChanges(changes []Change) error {
+	for _, c := range changes {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		err = appendLine(filepath.Join(o.dir, changesFileName), b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendLine(filename string, b []byte) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
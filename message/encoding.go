@@ -0,0 +1,121 @@
+package message
+
+import (
+	"encoding/json"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"strconv"
+)
+
+// MsgDoc is the JSON / YAML representation of a Msg. Type is the
+// MsgTypeToString name (or a number, for unknown types). Attributes
+// appear in wire order.
+type MsgDoc struct {
+	Type       string              `json:"type" yaml:"type"`
+	Version    MsgVer              `json:"version" yaml:"version"`
+	Attributes []attribute.AttrDoc `json:"attributes" yaml:"attributes"`
+}
+
+// NewMsgDoc returns the MsgDoc representation of a Msg.
+func NewMsgDoc(m Msg) MsgDoc {
+	doc := MsgDoc{
+		Type:    MsgTypeToString[m.Type()],
+		Version: m.Ver(),
+	}
+	if doc.Type == "" {
+		doc.Type = strconv.Itoa(int(m.Type()))
+	}
+
+	ordered := orderAttributes(attribute.SortAttributes(m.Attributes()), m.Type())
+	for _, a := range ordered {
+		doc.Attributes = append(doc.Attributes, attribute.NewAttrDoc(a))
+	}
+	return doc
+}
+
+// Msg returns the Msg described by the MsgDoc.
+func (o MsgDoc) Msg() (Msg, error) {
+	t, err := MsgStringToType(o.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewMsgBuilder().SetType(t).SetVer(o.Version)
+	seen := make(map[attribute.AttrType]bool)
+	for i, ad := range o.Attributes {
+		a, err := ad.Attribute()
+		if err != nil {
+			return nil, &MsgError{
+				Kind:   ErrBadAttr,
+				Offset: -1,
+				Msg:    "attribute " + strconv.Itoa(i),
+				Err:    err,
+			}
+		}
+		if seen[a.Type()] {
+			e := newMsgError(ErrDuplicateAttr, -1, "attribute type %d (%s) repeats in message", a.Type(), attribute.AttrTypeString[a.Type()])
+			e.AttrType = a.Type()
+			return nil, e
+		}
+		seen[a.Type()] = true
+		builder.SetAttr(a)
+	}
+
+	return builder.Build(), nil
+}
+
+// MsgStringToType attempts to convert a string to a MsgType.
+// You can give it a string-y number ("2") or a known MsgType
+// label ("L2T_REQUEST_SRC").
+func MsgStringToType(in string) (MsgType, error) {
+	i, err := strconv.ParseUint(in, 10, 8)
+	if err == nil {
+		return MsgType(i), nil
+	}
+	for t, s := range MsgTypeToString {
+		if s == in {
+			return t, nil
+		}
+	}
+	return 0, newMsgError(ErrBadType, -1, "unknown message type `%s'", in)
+}
+
+// UnmarshalMessageJSON returns the Msg described by a JSON format MsgDoc.
+func UnmarshalMessageJSON(b []byte) (Msg, error) {
+	var doc MsgDoc
+	err := json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Msg()
+}
+
+func (o *defaultMsg) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewMsgDoc(o))
+}
+
+func (o *defaultMsg) UnmarshalJSON(b []byte) error {
+	m, err := UnmarshalMessageJSON(b)
+	if err != nil {
+		return err
+	}
+	*o = *m.(*defaultMsg)
+	return nil
+}
+
+func (o *defaultMsg) MarshalYAML() (interface{}, error) {
+	return NewMsgDoc(o), nil
+}
+
+func (o *defaultMsg) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var doc MsgDoc
+	err := unmarshal(&doc)
+	if err != nil {
+		return err
+	}
+	m, err := doc.Msg()
+	if err != nil {
+		return err
+	}
+	*o = *m.(*defaultMsg)
+	return nil
+}
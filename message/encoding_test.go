@@ -0,0 +1,78 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestMsgJSONRoundTrip(t *testing.T) {
+	wire := []byte{
+		3, 1, 0, 33, 5,
+		byte(attribute.DevNameType), 5, 's', 'w', 0,
+		byte(attribute.DevIPv4Type), 6, 192, 0, 2, 1,
+		byte(attribute.ReplyStatusType), 3, 1,
+		byte(attribute.InPortDuplexType), 3, 2,
+		byte(attribute.InPortSpeedType), 6, 0, 0, 0, 3,
+		byte(attribute.VlanType), 4, 0, 10,
+	}
+	wire[3] = byte(len(wire))
+	wire[4] = 6
+
+	msg, err := UnmarshalMessage(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := UnmarshalMessageJSON(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Marshal(nil), fromJSON.Marshal(nil)) {
+		t.Fatalf("JSON round trip %s: expected %v, got %v", j, msg.Marshal(nil), fromJSON.Marshal(nil))
+	}
+
+	y, err := yaml.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc MsgDoc
+	err = yaml.Unmarshal(y, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYAML, err := doc.Msg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Marshal(nil), fromYAML.Marshal(nil)) {
+		t.Fatalf("YAML round trip %s: expected %v, got %v", y, msg.Marshal(nil), fromYAML.Marshal(nil))
+	}
+}
+
+func TestMsgJSONTestMsg(t *testing.T) {
+	msg, err := TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result defaultMsg
+	err = json.Unmarshal(j, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Marshal(nil), result.Marshal(nil)) {
+		t.Fatalf("expected %v, got %v", msg.Marshal(nil), result.Marshal(nil))
+	}
+}
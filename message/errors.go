@@ -0,0 +1,60 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+)
+
+// These values describe the kinds of problems reported by MsgError. Test
+// for them with errors.Is().
+var (
+	ErrUndersize         = errors.New("undersize message")
+	ErrOversize          = errors.New("oversize message")
+	ErrLengthMismatch    = errors.New("message length mismatch")
+	ErrAttrCountMismatch = errors.New("message attribute count mismatch")
+	ErrDuplicateAttr     = errors.New("duplicate attribute")
+	ErrTruncatedAttr     = errors.New("truncated attribute")
+	ErrBadAttr           = errors.New("bad attribute")
+	ErrBadType           = errors.New("unknown message type")
+)
+
+// MsgError describes a problem unmarshaling or validating a message. Kind
+// is one of the Err* values above, and satisfies errors.Is(). Offset is the
+// byte position within the wire format message where the problem was found
+// (-1 when not applicable). AttrType identifies the attribute involved,
+// if any. Err holds the underlying error, if there is one. Problems with
+// individual attributes wrap an *attribute.AttrError.
+type MsgError struct {
+	Kind     error
+	Offset   int
+	AttrType attribute.AttrType
+	Msg      string
+	Err      error
+}
+
+func (o *MsgError) Error() string {
+	if o.Err != nil {
+		return o.Msg + ": " + o.Err.Error()
+	}
+	return o.Msg
+}
+
+// Is returns a boolean indicating whether target matches the kind of error.
+func (o *MsgError) Is(target error) bool {
+	return target == o.Kind
+}
+
+// Unwrap returns the underlying error, if any.
+func (o *MsgError) Unwrap() error {
+	return o.Err
+}
+
+// newMsgError returns a *MsgError with a formatted message.
+func newMsgError(kind error, offset int, format string, a ...interface{}) *MsgError {
+	return &MsgError{
+		Kind:   kind,
+		Offset: offset,
+		Msg:    fmt.Sprintf(format, a...),
+	}
+}
@@ -0,0 +1,35 @@
+package message
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"testing"
+)
+
+func TestMsgError(t *testing.T) {
+	_, err := UnmarshalMessageUnsafe([]byte{1, 1, 0})
+	if !errors.Is(err, ErrUndersize) {
+		t.Fatalf("expected ErrUndersize, got %v", err)
+	}
+
+	// the attribute claims a length of 1, which is too short
+	b := []byte{1, 1, 0, 9, 1, byte(attribute.VlanType), 1, 0, 0}
+	_, err = UnmarshalMessageUnsafe(b)
+	if !errors.Is(err, ErrBadAttr) {
+		t.Fatalf("expected ErrBadAttr, got %v", err)
+	}
+	if !errors.Is(err, attribute.ErrLength) {
+		t.Fatalf("expected wrapped attribute.ErrLength, got %v", err)
+	}
+
+	var me *MsgError
+	if !errors.As(err, &me) {
+		t.Fatalf("expected *MsgError, got %T", err)
+	}
+	if me.Offset != 5 {
+		t.Fatalf("expected offset 5, got %d", me.Offset)
+	}
+	if me.AttrType != attribute.VlanType {
+		t.Fatalf("expected attribute type %d, got %d", attribute.VlanType, me.AttrType)
+	}
+}
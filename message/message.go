@@ -197,12 +197,12 @@ func (o *defaultMsg) Attributes() map[attribute.AttrType]attribute.Attribute {
 func (o *defaultMsg) Validate() error {
 	// undersize check
 	if o.Len() < headerLenByVersion[Version1] {
-		return fmt.Errorf("undersize message has %d bytes (min %d)", o.Len(), headerLenByVersion[Version1])
+		return newMsgError(ErrUndersize, -1, "undersize message has %d bytes (min %d)", o.Len(), headerLenByVersion[Version1])
 	}
 
 	// oversize check
 	if o.Len() > math.MaxUint16 {
-		return fmt.Errorf("oversize message has %d bytes (max %d)", o.Len(), math.MaxUint16)
+		return newMsgError(ErrOversize, -1, "oversize message has %d bytes (max %d)", o.Len(), math.MaxUint16)
 	}
 
 	// Look for duplicates, add up the length
@@ -212,7 +212,9 @@ func (o *defaultMsg) Validate() error {
 		observedLen += MsgLen(a.Len())
 		t := a.Type()
 		if _, ok := foundAttrs[a.Type()]; ok {
-			return fmt.Errorf("attribute type %d (%s) repeats in message", t, attribute.AttrTypeString[t])
+			e := newMsgError(ErrDuplicateAttr, -1, "attribute type %d (%s) repeats in message", t, attribute.AttrTypeString[t])
+			e.AttrType = t
+			return e
 		}
 		foundAttrs[a.Type()] = true
 	}
@@ -220,14 +222,14 @@ func (o *defaultMsg) Validate() error {
 	// length sanity check
 	queriedLen := o.Len()
 	if observedLen != queriedLen {
-		return fmt.Errorf("wire format byte length should be %d, got %d", observedLen, queriedLen)
+		return newMsgError(ErrLengthMismatch, -1, "wire format byte length should be %d, got %d", observedLen, queriedLen)
 	}
 
 	// attribute count sanity check
 	observedAttrCount := AttrCount(len(o.attrs))
 	queriedAttrCount := o.AttrCount()
 	if observedAttrCount != queriedAttrCount {
-		return fmt.Errorf("found %d attributes, object claims to have %d", observedAttrCount, queriedAttrCount)
+		return newMsgError(ErrAttrCountMismatch, -1, "found %d attributes, object claims to have %d", observedAttrCount, queriedAttrCount)
 	}
 
 	return nil
@@ -243,11 +245,10 @@ func (o *defaultMsg) NeedsSrcIp() bool {
 
 func (o *defaultMsg) Marshal(extraAttrs []attribute.Attribute) []byte {
 
-	// extract attributes from message
-	var unorderedAttrs []attribute.Attribute
-	for _, a := range o.attrs {
-		unorderedAttrs = append(unorderedAttrs, a)
-	}
+	// extract attributes from message in numeric order, so that any
+	// attributes not covered by msgTypeAttributeOrder land on the wire
+	// in a predictable sequence.
+	unorderedAttrs := attribute.SortAttributes(o.attrs)
 
 	// append extra attributes and sort
 	orderedAttrs := orderAttributes(append(unorderedAttrs, extraAttrs...), o.msgType)
@@ -428,7 +429,7 @@ func UnmarshalMessage(b []byte) (Msg, error) {
 	}
 
 	if int(msg.Len()) != len(b) {
-		return msg, fmt.Errorf("message header claims size of %d, got %d bytes",
+		return msg, newMsgError(ErrLengthMismatch, 2, "message header claims size of %d, got %d bytes",
 			msg.Len(), len(b))
 	}
 
@@ -442,7 +443,13 @@ func UnmarshalMessage(b []byte) (Msg, error) {
 	for _, att := range msg.Attributes() {
 		err := att.Validate()
 		if err != nil {
-			return msg, err
+			return msg, &MsgError{
+				Kind:     ErrBadAttr,
+				Offset:   -1,
+				AttrType: att.Type(),
+				Msg:      fmt.Sprintf("invalid %s attribute", attribute.AttrTypeString[att.Type()]),
+				Err:      err,
+			}
 		}
 	}
 
@@ -451,7 +458,7 @@ func UnmarshalMessage(b []byte) (Msg, error) {
 
 func UnmarshalMessageUnsafe(b []byte) (Msg, error) {
 	if len(b) < int(headerLenByVersion[Version1]) {
-		return nil, fmt.Errorf("cannot unmarshal message got only %d bytes", len(b))
+		return nil, newMsgError(ErrUndersize, 0, "cannot unmarshal message got only %d bytes", len(b))
 	}
 
 	t := MsgType(b[0])
@@ -461,21 +468,35 @@ func UnmarshalMessageUnsafe(b []byte) (Msg, error) {
 
 	attrs := make(map[attribute.AttrType]attribute.Attribute)
 
+	// Don't trust the header to tell us how much data we have.
+	end := int(l)
+	if end > len(b) {
+		end = len(b)
+	}
+
 	p := int(headerLenByVersion[Version1])
-	for p < int(l) {
-		remaining := int(l) - p
+	for p < end {
+		remaining := end - p
 		if remaining < attribute.MinAttrLen {
-			return nil, fmt.Errorf("at byte %d, not enough data remaining (%d btytes)to extract another attribute", p, attribute.MinAttrLen)
+			return nil, newMsgError(ErrTruncatedAttr, p, "at byte %d, not enough data remaining (%d btytes)to extract another attribute", p, remaining)
 		}
 
 		nextAttrLen := int(b[p+1])
 		if remaining < nextAttrLen {
-			return nil, fmt.Errorf("at byte %d, not enough data remaining to extract a %d byte attribute", p, nextAttrLen)
+			e := newMsgError(ErrTruncatedAttr, p, "at byte %d, not enough data remaining to extract a %d byte attribute", p, nextAttrLen)
+			e.AttrType = attribute.AttrType(b[p])
+			return nil, e
 		}
 
 		a, err := attribute.UnmarshalAttribute(b[p : p+nextAttrLen])
 		if err != nil {
-			return nil, err
+			return nil, &MsgError{
+				Kind:     ErrBadAttr,
+				Offset:   p,
+				AttrType: attribute.AttrType(b[p]),
+				Msg:      fmt.Sprintf("at byte %d, cannot unmarshal attribute", p),
+				Err:      err,
+			}
 		}
 
 		attrs[a.Type()] = a
@@ -483,7 +504,7 @@ func UnmarshalMessageUnsafe(b []byte) (Msg, error) {
 	}
 
 	if int(c) != len(attrs) {
-		return nil, fmt.Errorf("header claimed %d attributes, got %d", c, len(attrs))
+		return nil, newMsgError(ErrAttrCountMismatch, 4, "header claimed %d attributes, got %d", c, len(attrs))
 	}
 
 	return &defaultMsg{
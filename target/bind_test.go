@@ -0,0 +1,114 @@
+package target
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTestTargetBuilderBind(t *testing.T) {
+	bind := communicate.Bind{Ip: net.ParseIP("127.0.0.5")}
+	tgt, err := TestTargetBuilder().SetBind(bind).AddIp(net.ParseIP("127.0.0.1")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tgt.GetLocalIp().Equal(bind.Ip) {
+		t.Fatalf("expected local address %s, got %s", bind.Ip, tgt.GetLocalIp())
+	}
+
+	buf := &bytes.Buffer{}
+	err = SaveProfile(tgt, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadProfile(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Bind == nil || !p.Bind.Ip.Equal(bind.Ip) {
+		t.Fatalf("bind lost in profile: %+v", p.Bind)
+	}
+	if !p.target().bind.Ip.Equal(bind.Ip) {
+		t.Fatal("bind lost in target built from profile")
+	}
+}
+
+func TestBuildBind(t *testing.T) {
+	switchIp := net.ParseIP("127.0.0.2")
+	bind := communicate.Bind{Ip: net.ParseIP("127.0.0.1")}
+	err := bind.Ports.Set("42280-42299")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fake switch answers queries naming the pinned address and coming
+	// from the pinned port range
+	cxn, err := net.ListenUDP(communicate.UdpProtocol, &net.UDPAddr{IP: switchIp, Port: communicate.CiscoL2TPort})
+	if err != nil {
+		t.Skipf("cannot listen on %s: %s", switchIp, err)
+	}
+	defer cxn.Close()
+	sawSrcIp := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 1500)
+		_ = cxn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			n, from, err := cxn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if from.Port < bind.Ports.Min || from.Port > bind.Ports.Max {
+				continue
+			}
+			query, err := message.UnmarshalMessageUnsafe(buf[:n])
+			if err != nil || query.GetAttr(attribute.SrcIPv4Type) == nil {
+				continue
+			}
+			sawSrcIp <- query.GetAttr(attribute.SrcIPv4Type).String()
+			reply := message.NewMsgBuilder().SetType(message.ReplyDst).Build()
+			_, _ = cxn.WriteToUDP(reply.Marshal(nil), from)
+		}
+	}()
+
+	tgt, err := TargetBuilder().SetBind(bind).AddIp(switchIp).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-sawSrcIp; s != "127.0.0.1" {
+		t.Fatalf("test message named %s", s)
+	}
+
+	msg, err := message.TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tgt.Send(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-sawSrcIp; s != "127.0.0.1" {
+		t.Fatalf("query named %s", s)
+	}
+}
+
+func TestBuildBindSinglePort(t *testing.T) {
+	var bind communicate.Bind
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	bind.AddFlags(fs)
+	err := fs.Parse([]string{"-bind-ports", "42280"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the dial and listen sockets can't share one port
+	_, err = TargetBuilder().SetBind(bind).AddIp(net.ParseIP("127.0.0.2")).Build()
+	if !errors.Is(err, communicate.ErrBind) {
+		t.Fatalf("expected ErrBind, got %v", err)
+	}
+}
@@ -1,17 +1,33 @@
 package target
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/chrismarget/cisco-l2t/attribute"
 	"github.com/chrismarget/cisco-l2t/communicate"
 	"github.com/chrismarget/cisco-l2t/message"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	// maxConcurrentProbes limits the number of addresses
+	// checked simultaneously by Build().
+	maxConcurrentProbes = 16
+
+	// minBuildPorts is the smallest pinned port range Build() can work
+	// with: each probe uses a "connected" and a "non-connected" socket
+	// at the same time.
+	minBuildPorts = 2
+)
+
 type Builder interface {
 	AddIp(net.IP) Builder
+	SetBind(communicate.Bind) Builder
 	Build() (Target, error)
 }
 
@@ -20,15 +36,19 @@ func TargetBuilder() Builder {
 }
 
 type targetInfo struct {
-	destination *net.UDPAddr
-	theirSource net.IP
-	localAddr   net.IP
-	rtt         []time.Duration
-	bestRtt     time.Duration
+	destination     *net.UDPAddr
+	theirSource     net.IP
+	localAddr       net.IP
+	rtt             []time.Duration
+	bestRtt         time.Duration
+	health          addressHealth
+	serviceDisabled bool // answered with ICMP port unreachable
+	translated      bool // answered though we advertised another address (NAT)
 }
 
 type defaultTargetBuilder struct {
 	addresses []net.IP
+	bind      communicate.Bind
 }
 
 func (o *defaultTargetBuilder) AddIp(ip net.IP) Builder {
@@ -38,30 +58,37 @@ func (o *defaultTargetBuilder) AddIp(ip net.IP) Builder {
 	return o
 }
 
+// SetBind pins the local address, interface and port used for talking to
+// the target, both while building it and afterward.
+func (o *defaultTargetBuilder) SetBind(b communicate.Bind) Builder {
+	o.bind = b
+	return o
+}
+
 func (o *defaultTargetBuilder) Build() (Target, error) {
+	ports := o.bind.Ports
+	if ports.Min != 0 && ports.Max-ports.Min+1 < minBuildPorts {
+		return nil, fmt.Errorf("%w: port range %s is too small, at least %d ports are needed",
+			communicate.ErrBind, ports, minBuildPorts)
+	}
+
+	results := o.probeAll()
+
 	var name string
 	var platform string
 	var mgmtIp net.IP
 	var info []targetInfo
 
-	// Loop over o.addresses, noting that it may grow as the loop progresses
-	var i int
-	for i < len(o.addresses) {
-		destination := &net.UDPAddr{
-			IP:   o.addresses[len(info)],
-			Port: communicate.CiscoL2TPort,
-		}
-		result := checkTarget(destination)
-
-		// Save "name" and "result" so they're not
-		// overwritten by a future failed query.
-		if result.name != "" {
+	for _, result := range results {
+		// Keep the first "name", "platform" and "mgmtIp" we find so
+		// they're not overwritten by a later failed query.
+		if name == "" && result.name != "" {
 			name = result.name
 		}
-		if result.platform != "" {
+		if platform == "" && result.platform != "" {
 			platform = result.platform
 		}
-		if result.mgmtIp.String() != "<nil>" {
+		if mgmtIp == nil && result.mgmtIp != nil {
 			mgmtIp = result.mgmtIp
 		}
 
@@ -71,60 +98,121 @@ func (o *defaultTargetBuilder) Build() (Target, error) {
 		}
 		// Add a targetInfo structure to the slice for every address we probe.
 		info = append(info, targetInfo{
-			localAddr:   result.localIp,
-			destination: destination,
-			theirSource: result.sourceIp,
-			rtt:         rttSamples,
-			bestRtt:     result.latency, // only sample is best sample
+			localAddr:       result.localIp,
+			destination:     result.destination,
+			theirSource:     result.sourceIp,
+			rtt:             rttSamples,
+			bestRtt:         result.latency, // only sample is best sample
+			serviceDisabled: result.refused,
+			translated:      result.translated,
 		})
-
-		// Reply came from an unknown source address? Add it to the list.
-		if result.sourceIp != nil && addressIsNew(result.sourceIp, o.addresses) {
-			o.addresses = append(o.addresses, result.sourceIp)
-		}
-
-		// Reply cited an unknown management address? Add it to the list.
-		if result.mgmtIp != nil && addressIsNew(result.mgmtIp, o.addresses) {
-			o.addresses = append(o.addresses, result.mgmtIp)
-		}
-
-		// Last iteration of this loop is the one where 'i' has grown to match
-		// the length of the address list.
-		i++
 	}
 
 	// look through the targetInfo structures we've collected
-	var fastestTarget int
-	var reachable bool
+	fastestTarget := -1
 	for i, ti := range info {
 		// ignore targetInfo if the target didn't talk to us
 		if ti.theirSource == nil {
 			continue
-		} else {
-			reachable = true
 		}
 
-		if ti.bestRtt < info[fastestTarget].bestRtt {
+		if fastestTarget < 0 || ti.bestRtt < info[fastestTarget].bestRtt {
 			fastestTarget = i
 		}
 	}
 
+	if fastestTarget < 0 {
+		var tried []net.IP
+		var disabled []net.IP
+		for _, ti := range info {
+			tried = append(tried, ti.destination.IP)
+			if ti.serviceDisabled {
+				disabled = append(disabled, ti.destination.IP)
+			}
+		}
+		return nil, UnreachableTargetError{AddressesTried: tried, ServiceDisabled: disabled}
+	}
+
 	return &defaultTarget{
-		reachable: reachable,
+		reachable: true,
 		info:      info,
 		best:      fastestTarget,
 		name:      name,
 		platform:  platform,
 		mgmtIp:    mgmtIp,
+		bind:      o.bind,
 	}, nil
 }
 
+// probeAll concurrently checks every address known to the builder. Replies
+// from unknown source addresses, or which cite unknown management
+// addresses, cause those addresses to be probed as well. The results are
+// ordered deterministically: addresses supplied via AddIp() come first,
+// in the order they were added, followed by learned addresses in numeric
+// order.
+func (o *defaultTargetBuilder) probeAll() []testPacketResult {
+	resultChan := make(chan testPacketResult)
+	workerPool := make(chan struct{}, maxConcurrentProbes)
+
+	var pending int
+	probe := func(ip net.IP) {
+		pending++
+		go func() {
+			workerPool <- struct{}{}
+			destination := &net.UDPAddr{
+				IP:   ip,
+				Port: communicate.CiscoL2TPort,
+			}
+			result := checkTarget(destination, o.bind)
+			result.destination = destination
+			<-workerPool
+			resultChan <- result
+		}()
+	}
+
+	supplied := len(o.addresses)
+	for _, a := range o.addresses {
+		probe(a)
+	}
+
+	byAddress := make(map[string]testPacketResult)
+	for pending > 0 {
+		result := <-resultChan
+		pending--
+		byAddress[result.destination.IP.String()] = result
+
+		// Reply came from an unknown source address? Probe it too.
+		if result.sourceIp != nil && addressIsNew(result.sourceIp, o.addresses) {
+			o.addresses = append(o.addresses, result.sourceIp)
+			probe(result.sourceIp)
+		}
+
+		// Reply cited an unknown management address? Probe it too.
+		if result.mgmtIp != nil && addressIsNew(result.mgmtIp, o.addresses) {
+			o.addresses = append(o.addresses, result.mgmtIp)
+			probe(result.mgmtIp)
+		}
+	}
+
+	learned := o.addresses[supplied:]
+	sort.Slice(learned, func(i, j int) bool {
+		return bytes.Compare(learned[i].To16(), learned[j].To16()) < 0
+	})
+
+	var out []testPacketResult
+	for _, a := range o.addresses {
+		out = append(out, byAddress[a.String()])
+	}
+	return out
+}
+
 func TestTargetBuilder() Builder {
 	return &testTargetBuilder{}
 }
 
 type testTargetBuilder struct {
 	addresses []net.IP
+	bind      communicate.Bind
 }
 
 func (o *testTargetBuilder) AddIp(ip net.IP) Builder {
@@ -134,6 +222,12 @@ func (o *testTargetBuilder) AddIp(ip net.IP) Builder {
 	return o
 
 }
+
+func (o *testTargetBuilder) SetBind(b communicate.Bind) Builder {
+	o.bind = b
+	return o
+}
+
 func (o *testTargetBuilder) Build() (Target, error) {
 	name := "TestTarget"
 	platform := "TestPlatform"
@@ -144,7 +238,7 @@ func (o *testTargetBuilder) Build() (Target, error) {
 	}
 
 	for i, a := range o.addresses {
-		outIp, _ := communicate.GetOutgoingIpForDestination(a)
+		outIp, _ := o.bind.LocalIp(a)
 		rtt := []time.Duration{(time.Duration(i) + 1) * time.Millisecond}
 		ti = append(ti, targetInfo{
 			destination: &net.UDPAddr{
@@ -165,7 +259,8 @@ func (o *testTargetBuilder) Build() (Target, error) {
 		name:      name,
 		platform:  platform,
 		mgmtIp:    mgmtIp,
-		rttLock:   sync.Mutex{},
+		bind:      o.bind,
+		lock:      sync.Mutex{},
 	}, nil
 
 }
@@ -190,6 +285,8 @@ type testPacketResult struct {
 	name        string
 	mgmtIp      net.IP
 	localIp     net.IP
+	refused     bool // ICMP port unreachable: service disabled
+	translated  bool // reply reached an address other than the one we advertised
 }
 
 func (r *testPacketResult) String() string {
@@ -204,40 +301,24 @@ func (r *testPacketResult) String() string {
 
 // checkTarget sends test L2T messages to the specified IP address. It
 // returns a testPacketResult that represents the result of the check.
-func checkTarget(destination *net.UDPAddr) testPacketResult {
+func checkTarget(destination *net.UDPAddr, bind communicate.Bind) testPacketResult {
 	// Build up the test message. Doing so requires that we know our IP address
 	// which, on a multihomed system requires that we look up the route to the
 	// target. So, we need to know about the target before we can form the
 	// message.
-	ourIp, err := communicate.GetOutgoingIpForDestination(destination.IP)
+	ourIp, err := bind.LocalIp(destination.IP)
 	if err != nil {
 		return testPacketResult{
 			destination: destination,
 			err:         err,
 		}
 	}
-	ourIpAttr, err := attribute.NewAttrBuilder().
-		SetType(attribute.SrcIPv4Type).
-		SetString(ourIp.String()).
-		Build()
-	if err != nil {
-		return testPacketResult{
-			err: err,
-		}
-	}
-
-	testMsg, err := message.TestMsg()
-	if err != nil {
-		return testPacketResult{err: err}
-	}
-
-	err = testMsg.Validate()
+	srcIp := bind.SrcIp(ourIp)
+	payload, err := testPayload(srcIp)
 	if err != nil {
 		return testPacketResult{err: err}
 	}
 
-	payload := testMsg.Marshal([]attribute.Attribute{ourIpAttr})
-
 	// We're going to send the message via two different sockets: A "connected"
 	// (dial) socket and a "non-connected" (listen) socket. The former can
 	// telegraph ICMP unreachable (go away!) messages to us, while the latter
@@ -249,6 +330,7 @@ func checkTarget(destination *net.UDPAddr) testPacketResult {
 		Destination:     destination,
 		ExpectReplyFrom: destination.IP,
 		RttGuess:        communicate.InitialRTTGuess * 2,
+		Bind:            bind,
 	}
 	stopListenSocket := make(chan struct{}) // abort channel
 	outViaListen := communicate.SendThis{   // Communicate() output structure
@@ -256,6 +338,8 @@ func checkTarget(destination *net.UDPAddr) testPacketResult {
 		Destination:     destination,
 		ExpectReplyFrom: nil,
 		RttGuess:        communicate.InitialRTTGuess * 2,
+		Bind:            bind,
+		ListenAny:       bind.Nat(), // see where replies to srcIp end up
 	}
 
 	dialResult := make(chan communicate.SendResult)
@@ -284,6 +368,10 @@ func checkTarget(destination *net.UDPAddr) testPacketResult {
 
 	// return an error (maybe)
 	if in.Err != nil {
+		if errors.Is(in.Err, communicate.ErrRefused) {
+			// the switch is there, but not running the L2T service
+			return testPacketResult{localIp: ourIp, refused: true}
+		}
 		if result, ok := in.Err.(net.Error); ok && result.Timeout() {
 			// we timed out. Return an empty testPacketResult
 			return testPacketResult{}
@@ -319,17 +407,49 @@ func checkTarget(destination *net.UDPAddr) testPacketResult {
 		}
 	}
 
+	// The test message asked for a reply to srcIp. If it arrived at some
+	// other address, the address was translated (NAT) along the way.
+	translated := in.ReplyTo != nil && !in.ReplyTo.Equal(srcIp)
+
 	return testPacketResult{
-		localIp:  ourIp,
-		err:      in.Err,
-		latency:  in.Rtt,
-		sourceIp: in.ReplyFrom,
-		platform: platform,
-		name:     name,
-		mgmtIp:   mgmtIp,
+		localIp:    ourIp,
+		err:        in.Err,
+		latency:    in.Rtt,
+		sourceIp:   in.ReplyFrom,
+		platform:   platform,
+		name:       name,
+		mgmtIp:     mgmtIp,
+		translated: translated,
 	}
 }
 
+// testPayload returns a wire format test message from ourIp. No L2T
+// attribute can carry an IPv6 source address, so when ourIp is IPv6 the
+// attribute is left out, and we rely on the switch replying to the
+// datagram's source.
+func testPayload(ourIp net.IP) ([]byte, error) {
+	testMsg, err := message.TestMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	err = testMsg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []attribute.Attribute
+	if ourIp.To4() != nil {
+		ourIpAttr, err := attribute.NewSrcIpAttribute(ourIp)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, ourIpAttr)
+	}
+
+	return testMsg.Marshal(attrs), nil
+}
+
 func initialLatency() []time.Duration {
 	var l []time.Duration
 	for len(l) < 5 {
@@ -1,6 +1,7 @@
 package target
 
 import (
+	"errors"
 	"github.com/chrismarget/cisco-l2t/communicate"
 	"log"
 	"net"
@@ -13,7 +14,7 @@ func TestCheckTarget(t *testing.T) {
 		Port: communicate.CiscoL2TPort,
 		Zone: "",
 	}
-	result := checkTarget(destination)
+	result := checkTarget(destination, communicate.Bind{})
 	if result.err != nil {
 		t.Fatal(result.err)
 	}
@@ -54,4 +55,64 @@ func TestTestTargetBuilder(t *testing.T) {
 	log.Println(ttc.String())
 	log.Println("----------------------------------")
 
-}
\ No newline at end of file
+}
+
+func TestProbeAllOrder(t *testing.T) {
+	// Nothing listens on the L2T port on loopback, so these
+	// all fail quickly with ICMP port unreachable.
+	addresses := []net.IP{
+		net.ParseIP("127.0.0.3"),
+		net.ParseIP("127.0.0.1"),
+		net.ParseIP("127.0.0.2"),
+	}
+
+	builder := &defaultTargetBuilder{}
+	for _, a := range addresses {
+		builder.AddIp(a)
+	}
+
+	results := builder.probeAll()
+	if len(results) != len(addresses) {
+		t.Fatalf("expected %d results, got %d", len(addresses), len(results))
+	}
+	for i, r := range results {
+		if !r.destination.IP.Equal(addresses[i]) {
+			t.Fatalf("result %d: expected %s, got %s", i, addresses[i], r.destination.IP)
+		}
+	}
+}
+
+func TestBuildServiceDisabled(t *testing.T) {
+	// Nothing listens on the L2T port on loopback, so the service
+	// looks disabled.
+	_, err := TargetBuilder().
+		AddIp(net.ParseIP("127.0.0.1")).
+		AddIp(net.ParseIP("127.0.0.2")).
+		Build()
+
+	var ute UnreachableTargetError
+	if !errors.As(err, &ute) {
+		t.Fatalf("expected UnreachableTargetError, got %v", err)
+	}
+	if len(ute.ServiceDisabled) != 2 {
+		t.Fatalf("expected 2 disabled addresses, got %v", ute.ServiceDisabled)
+	}
+	if !errors.Is(err, ErrServiceDisabled) {
+		t.Fatal("expected ErrServiceDisabled")
+	}
+}
+
+func TestUnreachableTargetErrorIs(t *testing.T) {
+	a := net.ParseIP("192.0.2.1")
+	b := net.ParseIP("192.0.2.2")
+
+	err := UnreachableTargetError{AddressesTried: []net.IP{a, b}, ServiceDisabled: []net.IP{a}}
+	if errors.Is(err, ErrServiceDisabled) {
+		t.Fatal("one address might still be running the service")
+	}
+
+	err.ServiceDisabled = append(err.ServiceDisabled, b)
+	if !errors.Is(err, ErrServiceDisabled) {
+		t.Fatal("expected ErrServiceDisabled")
+	}
+}
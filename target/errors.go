@@ -1,13 +1,33 @@
 package target
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 )
 
+// These values describe problems reported by the target package. Test for
+// them with errors.Is().
+var (
+	ErrVlanOutOfRange   = errors.New("vlan out of range")
+	ErrBadProfile       = errors.New("bad target profile")
+	ErrNeverReplied     = errors.New("address has never replied")
+	ErrLocalAddrChanged = errors.New("local address changed")
+	ErrServiceDisabled  = errors.New("l2t service disabled")
+	ErrBadQuery         = errors.New("bad query")
+	ErrBadCheckpoint    = errors.New("bad checkpoint")
+	ErrTraceTooLong     = errors.New("trace too long")
+	ErrCollectorAddr    = errors.New("collector address can't be advertised")
+)
+
+// UnreachableTargetError is returned by Build() when none of the addresses
+// tried elicited a reply. ServiceDisabled lists the addresses which
+// answered with ICMP port unreachable. When that's all of them, the error
+// satisfies errors.Is(err, ErrServiceDisabled).
 type UnreachableTargetError struct {
-	AddressesTried []net.IP
+	AddressesTried  []net.IP
+	ServiceDisabled []net.IP
 }
 
 func (o UnreachableTargetError) Error() string {
@@ -15,5 +35,21 @@ func (o UnreachableTargetError) Error() string {
 	for _, i := range o.AddressesTried {
 		at = append(at, i.String())
 	}
-	return fmt.Sprintf("cannot reach target using any of these addresses: %v", strings.Join(at, ", "))
+	msg := fmt.Sprintf("cannot reach target using any of these addresses: %v", strings.Join(at, ", "))
+	if len(o.ServiceDisabled) > 0 {
+		var sd []string
+		for _, i := range o.ServiceDisabled {
+			sd = append(sd, i.String())
+		}
+		msg += fmt.Sprintf(" (service disabled at %s)", strings.Join(sd, ", "))
+	}
+	return msg
+}
+
+// Is returns a boolean indicating whether target is ErrServiceDisabled and
+// every address tried reported the service disabled.
+func (o UnreachableTargetError) Is(target error) bool {
+	return target == ErrServiceDisabled &&
+		len(o.AddressesTried) > 0 &&
+		len(o.ServiceDisabled) == len(o.AddressesTried)
 }
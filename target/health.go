@@ -0,0 +1,137 @@
+package target
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// failoverThreshold is the number of consecutive timeouts after which
+	// an address is considered failed, and traffic moves elsewhere.
+	failoverThreshold = 2
+
+	// failedRetryInterval is how long a failed address sits out before
+	// it becomes eligible for selection again.
+	failedRetryInterval = 30 * time.Second
+)
+
+// addressHealth tracks the recent behavior of one of the target's addresses.
+type addressHealth struct {
+	consecutiveFailures int
+	lastSuccess         time.Time
+	lastFailure         time.Time
+}
+
+// AddressHealth describes the health of one of the target's addresses.
+type AddressHealth struct {
+	Destination         net.IP        `json:"destination"`
+	RepliesFrom         net.IP        `json:"replies_from,omitempty"`
+	Active              bool          `json:"active"`               // this address is currently in use
+	Usable              bool          `json:"usable"`               // this address is eligible for use
+	ConsecutiveFailures int           `json:"consecutive_failures"` // timeouts since the last reply
+	Srtt                time.Duration `json:"srtt_ns"`              // smoothed round trip time estimate
+	LastSuccess         time.Time     `json:"last_success"`
+	LastFailure         time.Time     `json:"last_failure"`
+	ServiceDisabled     bool          `json:"service_disabled,omitempty"` // answered with ICMP port unreachable
+	Translated          bool          `json:"translated,omitempty"`       // answered via address translation (NAT)
+}
+
+// usable returns a boolean indicating whether the targetInfo is a candidate
+// for carrying traffic: it must have replied at some point, and must not
+// have failed recently.
+func (o targetInfo) usable(now time.Time) bool {
+	if o.theirSource == nil {
+		return false
+	}
+	if o.health.consecutiveFailures < failoverThreshold {
+		return true
+	}
+	return now.Sub(o.health.lastFailure) > failedRetryInterval
+}
+
+// Health returns the health of each of the target's addresses.
+func (o *defaultTarget) Health() []AddressHealth {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := time.Now()
+	var out []AddressHealth
+	for i, ti := range o.info {
+		out = append(out, AddressHealth{
+			Destination:         ti.destination.IP,
+			RepliesFrom:         ti.theirSource,
+			Active:              i == o.best,
+			Usable:              ti.usable(now),
+			ConsecutiveFailures: ti.health.consecutiveFailures,
+			Srtt:                smoothedRtt(ti.rtt),
+			LastSuccess:         ti.health.lastSuccess,
+			LastFailure:         ti.health.lastFailure,
+			ServiceDisabled:     ti.serviceDisabled,
+			Translated:          ti.translated,
+		})
+	}
+	return out
+}
+
+// recordSuccess notes a reply via the specified targetInfo index, then
+// re-selects the best address based on current round trip times.
+func (o *defaultTarget) recordSuccess(index int, rtt time.Duration) {
+	o.updateLatency(index, rtt)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.info[index].health.consecutiveFailures = 0
+	o.info[index].health.lastSuccess = time.Now()
+	o.reachable = true
+	o.selectBest()
+}
+
+// recordTimeout notes a timeout via the specified targetInfo index. If the
+// address has now failed, another one is selected. It returns a boolean
+// indicating whether the best address changed.
+func (o *defaultTarget) recordTimeout(index int) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.info[index].health.consecutiveFailures++
+	o.info[index].health.lastFailure = time.Now()
+
+	before := o.best
+	if o.info[index].health.consecutiveFailures >= failoverThreshold {
+		o.selectBest()
+	}
+	return o.best != before
+}
+
+// selectBest points o.best at the usable address with the lowest smoothed
+// round trip time. If no address is usable, the one which has gone longest
+// without failing is chosen. Caller must hold o.lock.
+func (o *defaultTarget) selectBest() {
+	now := time.Now()
+	best := -1
+	var bestSrtt time.Duration
+	for i, ti := range o.info {
+		if !ti.usable(now) {
+			continue
+		}
+		srtt := smoothedRtt(ti.rtt)
+		if best < 0 || srtt < bestSrtt {
+			best = i
+			bestSrtt = srtt
+		}
+	}
+
+	if best < 0 {
+		for i, ti := range o.info {
+			if ti.theirSource == nil {
+				continue
+			}
+			if best < 0 || ti.health.lastFailure.Before(o.info[best].health.lastFailure) {
+				best = i
+			}
+		}
+	}
+
+	if best >= 0 {
+		o.best = best
+	}
+}
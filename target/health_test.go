@@ -0,0 +1,112 @@
+package target
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHealthTarget() *defaultTarget {
+	var info []targetInfo
+	for i, a := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+		ip := net.ParseIP(a)
+		info = append(info, targetInfo{
+			destination: &net.UDPAddr{IP: ip},
+			theirSource: ip,
+			rtt:         []time.Duration{time.Duration(i+1) * time.Millisecond},
+		})
+	}
+	return &defaultTarget{
+		reachable: true,
+		info:      info,
+		best:      0,
+	}
+}
+
+func TestFailover(t *testing.T) {
+	target := testHealthTarget()
+
+	if target.recordTimeout(0) {
+		t.Fatalf("single timeout should not cause failover")
+	}
+	if !target.recordTimeout(0) {
+		t.Fatalf("repeated timeouts should cause failover")
+	}
+	if target.best != 1 {
+		t.Fatalf("expected failover to next fastest address (1), got %d", target.best)
+	}
+
+	for _, h := range target.Health() {
+		switch {
+		case h.Destination.Equal(net.ParseIP("127.0.0.1")):
+			if h.Usable || h.Active || h.ConsecutiveFailures != failoverThreshold {
+				t.Fatalf("unexpected health for failed address: %+v", h)
+			}
+		case h.Destination.Equal(net.ParseIP("127.0.0.2")):
+			if !h.Usable || !h.Active {
+				t.Fatalf("unexpected health for active address: %+v", h)
+			}
+		}
+	}
+}
+
+func TestReselectBySrtt(t *testing.T) {
+	target := testHealthTarget()
+	target.best = 2
+
+	// A reply via the slow address should cause
+	// re-selection of the fastest usable one.
+	target.recordSuccess(2, 3*time.Millisecond)
+	if target.best != 0 {
+		t.Fatalf("expected re-selection of fastest address (0), got %d", target.best)
+	}
+
+	// The formerly fast address gets slow.
+	for i := 0; i < maxLatencySamples; i++ {
+		target.recordSuccess(0, 10*time.Millisecond)
+	}
+	if target.best != 1 {
+		t.Fatalf("expected re-selection of fastest address (1), got %d", target.best)
+	}
+}
+
+func TestAllFailed(t *testing.T) {
+	target := testHealthTarget()
+	for i := range target.info {
+		for j := 0; j < failoverThreshold; j++ {
+			target.recordTimeout(i)
+		}
+	}
+
+	// Address 0 failed longest ago, so it should get another chance.
+	if target.best != 0 {
+		t.Fatalf("expected least recently failed address (0), got %d", target.best)
+	}
+}
+
+func TestStringWhileReplying(t *testing.T) {
+	target := testHealthTarget()
+
+	// String() races with replies unless it holds the lock (go test -race)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			target.recordSuccess(i%len(target.info), time.Duration(i%10)*time.Millisecond)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if !strings.Contains(target.String(), "127.0.0.3") {
+			t.Fatal("address missing from String()")
+		}
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,57 @@
+package target
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBuildIpv6(t *testing.T) {
+	// fake switch replies to the datagram's source: there's no source
+	// IP attribute in a query sent via IPv6.
+	cxn, err := net.ListenUDP(communicate.UdpProtocol6, &net.UDPAddr{IP: net.IPv6loopback, Port: communicate.CiscoL2TPort})
+	if err != nil {
+		t.Skipf("cannot listen on [::1]:%d: %s", communicate.CiscoL2TPort, err)
+	}
+	defer cxn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		_ = cxn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			n, from, err := cxn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := message.UnmarshalMessage(buf[:n])
+			if err != nil || query.GetAttr(attribute.SrcIPv4Type) != nil {
+				continue
+			}
+			name, _ := attribute.NewAttrBuilder().SetType(attribute.DevNameType).SetString("v6switch").Build()
+			reply := message.NewMsgBuilder().SetType(message.ReplyDst).SetAttr(name).Build()
+			_, _ = cxn.WriteToUDP(reply.Marshal(nil), from)
+		}
+	}()
+
+	tgt, err := TargetBuilder().AddIp(net.IPv6loopback).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := tgt.Profile()
+	if p.Name != "v6switch" || !p.Addresses[p.Best].RepliesFrom.Equal(net.IPv6loopback) {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+	if !tgt.GetLocalIp().Equal(net.IPv6loopback) {
+		t.Fatalf("expected local address ::1, got %s", tgt.GetLocalIp())
+	}
+}
+
+func TestBuildServiceDisabledIpv6(t *testing.T) {
+	_, err := TargetBuilder().AddIp(net.IPv6loopback).Build()
+	if !errors.Is(err, ErrServiceDisabled) {
+		t.Fatalf("expected ErrServiceDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package target
+
+import (
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTestTargetBuilderAdvertise(t *testing.T) {
+	bind := communicate.Bind{Advertise: net.ParseIP("192.0.2.1")}
+	tgt, err := TestTargetBuilder().SetBind(bind).AddIp(net.ParseIP("127.0.0.1")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tgt.GetSrcIp().Equal(bind.Advertise) {
+		t.Fatalf("expected source address %s, got %s", bind.Advertise, tgt.GetSrcIp())
+	}
+	if tgt.GetLocalIp().Equal(bind.Advertise) {
+		t.Fatal("local address shouldn't be the advertised one")
+	}
+}
+
+func TestBuildAdvertise(t *testing.T) {
+	switchIp := net.ParseIP("127.0.0.3")
+	bind := communicate.Bind{Advertise: net.ParseIP("192.0.2.1")}
+
+	// fake switch replies to the datagram's source, as it would if a NAT
+	// device had rewritten the advertised address
+	cxn, err := net.ListenUDP(communicate.UdpProtocol, &net.UDPAddr{IP: switchIp, Port: communicate.CiscoL2TPort})
+	if err != nil {
+		t.Skipf("cannot listen on %s: %s", switchIp, err)
+	}
+	defer cxn.Close()
+	sawSrcIp := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 1500)
+		_ = cxn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			n, from, err := cxn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := message.UnmarshalMessageUnsafe(buf[:n])
+			if err != nil || query.GetAttr(attribute.SrcIPv4Type) == nil {
+				continue
+			}
+			sawSrcIp <- query.GetAttr(attribute.SrcIPv4Type).String()
+			reply := message.NewMsgBuilder().SetType(message.ReplyDst).Build()
+			_, _ = cxn.WriteToUDP(reply.Marshal(nil), from)
+		}
+	}()
+
+	tgt, err := TargetBuilder().SetBind(bind).AddIp(switchIp).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-sawSrcIp; s != "192.0.2.1" {
+		t.Fatalf("test message named %s", s)
+	}
+	if h := tgt.Health(); len(h) != 1 || !h[0].Translated {
+		t.Fatalf("translation not detected: %+v", h)
+	}
+	if p := tgt.Profile(); !p.Addresses[0].Translated || !p.target().info[0].translated {
+		t.Fatal("translation lost in profile")
+	}
+
+	msg, err := message.TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tgt.Send(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-sawSrcIp; s != "192.0.2.1" {
+		t.Fatalf("query named %s", s)
+	}
+}
+
+func TestBuildAdvertiseUntranslated(t *testing.T) {
+	switchIp := net.ParseIP("127.0.0.4")
+	advertise := net.ParseIP("127.0.0.2") // one of ours, so no NAT needed
+	bind := communicate.Bind{Advertise: advertise}
+
+	// fake switch replies to the address named in the query, not to the
+	// datagram's source
+	cxn, err := net.ListenUDP(communicate.UdpProtocol, &net.UDPAddr{IP: switchIp, Port: communicate.CiscoL2TPort})
+	if err != nil {
+		t.Skipf("cannot listen on %s: %s", switchIp, err)
+	}
+	defer cxn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		_ = cxn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			n, from, err := cxn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := message.UnmarshalMessageUnsafe(buf[:n])
+			if err != nil || query.GetAttr(attribute.SrcIPv4Type) == nil {
+				continue
+			}
+			to := &net.UDPAddr{IP: net.ParseIP(query.GetAttr(attribute.SrcIPv4Type).String()), Port: from.Port}
+			reply := message.NewMsgBuilder().SetType(message.ReplyDst).Build()
+			_, _ = cxn.WriteToUDP(reply.Marshal(nil), to)
+		}
+	}()
+
+	tgt, err := TargetBuilder().SetBind(bind).AddIp(switchIp).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := tgt.Health(); len(h) != 1 || h[0].Translated {
+		t.Fatalf("reply to the advertised address reported as translated: %+v", h)
+	}
+}
@@ -0,0 +1,224 @@
+package target
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Profile is a serializable description of a Target. Saving a profile and
+// loading it later allows repeated runs against the same switch to skip
+// the discovery process performed by Builder.Build().
+type Profile struct {
+	Name      string           `json:"name,omitempty"`
+	Platform  string           `json:"platform,omitempty"`
+	MgmtIp    net.IP           `json:"mgmt_ip,omitempty"`
+	Reachable bool             `json:"reachable"`
+	Best      int              `json:"best"`
+	Addresses []ProfileAddress `json:"addresses"`
+
+	// Bind, if not nil, pins our end of the conversation.
+	Bind *communicate.Bind `json:"bind,omitempty"`
+}
+
+// ProfileAddress describes one of the Target's known addresses.
+type ProfileAddress struct {
+	// Destination is the address we send queries to.
+	Destination net.IP `json:"destination"`
+
+	// RepliesFrom is the address the switch uses when replying to
+	// queries sent to Destination. Nil if it never replied.
+	RepliesFrom net.IP `json:"replies_from,omitempty"`
+
+	// LocalAddr is our address for talking to Destination.
+	LocalAddr net.IP `json:"local_addr,omitempty"`
+
+	// Rtt holds round trip time samples, in nanoseconds.
+	Rtt []time.Duration `json:"rtt_ns,omitempty"`
+
+	// ServiceDisabled indicates that Destination answered with ICMP
+	// port unreachable when the target was built.
+	ServiceDisabled bool `json:"service_disabled,omitempty"`
+
+	// Translated indicates that replies reached LocalAddr even though
+	// queries advertised a different (NAT) address as their source.
+	Translated bool `json:"translated,omitempty"`
+}
+
+// Profile returns a Profile describing the target.
+func (o *defaultTarget) Profile() Profile {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	p := Profile{
+		Name:      o.name,
+		Platform:  o.platform,
+		MgmtIp:    o.mgmtIp,
+		Reachable: o.reachable,
+		Best:      o.best,
+	}
+	if !o.bind.IsZero() {
+		b := o.bind
+		p.Bind = &b
+	}
+	for _, ti := range o.info {
+		p.Addresses = append(p.Addresses, ProfileAddress{
+			Destination:     ti.destination.IP,
+			RepliesFrom:     ti.theirSource,
+			LocalAddr:       ti.localAddr,
+			Rtt:             append([]time.Duration{}, ti.rtt...),
+			ServiceDisabled: ti.serviceDisabled,
+			Translated:      ti.translated,
+		})
+	}
+	return p
+}
+
+// bind returns the profile's Bind, or the zero Bind if there isn't one.
+func (o Profile) bind() communicate.Bind {
+	if o.Bind == nil {
+		return communicate.Bind{}
+	}
+	return *o.Bind
+}
+
+// SaveProfile writes the target's Profile to w in JSON format.
+func SaveProfile(t Target, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t.Profile())
+}
+
+// LoadProfile reads a JSON format Profile from r.
+func LoadProfile(r io.Reader) (Profile, error) {
+	var p Profile
+	err := json.NewDecoder(r).Decode(&p)
+	if err != nil {
+		return p, err
+	}
+
+	if len(p.Addresses) == 0 {
+		return p, fmt.Errorf("%w: profile contains no addresses", ErrBadProfile)
+	}
+	if p.Best < 0 || p.Best >= len(p.Addresses) {
+		return p, fmt.Errorf("%w: best address index %d out of range", ErrBadProfile, p.Best)
+	}
+	for i, a := range p.Addresses {
+		if a.Destination == nil {
+			return p, fmt.Errorf("%w: address %d has no destination", ErrBadProfile, i)
+		}
+	}
+
+	return p, nil
+}
+
+// Target returns a Target built from the profile. If revalidate is true,
+// the profile's best address is sent a single test message. When it
+// answers from the expected address, the fresh RTT sample is recorded and
+// the profile is trusted. Otherwise, the target is rebuilt from scratch
+// using all of the profile's addresses.
+func (o Profile) Target(revalidate bool) (Target, error) {
+	t := o.target()
+	if !revalidate {
+		return t, nil
+	}
+
+	rtt, err := quickCheck(t.info[t.best], t.bind)
+	if err == nil {
+		t.reachable = true
+		t.updateLatency(t.best, rtt)
+		return t, nil
+	}
+
+	builder := TargetBuilder().SetBind(t.bind)
+	for _, a := range o.Addresses {
+		builder.AddIp(a.Destination)
+	}
+	return builder.Build()
+}
+
+// target returns a *defaultTarget built from the profile without
+// talking to the network.
+func (o Profile) target() *defaultTarget {
+	var info []targetInfo
+	for _, a := range o.Addresses {
+		ti := targetInfo{
+			destination: &net.UDPAddr{
+				IP:   a.Destination,
+				Port: communicate.CiscoL2TPort,
+			},
+			theirSource:     a.RepliesFrom,
+			localAddr:       a.LocalAddr,
+			rtt:             append([]time.Duration{}, a.Rtt...),
+			serviceDisabled: a.ServiceDisabled,
+			translated:      a.Translated,
+		}
+		for _, r := range ti.rtt {
+			if ti.bestRtt == 0 || r < ti.bestRtt {
+				ti.bestRtt = r
+			}
+		}
+		info = append(info, ti)
+	}
+
+	return &defaultTarget{
+		reachable: o.Reachable,
+		info:      info,
+		best:      o.Best,
+		name:      o.Name,
+		platform:  o.Platform,
+		mgmtIp:    o.MgmtIp,
+		bind:      o.bind(),
+		lock:      sync.Mutex{},
+	}
+}
+
+// quickCheck sends a single test message to a previously discovered
+// address. Unlike checkTarget(), it already knows where the reply will come
+// from, so it needs only one socket and no head start. It returns the
+// round trip time.
+func quickCheck(ti targetInfo, bind communicate.Bind) (time.Duration, error) {
+	if ti.theirSource == nil {
+		return 0, fmt.Errorf("%w: %s", ErrNeverReplied, ti.destination.IP)
+	}
+
+	ourIp, err := bind.LocalIp(ti.destination.IP)
+	if err != nil {
+		return 0, err
+	}
+	if ti.localAddr != nil && !ti.localAddr.Equal(ourIp) {
+		return 0, fmt.Errorf("%w from %s to %s", ErrLocalAddrChanged, ti.localAddr, ourIp)
+	}
+
+	payload, err := testPayload(bind.SrcIp(ourIp))
+	if err != nil {
+		return 0, err
+	}
+
+	out := communicate.SendThis{
+		Payload:         payload,
+		Destination:     ti.destination,
+		ExpectReplyFrom: ti.theirSource,
+		RttGuess:        averageRtt(ti.rtt),
+		Bind:            bind,
+	}
+	if bind.Nat() {
+		out.AcceptFrom = []net.IP{ti.destination.IP}
+	}
+	in := communicate.Communicate(out, nil)
+	if in.Err != nil {
+		return 0, in.Err
+	}
+
+	_, err = message.UnmarshalMessage(in.ReplyData)
+	if err != nil {
+		return 0, err
+	}
+
+	return in.Rtt, nil
+}
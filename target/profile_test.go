@@ -0,0 +1,85 @@
+package target
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProfileRoundTrip(t *testing.T) {
+	tt, err := TestTargetBuilder().
+		AddIp(net.ParseIP("127.0.0.1")).
+		AddIp(net.ParseIP("127.0.0.2")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = SaveProfile(tt, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadProfile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := p.Target(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// net.IP may change representation (4 vs. 16 bytes) in the round trip,
+	// so compare the serialized forms.
+	var original, reloaded bytes.Buffer
+	err = SaveProfile(tt, &original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveProfile(loaded, &reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.String() != reloaded.String() {
+		t.Fatalf("profiles don't match:\n%s\n%s", original.String(), reloaded.String())
+	}
+
+	if loaded.String() != tt.String() {
+		t.Fatalf("targets don't match:\n%s\n%s", tt.String(), loaded.String())
+	}
+}
+
+func TestProfileBestRtt(t *testing.T) {
+	p := Profile{
+		Addresses: []ProfileAddress{
+			{
+				Destination: net.ParseIP("127.0.0.1"),
+				Rtt:         []time.Duration{3 * time.Millisecond, 1 * time.Millisecond, 2 * time.Millisecond},
+			},
+		},
+	}
+	if p.target().info[0].bestRtt != time.Millisecond {
+		t.Fatalf("expected best rtt %s, got %s", time.Millisecond, p.target().info[0].bestRtt)
+	}
+}
+
+func TestLoadProfileBad(t *testing.T) {
+	for _, s := range []string{
+		`{}`,
+		`{"best": 1, "addresses": [{"destination": "127.0.0.1"}]}`,
+		`{"addresses": [{"replies_from": "127.0.0.1"}]}`,
+		`not json`,
+	} {
+		_, err := LoadProfile(bytes.NewBufferString(s))
+		if err == nil {
+			t.Fatalf("expected error loading profile %s", s)
+		}
+		if s != `not json` && !errors.Is(err, ErrBadProfile) {
+			t.Fatalf("expected ErrBadProfile loading profile %s, got %v", s, err)
+		}
+	}
+}
@@ -5,16 +5,21 @@ import (
 	"github.com/chrismarget/cisco-l2t/attribute"
 	"github.com/chrismarget/cisco-l2t/message"
 	"net"
+	"strconv"
 )
 
 const (
 	vlanMin = 1
 	vlanMax = 4094
+
+	// replyStatusBadVlan is the status we get when asking about a VLAN
+	// which isn't configured on the switch.
+	replyStatusBadVlan = 3
 )
 
 // HasIp returns a boolean indicating whether the target is known
 // to have the given IP address.
-func (o defaultTarget) HasIp(in *net.IP) bool {
+func (o *defaultTarget) HasIp(in *net.IP) bool {
 	for _, i := range o.info {
 		if in.Equal(i.destination.IP) {
 			return true
@@ -84,9 +89,64 @@ func (o *defaultTarget) GetIps() []net.IP {
 	return out
 }
 
+// macQuery returns a query about a MAC address in a VLAN. The MAC is used
+// as the source, and the broadcast address as the destination: the switch
+// answers "source not found" only when it doesn't know the MAC. Otherwise
+// it carries on looking for the destination.
+func (o *defaultTarget) macQuery(mac net.HardwareAddr, vlan int) (message.Msg, error) {
+	return macQueryFrom(o.GetSrcIp(), mac, vlan)
+}
+
+// macQueryFrom is macQuery for a querier at srcIp.
+func macQueryFrom(srcIp net.IP, mac net.HardwareAddr, vlan int) (message.Msg, error) {
+	if vlan < vlanMin || vlan > vlanMax {
+		return nil, fmt.Errorf("%w: %d", ErrVlanOutOfRange, vlan)
+	}
+
+	builder := message.NewMsgBuilder()
+	builder.SetType(message.RequestSrc)
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.SrcMacType, mac.String()},
+		{attribute.DstMacType, "ffff.ffff.ffff"},
+		{attribute.VlanType, strconv.Itoa(vlan)},
+		{attribute.SrcIPv4Type, srcIp.String()},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			return nil, err
+		}
+		builder.SetAttr(att)
+	}
+
+	msg := builder.Build()
+	err := msg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// macFound interprets the reply to a macQuery.
+func macFound(reply message.Msg) (bool, error) {
+	status := reply.GetAttr(attribute.ReplyStatusType)
+	if status == nil {
+		return false, fmt.Errorf("no reply status: %s", reply.String())
+	}
+	switch {
+	case status.String() == attribute.ReplyStatusSrcNotFound:
+		return false, nil
+	case status.Bytes()[0] == replyStatusBadVlan:
+		return false, fmt.Errorf("%w: switch rejected the VLAN", ErrVlanOutOfRange)
+	}
+	return true, nil
+}
+
 func (o *defaultTarget) MacInVlan(mac net.HardwareAddr, vlan int) (bool, error) {
 	if vlan < 1 || vlan > 4094 {
-		return false, fmt.Errorf("vlan %d out of range", vlan)
+		return false, fmt.Errorf("%w: %d", ErrVlanOutOfRange, vlan)
 	}
 
 	var att attribute.Attribute
@@ -123,7 +183,7 @@ func (o *defaultTarget) MacInVlan(mac net.HardwareAddr, vlan int) (bool, error)
 
 	att, err = attribute.NewAttrBuilder().
 		SetType(attribute.SrcIPv4Type).
-		SetString(o.info[o.best].localAddr.String()).
+		SetString(o.GetSrcIp().String()).
 		Build()
 	if err != nil {
 		return false, err
@@ -147,3 +207,128 @@ func (o *defaultTarget) MacInVlan(mac net.HardwareAddr, vlan int) (bool, error)
 
 	return false, nil
 }
+
+// MacKnownInVlan queries the target about whether a MAC address is known
+// in a VLAN. Unlike MacInVlan, it names the MAC as the query's source (see
+// macQuery), so the answer doesn't depend on the switch finding a path.
+func (o *defaultTarget) MacKnownInVlan(mac net.HardwareAddr, vlan int) (bool, error) {
+	msg, err := o.macQuery(mac, vlan)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := o.Send(msg)
+	if err != nil {
+		return false, err
+	}
+
+	return macFound(response)
+}
+
+// MacVlan is a MAC address and VLAN pair.
+type MacVlan struct {
+	Mac  net.HardwareAddr
+	Vlan int
+}
+
+// MacSweepResult is the outcome of asking about one MacVlan.
+type MacSweepResult struct {
+	MacVlan
+	Found bool
+	Reply message.Msg
+	Err   error
+}
+
+// MacsInVlans is the bulk version of MacKnownInVlan. Results are in the same
+// order as the queries. If progressChan is not nil, it receives a
+// struct{} as each query completes.
+func (o *defaultTarget) MacsInVlans(queries []MacVlan, progressChan chan struct{}) []MacSweepResult {
+	out := make([]MacSweepResult, len(queries))
+	var msgs []message.Msg
+	var index []int // maps msgs to queries
+	for i, q := range queries {
+		out[i].MacVlan = q
+		msg, err := o.macQuery(q.Mac, q.Vlan)
+		if err != nil {
+			out[i].Err = err
+			continue
+		}
+		msgs = append(msgs, msg)
+		index = append(index, i)
+	}
+
+	for _, r := range o.SendBulkUnsafe(msgs, progressChan) {
+		i := index[r.Index]
+		out[i].Reply = r.Msg
+		out[i].Err = r.Err
+		if r.Err == nil {
+			out[i].Found, out[i].Err = macFound(r.Msg)
+		}
+	}
+	return out
+}
+
+// VlanResult is the outcome of asking about one VLAN.
+type VlanResult struct {
+	Vlan  int
+	Found bool
+	Reply message.Msg
+	Err   error
+}
+
+// SweepVlans asks the target about each VLAN from first to last. Results
+// are in VLAN order. If progressChan is not nil, it receives a struct{} as
+// each query completes.
+func SweepVlans(t Target, first int, last int, progressChan chan struct{}) ([]VlanResult, error) {
+	var queries []message.Msg
+	for v := first; v <= last; v++ {
+		msg, err := vlanQueryFrom(t.GetSrcIp(), v)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, msg)
+	}
+
+	out := make([]VlanResult, len(queries))
+	for i := range out {
+		out[i].Vlan = first + i
+	}
+
+	for _, r := range t.SendBulkUnsafe(queries, progressChan) {
+		out[r.Index].Reply = r.Msg
+		out[r.Index].Err = r.Err
+		if r.Err != nil {
+			continue
+		}
+		err := r.Msg.Validate()
+		if err != nil {
+			out[r.Index].Err = err
+			continue
+		}
+		out[r.Index].Found, out[r.Index].Err = vlanFound(r.Msg)
+	}
+	return out, nil
+}
+
+// Vlans asks the target about every VLAN, and returns the ones configured
+// on the switch. Errors for individual VLANs (which may or may not exist)
+// are returned alongside. If progressChan is not nil, it receives a
+// struct{} as each query completes.
+func Vlans(t Target, progressChan chan struct{}) ([]int, []error) {
+	results, err := SweepVlans(t, vlanMin, vlanMax, progressChan)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var found []int
+	var errs []error
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			errs = append(errs, fmt.Errorf("vlan %d: %w", r.Vlan, r.Err))
+		case r.Found:
+			found = append(found, r.Vlan)
+		}
+	}
+	return found, errs
+}
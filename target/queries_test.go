@@ -0,0 +1,131 @@
+package target
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestMacQuery(t *testing.T) {
+	tgt, err := TestTargetBuilder().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := net.ParseMAC("0011.2233.4455")
+
+	msg, err := tgt.(*defaultTarget).macQuery(mac, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetAttr(attribute.SrcMacType).String() != mac.String() {
+		t.Fatalf("expected source MAC %s, got %s", mac, msg.GetAttr(attribute.SrcMacType))
+	}
+
+	_, err = tgt.(*defaultTarget).macQuery(mac, 4095)
+	if !errors.Is(err, ErrVlanOutOfRange) {
+		t.Fatalf("expected ErrVlanOutOfRange, got %v", err)
+	}
+
+	// bad queries are reported without sending anything
+	results := tgt.MacsInVlans([]MacVlan{{Mac: mac, Vlan: 0}, {Mac: mac, Vlan: 5000}}, nil)
+	if len(results) != 2 || !errors.Is(results[0].Err, ErrVlanOutOfRange) || !errors.Is(results[1].Err, ErrVlanOutOfRange) {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestMacFound(t *testing.T) {
+	for _, test := range []struct {
+		status  uint32
+		found   bool
+		vlanErr bool
+	}{
+		{7, false, false}, // source not found
+		{8, true, false},  // source found, destination not found
+		{1, true, false},
+		{3, false, true},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(attribute.ReplyStatusType).SetInt(test.status).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply := message.NewMsgBuilder().SetType(message.ReplySrc).SetAttr(att).Build()
+
+		found, err := macFound(reply)
+		if found != test.found || errors.Is(err, ErrVlanOutOfRange) != test.vlanErr {
+			t.Fatalf("status %d: got %t, %v", test.status, found, err)
+		}
+	}
+
+	_, err := macFound(message.NewMsgBuilder().SetType(message.ReplySrc).Build())
+	if err == nil {
+		t.Fatal("reply without status should produce an error")
+	}
+}
+
+// vlanTarget answers VLAN queries, saying that the VLANs in exists are
+// configured. VLANs listed in failures fail with a temporary error that
+// many times first.
+type vlanTarget struct {
+	Target
+	lock     sync.Mutex
+	exists   map[string]bool
+	failures map[string]int
+}
+
+func (o *vlanTarget) GetSrcIp() net.IP {
+	return net.ParseIP("192.0.2.1")
+}
+
+func (o *vlanTarget) SendBulkUnsafe(out []message.Msg, progressChan chan struct{}) []BulkSendResult {
+	return sendBulk(o, out, progressChan)
+}
+
+func (o *vlanTarget) SendUnsafe(msg message.Msg) communicate.SendResult {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	vlan := msg.GetAttr(attribute.VlanType).String()
+	if o.failures[vlan] > 0 {
+		o.failures[vlan]--
+		return communicate.SendResult{Attempts: 1, Err: &communicate.SendError{Kind: communicate.ErrSocket, Err: temporaryError{}}}
+	}
+
+	status := uint32(8) // source found, destination not found
+	if o.exists[vlan] {
+		status = 7 // source not found
+	}
+	att, err := attribute.NewAttrBuilder().SetType(attribute.ReplyStatusType).SetInt(status).Build()
+	if err != nil {
+		return communicate.SendResult{Err: err}
+	}
+	reply := message.NewMsgBuilder().SetType(message.ReplySrc).SetAttr(att).Build()
+	return communicate.SendResult{Attempts: 1, ReplyData: reply.Marshal(nil)}
+}
+
+func TestSweepVlans(t *testing.T) {
+	tgt := &vlanTarget{
+		exists:   map[string]bool{"12": true, "40": true},
+		failures: map[string]int{"12": 2, "13": 1, "40": 1},
+	}
+	results, err := SweepVlans(tgt, 10, 60, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 51 {
+		t.Fatalf("expected 51 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Vlan != 10+i || r.Err != nil || r.Found != (r.Vlan == 12 || r.Vlan == 40) {
+			t.Fatalf("unexpected result: %+v", r)
+		}
+	}
+
+	_, err = SweepVlans(tgt, 4094, 4095, nil)
+	if !errors.Is(err, ErrVlanOutOfRange) {
+		t.Fatalf("expected ErrVlanOutOfRange, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package target
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QueryKind identifies the question a Query asks.
+type QueryKind int
+
+const (
+	// QueryVlanExists asks whether Vlan is configured on the switch.
+	QueryVlanExists QueryKind = iota
+
+	// QueryMacInVlan asks whether the switch knows Mac in Vlan, the way
+	// MacKnownInVlan() does.
+	QueryMacInVlan
+
+	// QueryTraceStep asks the switch about the layer 2 path from SrcMac
+	// to DstMac in Vlan: one hop of a trace.
+	QueryTraceStep
+)
+
+func (o QueryKind) String() string {
+	switch o {
+	case QueryVlanExists:
+		return "vlan-exists"
+	case QueryMacInVlan:
+		return "mac-in-vlan"
+	case QueryTraceStep:
+		return "trace-step"
+	}
+	return "query-kind-" + strconv.Itoa(int(o))
+}
+
+// Query is a question for a target. Which of the parameters matter depends
+// on Kind. Meta isn't sent anywhere: it's for the caller to recognize the
+// query when its result comes back.
+type Query struct {
+	Kind   QueryKind
+	Vlan   int
+	Mac    net.HardwareAddr // QueryMacInVlan
+	SrcMac net.HardwareAddr // QueryTraceStep
+	DstMac net.HardwareAddr // QueryTraceStep
+	Meta   interface{}
+}
+
+// message returns the L2T message which asks the query on behalf of a
+// querier at srcIp.
+func (o Query) message(srcIp net.IP) (message.Msg, error) {
+	switch o.Kind {
+	case QueryVlanExists:
+		return vlanQueryFrom(srcIp, o.Vlan)
+	case QueryMacInVlan:
+		return macQueryFrom(srcIp, o.Mac, o.Vlan)
+	case QueryTraceStep:
+		return traceQueryFrom(srcIp, o.SrcMac, o.DstMac, o.Vlan)
+	}
+	return nil, fmt.Errorf("%w: unknown kind %s", ErrBadQuery, o.Kind)
+}
+
+// interpret returns the answer carried by reply. Trace steps don't have
+// a yes/no answer: the caller has to look at the reply.
+func (o Query) interpret(reply message.Msg) (bool, error) {
+	switch o.Kind {
+	case QueryVlanExists:
+		return vlanFound(reply)
+	case QueryMacInVlan:
+		return macFound(reply)
+	}
+	return false, nil
+}
+
+// QueryResult is the outcome of a Query. Found is the answer to
+// QueryVlanExists and QueryMacInVlan queries. Attempts counts the
+// number of times the query was sent, including retries.
+type QueryResult struct {
+	Query    Query
+	Found    bool
+	Reply    message.Msg
+	Attempts int
+	Err      error
+}
+
+// RetryPolicy says what to do when a query fails. Retries is the number of
+// times the query is sent again, after waiting Backoff. Retry decides which
+// errors are worth another try. If it's nil, timeouts and temporary errors
+// are retried.
+type RetryPolicy struct {
+	Retries int
+	Backoff time.Duration
+	Retry   func(error) bool
+}
+
+// DefaultRetryPolicy applies to kinds of query missing from the policies
+// passed to RunQueries().
+var DefaultRetryPolicy = RetryPolicy{Retries: 1}
+
+// retry returns a boolean indicating whether err is worth retrying.
+func (o RetryPolicy) retry(err error) bool {
+	if o.Retry != nil {
+		return o.Retry(err)
+	}
+	ne, ok := err.(net.Error)
+	return ok && (ne.Timeout() || ne.Temporary())
+}
+
+// RunQueries asks the target each of the queries, retrying failures
+// according to the policy for their kind. Results are delivered on the
+// returned channel as they complete, which isn't necessarily the order of
+// the queries. The channel is closed after the last result, and must be
+// drained. Like SendBulkUnsafe(), it sends fewer queries at once while
+// the target is slow to answer.
+func RunQueries(t Target, queries []Query, policies map[QueryKind]RetryPolicy) <-chan QueryResult {
+	results := make(chan QueryResult)
+	go func() {
+		defer close(results)
+		srcIp := t.GetSrcIp()
+		pool := newBulkPool()
+
+		// the pool is adjusted by the routine collecting results
+		resultChan := make(chan QueryResult, len(queries))
+		collected := make(chan struct{})
+		go func() {
+			for r := range resultChan {
+				pool.adjust(BulkSendResult{Retries: r.Attempts - 1, Err: r.Err})
+				results <- r
+			}
+			close(collected)
+		}()
+
+		wg := &sync.WaitGroup{}
+		for _, q := range queries {
+			policy, ok := policies[q.Kind]
+			if !ok {
+				policy = DefaultRetryPolicy
+			}
+			pool.get()
+			wg.Add(1)
+			go func(q Query, policy RetryPolicy) {
+				defer wg.Done()
+				resultChan <- runQuery(t, srcIp, q, policy)
+				pool.put()
+			}(q, policy)
+		}
+		wg.Wait()
+		close(resultChan)
+		<-collected
+	}()
+	return results
+}
+
+// runQuery asks the target a single query, retrying according to policy.
+func runQuery(t Target, srcIp net.IP, q Query, policy RetryPolicy) QueryResult {
+	result := QueryResult{Query: q}
+	msg, err := q.message(srcIp)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	for {
+		result.Attempts++
+		in := t.SendUnsafe(msg)
+		result.Reply, result.Found, result.Err = nil, false, in.Err
+		if result.Err == nil {
+			result.Reply, result.Err = message.UnmarshalMessageUnsafe(in.ReplyData)
+		}
+		if result.Err == nil {
+			result.Found, result.Err = q.interpret(result.Reply)
+		}
+
+		if result.Err == nil || result.Attempts > policy.Retries || !policy.retry(result.Err) {
+			return result
+		}
+		time.Sleep(policy.Backoff)
+	}
+}
+
+// vlanQueryFrom returns a query, from a querier at srcIp, about whether
+// vlan is configured.
+func vlanQueryFrom(srcIp net.IP, vlan int) (message.Msg, error) {
+	if vlan < vlanMin || vlan > vlanMax {
+		return nil, fmt.Errorf("%w: %d", ErrVlanOutOfRange, vlan)
+	}
+
+	msg, err := message.TestMsg()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.VlanType, strconv.Itoa(vlan)},
+		{attribute.SrcIPv4Type, srcIp.String()},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			return nil, err
+		}
+		msg.SetAttr(att)
+	}
+	return msg, nil
+}
+
+// vlanFound interprets the reply to a vlanQueryFrom query. The switch
+// says "source not found" only when the VLAN exists.
+func vlanFound(reply message.Msg) (bool, error) {
+	status := reply.GetAttr(attribute.ReplyStatusType)
+	if status == nil {
+		return false, fmt.Errorf("no reply status: %s", reply.String())
+	}
+	return status.String() == attribute.ReplyStatusSrcNotFound, nil
+}
+
+// traceQueryFrom returns a query, from a querier at srcIp, about the path
+// from src to dst in vlan.
+func traceQueryFrom(srcIp net.IP, src net.HardwareAddr, dst net.HardwareAddr, vlan int) (message.Msg, error) {
+	if src == nil || dst == nil {
+		return nil, fmt.Errorf("%w: trace step needs source and destination MAC", ErrBadQuery)
+	}
+	if vlan < vlanMin || vlan > vlanMax {
+		return nil, fmt.Errorf("%w: %d", ErrVlanOutOfRange, vlan)
+	}
+
+	builder := message.NewMsgBuilder()
+	builder.SetType(message.RequestDst)
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.SrcMacType, src.String()},
+		{attribute.DstMacType, dst.String()},
+		{attribute.VlanType, strconv.Itoa(vlan)},
+		{attribute.SrcIPv4Type, srcIp.String()},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			return nil, err
+		}
+		builder.SetAttr(att)
+	}
+
+	msg := builder.Build()
+	err := msg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
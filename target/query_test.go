@@ -0,0 +1,118 @@
+package target
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"sync"
+	"testing"
+)
+
+// queryTarget answers queries with a reply status. VLANs listed in
+// timeouts time out that many times before being answered.
+type queryTarget struct {
+	Target
+	lock     sync.Mutex
+	timeouts map[string]int
+	sent     []message.Msg
+}
+
+func (o *queryTarget) GetSrcIp() net.IP {
+	return net.ParseIP("192.0.2.1")
+}
+
+func (o *queryTarget) SendUnsafe(msg message.Msg) communicate.SendResult {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.sent = append(o.sent, msg)
+
+	vlan := msg.GetAttr(attribute.VlanType).String()
+	if o.timeouts[vlan] > 0 {
+		o.timeouts[vlan]--
+		return communicate.SendResult{Err: &communicate.SendError{
+			Kind: communicate.ErrTimeout,
+			Err:  errors.New("timeout"),
+		}}
+	}
+
+	status := uint32(7) // source not found
+	if vlan == "20" {
+		status = 8
+	}
+	att, err := attribute.NewAttrBuilder().SetType(attribute.ReplyStatusType).SetInt(status).Build()
+	if err != nil {
+		return communicate.SendResult{Err: err}
+	}
+	reply := message.NewMsgBuilder().SetType(message.ReplySrc).SetAttr(att).Build()
+	return communicate.SendResult{ReplyData: reply.Marshal(nil)}
+}
+
+func TestRunQueries(t *testing.T) {
+	mac, _ := net.ParseMAC("0011.2233.4455")
+	tgt := &queryTarget{timeouts: map[string]int{"30": 1, "40": 5}}
+	queries := []Query{
+		{Kind: QueryVlanExists, Vlan: 10, Meta: "a"},
+		{Kind: QueryVlanExists, Vlan: 20, Meta: "b"},
+		{Kind: QueryVlanExists, Vlan: 30, Meta: "c"},
+		{Kind: QueryMacInVlan, Mac: mac, Vlan: 40, Meta: "d"},
+		{Kind: QueryMacInVlan, Mac: mac, Vlan: 5000, Meta: "e"},
+		{Kind: QueryTraceStep, SrcMac: mac, DstMac: mac, Vlan: 20, Meta: "f"},
+		{Kind: QueryTraceStep, Vlan: 20, Meta: "g"},
+	}
+	policies := map[QueryKind]RetryPolicy{QueryMacInVlan: {Retries: 2}}
+
+	got := make(map[string]QueryResult)
+	for r := range RunQueries(tgt, queries, policies) {
+		got[r.Query.Meta.(string)] = r
+	}
+	if len(got) != len(queries) {
+		t.Fatalf("expected %d results, got %d", len(queries), len(got))
+	}
+
+	for meta, expect := range map[string]struct {
+		found    bool
+		attempts int
+		err      error
+	}{
+		"a": {true, 1, nil},
+		"b": {false, 1, nil},
+		"c": {true, 2, nil},                     // default policy retries once
+		"d": {false, 3, communicate.ErrTimeout}, // gave up after two retries
+		"e": {false, 0, ErrVlanOutOfRange},
+		"f": {false, 1, nil},
+		"g": {false, 0, ErrBadQuery},
+	} {
+		r := got[meta]
+		if r.Found != expect.found || r.Attempts != expect.attempts {
+			t.Fatalf("query %s: unexpected result %+v", meta, r)
+		}
+		if (expect.err == nil && r.Err != nil) || (expect.err != nil && !errors.Is(r.Err, expect.err)) {
+			t.Fatalf("query %s: expected error %v, got %v", meta, expect.err, r.Err)
+		}
+	}
+
+	if r := got["f"]; r.Reply == nil {
+		t.Fatal("trace step should carry the reply")
+	}
+	for _, m := range tgt.sent {
+		if m.GetAttr(attribute.SrcIPv4Type).String() != "192.0.2.1" {
+			t.Fatalf("query named source %s", m.GetAttr(attribute.SrcIPv4Type))
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	timeout := &communicate.SendError{Kind: communicate.ErrTimeout, Err: errors.New("timeout")}
+	if !DefaultRetryPolicy.retry(timeout) {
+		t.Fatal("default policy should retry timeouts")
+	}
+	if DefaultRetryPolicy.retry(ErrBadQuery) {
+		t.Fatal("default policy shouldn't retry other errors")
+	}
+	never := RetryPolicy{Retries: 3, Retry: func(error) bool { return false }}
+	if never.retry(timeout) {
+		t.Fatal("custom policy ignored")
+	}
+}
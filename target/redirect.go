@@ -0,0 +1,55 @@
+package target
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+)
+
+// SendVia sends the message to the target's best address, with the source
+// IP attribute naming the Collector's address, so that the switch sends
+// its reply there rather than back to us. Any source IP attribute already
+// in the message is replaced. The target's address health isn't updated,
+// because a lost reply may be the collector's fault. The Collector must
+// listen on a specific address: a wildcard one can't be named in a query.
+func SendVia(t Target, msg message.Msg, c *communicate.Collector) (message.Msg, error) {
+	collectorIp := c.Addr().IP
+	if collectorIp == nil || collectorIp.IsUnspecified() {
+		return nil, fmt.Errorf("%w: collector listens on %s", ErrCollectorAddr, c.Addr())
+	}
+
+	srcIpAttr, err := attribute.NewSrcIpAttribute(collectorIp)
+	if err != nil {
+		return nil, err
+	}
+	msg.SetAttr(srcIpAttr)
+
+	p := t.Profile()
+	if len(p.Addresses) == 0 || p.Best >= len(p.Addresses) {
+		return nil, errors.New("target has no addresses")
+	}
+	best := p.Addresses[p.Best]
+
+	in := communicate.CommunicateVia(communicate.SendThis{
+		Payload: msg.Marshal([]attribute.Attribute{}),
+		Destination: &net.UDPAddr{
+			IP:   best.Destination,
+			Port: communicate.CiscoL2TPort,
+		},
+		ExpectReplyFrom: best.RepliesFrom,
+		RttGuess:        paddedRtt(best.Rtt),
+		Bind:            p.bind(),
+	}, c, nil)
+	if in.Err != nil {
+		return nil, in.Err
+	}
+
+	reply, err := message.UnmarshalMessageUnsafe(in.ReplyData)
+	if err != nil {
+		return nil, err
+	}
+	return reply, reply.Validate()
+}
@@ -0,0 +1,86 @@
+package target
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendVia(t *testing.T) {
+	switchIp := net.ParseIP("127.0.0.2")
+	c, err := communicate.NewCollector(&net.UDPAddr{IP: net.ParseIP("127.0.0.3")})
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.3 (loopback alias missing?): %s", err)
+	}
+	defer c.Close()
+
+	// fake switch replies to the query's source IP attribute
+	cxn, err := net.ListenUDP(communicate.UdpProtocol, &net.UDPAddr{IP: switchIp, Port: communicate.CiscoL2TPort})
+	if err != nil {
+		t.Skipf("cannot listen on %s: %s", switchIp, err)
+	}
+	defer cxn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		_ = cxn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, from, err := cxn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		query, err := message.UnmarshalMessage(buf[:n])
+		if err != nil {
+			return
+		}
+		replyTo := net.ParseIP(query.GetAttr(attribute.SrcIPv4Type).String())
+
+		status, _ := attribute.NewAttrBuilder().SetType(attribute.ReplyStatusType).SetString(attribute.ReplyStatusSrcNotFound).Build()
+		reply := message.NewMsgBuilder().SetType(message.ReplySrc).SetAttr(status).Build()
+		_, _ = cxn.WriteToUDP(reply.Marshal(nil), &net.UDPAddr{IP: replyTo, Port: from.Port})
+	}()
+
+	tgt, err := TestTargetBuilder().AddIp(switchIp).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := message.TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := SendVia(tgt, msg, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.GetAttr(attribute.ReplyStatusType).String() != attribute.ReplyStatusSrcNotFound {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	if msg.GetAttr(attribute.SrcIPv4Type).String() != "127.0.0.3" {
+		t.Fatalf("query should name the collector, got %s", msg.GetAttr(attribute.SrcIPv4Type))
+	}
+}
+
+func TestSendViaWildcard(t *testing.T) {
+	c, err := communicate.NewCollector(&net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tgt, err := TestTargetBuilder().AddIp(net.ParseIP("127.0.0.2")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := message.TestMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SendVia(tgt, msg, c)
+	if !errors.Is(err, ErrCollectorAddr) {
+		t.Fatalf("expected ErrCollectorAddr, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package target
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/message"
+	"io"
+	"net"
+	"sort"
+	"sync"
+)
+
+const (
+	bulkInitialWorkers = 5
+	bulkMaxWorkers     = 100
+
+	// bulkGrowAfter is the number of consecutive clean replies which
+	// earn the pool another worker.
+	bulkGrowAfter = 5
+)
+
+// bulkPool is a concurrency pool which shrinks when replies are slow to
+// come back, and grows while they're not.
+type bulkPool struct {
+	credits            chan struct{}
+	workers            int
+	msgsSinceLastRetry int
+}
+
+func newBulkPool() *bulkPool {
+	p := &bulkPool{
+		credits: make(chan struct{}, bulkMaxWorkers),
+		workers: bulkInitialWorkers,
+	}
+	for i := 0; i < p.workers; i++ {
+		p.credits <- struct{}{}
+	}
+	return p
+}
+
+// get blocks until a worker credit is available.
+func (o *bulkPool) get() {
+	<-o.credits
+}
+
+// put returns a worker credit to the pool.
+func (o *bulkPool) put() {
+	o.credits <- struct{}{}
+}
+
+// adjust resizes the pool based on a result. It's not safe for concurrent
+// use: call it from the routine collecting results.
+func (o *bulkPool) adjust(r BulkSendResult) {
+	switch err := r.Err.(type) {
+	case net.Error:
+		if err.Temporary() || err.Timeout() {
+			o.msgsSinceLastRetry = 0
+		}
+	default:
+		if r.Retries == 0 {
+			o.msgsSinceLastRetry++
+		} else {
+			o.msgsSinceLastRetry = 0
+		}
+	}
+
+	switch o.msgsSinceLastRetry {
+	case 0:
+		if o.workers > 1 {
+			o.get()
+			o.workers--
+		}
+	case bulkGrowAfter:
+		if o.workers < bulkMaxWorkers {
+			o.put()
+			o.workers++
+			o.msgsSinceLastRetry = 1
+		}
+	}
+}
+
+// bulkSend sends the message with the given index via the target, and
+// returns the result.
+func bulkSend(t Target, index int, msg message.Msg) BulkSendResult {
+	reply := t.SendUnsafe(msg)
+
+	var inMsg message.Msg
+	replyErr := reply.Err
+	if replyErr == nil {
+		inMsg, replyErr = message.UnmarshalMessageUnsafe(reply.ReplyData)
+	}
+
+	return BulkSendResult{
+		Index:   index,
+		Retries: reply.Attempts - 1,
+		Msg:     inMsg,
+		Err:     replyErr,
+	}
+}
+
+// isTemporary returns a boolean indicating whether err is a temporary
+// error, in which case the message should be sent again.
+func isTemporary(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Temporary()
+}
+
+// Checkpoint records which messages of a bulk send are done, so that an
+// interrupted send can pick up where it left off. Done holds indexes into
+// the slice of Total messages.
+type Checkpoint struct {
+	Total int   `json:"total"`
+	Done  []int `json:"done"`
+}
+
+// SaveCheckpoint writes c to w in JSON format.
+func SaveCheckpoint(c Checkpoint, w io.Writer) error {
+	return json.NewEncoder(w).Encode(c)
+}
+
+// LoadCheckpoint reads a JSON format Checkpoint from r.
+func LoadCheckpoint(r io.Reader) (Checkpoint, error) {
+	var c Checkpoint
+	err := json.NewDecoder(r).Decode(&c)
+	if err != nil {
+		return c, err
+	}
+	return c, c.validate(c.Total)
+}
+
+// validate returns an error if the checkpoint doesn't describe a bulk
+// send of total messages.
+func (o Checkpoint) validate(total int) error {
+	if o.Total != total {
+		return fmt.Errorf("%w: checkpoint is for %d messages, not %d", ErrBadCheckpoint, o.Total, total)
+	}
+	for _, i := range o.Done {
+		if i < 0 || i >= o.Total {
+			return fmt.Errorf("%w: index %d out of range", ErrBadCheckpoint, i)
+		}
+	}
+	return nil
+}
+
+// BulkStream is a bulk send in progress. Unlike SendBulkUnsafe(), which
+// returns everything at the end, it delivers each result as it arrives.
+// Messages which fail with temporary errors are sent again after the
+// others, and only their final result is delivered.
+type BulkStream struct {
+	results chan BulkSendResult
+	lock    sync.Mutex
+	cond    *sync.Cond
+	paused  bool
+	stopped bool
+	total   int
+	done    map[int]bool
+}
+
+// StreamBulk starts sending the messages to the target. If resume is not
+// nil, messages it lists as done are skipped.
+func StreamBulk(t Target, out []message.Msg, resume *Checkpoint) (*BulkStream, error) {
+	s := &BulkStream{
+		results: make(chan BulkSendResult),
+		total:   len(out),
+		done:    make(map[int]bool),
+	}
+	s.cond = sync.NewCond(&s.lock)
+
+	if resume != nil {
+		err := resume.validate(len(out))
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range resume.Done {
+			s.done[i] = true
+		}
+	}
+
+	var queue []int
+	for i := range out {
+		if !s.done[i] {
+			queue = append(queue, i)
+		}
+	}
+
+	go s.run(t, out, queue)
+	return s, nil
+}
+
+// Results returns the channel on which results are delivered. It's closed
+// when every message is done, or after Stop(). It must be drained.
+func (o *BulkStream) Results() <-chan BulkSendResult {
+	return o.results
+}
+
+// Pause stops new messages from being sent until Resume() is called.
+// Results for messages already sent keep arriving.
+func (o *BulkStream) Pause() {
+	o.lock.Lock()
+	o.paused = true
+	o.lock.Unlock()
+}
+
+// Resume undoes Pause().
+func (o *BulkStream) Resume() {
+	o.lock.Lock()
+	o.paused = false
+	o.lock.Unlock()
+	o.cond.Broadcast()
+}
+
+// Stop abandons the messages which haven't been sent yet. The results
+// channel is closed once messages already sent are done.
+func (o *BulkStream) Stop() {
+	o.lock.Lock()
+	o.stopped = true
+	o.lock.Unlock()
+	o.cond.Broadcast()
+}
+
+// Checkpoint returns a Checkpoint listing the messages whose results have
+// been delivered. Resuming from it won't lose any results, but might
+// repeat the most recent one.
+func (o *BulkStream) Checkpoint() Checkpoint {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	c := Checkpoint{Total: o.total, Done: []int{}}
+	for i := range o.done {
+		c.Done = append(c.Done, i)
+	}
+	sort.Ints(c.Done)
+	return c
+}
+
+// proceed blocks while the stream is paused. It returns a boolean
+// indicating whether sending should carry on.
+func (o *BulkStream) proceed() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for o.paused && !o.stopped {
+		o.cond.Wait()
+	}
+	return !o.stopped
+}
+
+// run sends the queued messages, then sends the ones which failed with
+// temporary errors again, and so on, until none are left.
+func (o *BulkStream) run(t Target, out []message.Msg, queue []int) {
+	defer close(o.results)
+	pool := newBulkPool()
+	for len(queue) > 0 && o.proceed() {
+		queue = o.round(t, out, queue, pool)
+	}
+}
+
+// round sends the messages listed in queue and delivers their results. It
+// returns the messages which should be sent again.
+func (o *BulkStream) round(t Target, out []message.Msg, queue []int, pool *bulkPool) []int {
+	resultChan := make(chan BulkSendResult, len(queue))
+	collected := make(chan []int)
+	go func() {
+		var retry []int
+		for r := range resultChan {
+			pool.adjust(r)
+			if isTemporary(r.Err) {
+				retry = append(retry, r.Index)
+				continue
+			}
+			o.results <- r
+			o.lock.Lock()
+			o.done[r.Index] = true
+			o.lock.Unlock()
+		}
+		collected <- retry
+	}()
+
+	wg := &sync.WaitGroup{}
+	for _, i := range queue {
+		if !o.proceed() {
+			break
+		}
+		pool.get()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resultChan <- bulkSend(t, i, out[i])
+			pool.put()
+		}(i)
+	}
+	wg.Wait()
+	close(resultChan)
+
+	return <-collected
+}
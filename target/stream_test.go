@@ -0,0 +1,203 @@
+package target
+
+import (
+	"bytes"
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// temporaryError is a net.Error which says it's temporary.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// streamTarget answers every message after a delay, identifying it by
+// VLAN. VLANs listed in failures fail with a temporary error that many
+// times first.
+type streamTarget struct {
+	Target
+	delay    time.Duration
+	lock     sync.Mutex
+	failures map[string]int
+	sent     int
+}
+
+func (o *streamTarget) SendUnsafe(msg message.Msg) communicate.SendResult {
+	time.Sleep(o.delay)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.sent++
+
+	vlan := msg.GetAttr(attribute.VlanType).String()
+	if o.failures[vlan] > 0 {
+		o.failures[vlan]--
+		return communicate.SendResult{Attempts: 1, Err: &communicate.SendError{Kind: communicate.ErrSocket, Err: temporaryError{}}}
+	}
+	reply := message.NewMsgBuilder().SetType(message.ReplySrc).Build()
+	return communicate.SendResult{Attempts: 1, ReplyData: reply.Marshal(nil)}
+}
+
+func (o *streamTarget) sentCount() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.sent
+}
+
+func streamMsgs(t *testing.T, n int) []message.Msg {
+	var out []message.Msg
+	for v := vlanMin; v < vlanMin+n; v++ {
+		msg, err := vlanQueryFrom(net.ParseIP("192.0.2.1"), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+func TestStreamBulk(t *testing.T) {
+	tgt := &streamTarget{failures: map[string]int{"3": 1, "7": 2}}
+	s, err := StreamBulk(tgt, streamMsgs(t, 50), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool)
+	for r := range s.Results() {
+		if r.Err != nil || seen[r.Index] {
+			t.Fatalf("unexpected result: %+v", r)
+		}
+		seen[r.Index] = true
+	}
+	if len(seen) != 50 || tgt.sentCount() != 53 {
+		t.Fatalf("got %d results from %d sends", len(seen), tgt.sentCount())
+	}
+	if c := s.Checkpoint(); c.Total != 50 || len(c.Done) != 50 {
+		t.Fatalf("unexpected checkpoint: %+v", c)
+	}
+}
+
+func TestStreamBulkPause(t *testing.T) {
+	tgt := &streamTarget{delay: 5 * time.Millisecond}
+	s, err := StreamBulk(tgt, streamMsgs(t, 40), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got int
+	for range s.Results() {
+		got++
+		if got == 5 {
+			s.Pause()
+			break
+		}
+	}
+
+	// drain what's in flight, after which nothing more gets sent
+	drained := make(chan int)
+	go func() {
+		var n int
+		for range s.Results() {
+			n++
+		}
+		drained <- n
+	}()
+	time.Sleep(100 * time.Millisecond)
+	sent := tgt.sentCount()
+	time.Sleep(100 * time.Millisecond)
+	if tgt.sentCount() != sent || sent == 40 {
+		t.Fatalf("sent %d then %d messages while paused", sent, tgt.sentCount())
+	}
+
+	s.Resume()
+	if n := <-drained; got+n != 40 {
+		t.Fatalf("expected 40 results, got %d", got+n)
+	}
+}
+
+func TestStreamBulkResume(t *testing.T) {
+	msgs := streamMsgs(t, 40)
+	tgt := &streamTarget{delay: 5 * time.Millisecond}
+	s, err := StreamBulk(tgt, msgs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool)
+	for r := range s.Results() {
+		seen[r.Index] = true
+		if len(seen) == 10 {
+			s.Stop()
+		}
+	}
+	if len(seen) == 40 {
+		t.Fatal("stop had no effect")
+	}
+
+	// save and reload the checkpoint, then finish the job
+	buf := &bytes.Buffer{}
+	err = SaveCheckpoint(s.Checkpoint(), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCheckpoint(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Done) != len(seen) {
+		t.Fatalf("checkpoint has %d done, saw %d", len(c.Done), len(seen))
+	}
+
+	s, err = StreamBulk(tgt, msgs, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := range s.Results() {
+		if seen[r.Index] {
+			t.Fatalf("message %d sent again", r.Index)
+		}
+		seen[r.Index] = true
+	}
+	if len(seen) != 40 {
+		t.Fatalf("expected 40 results, got %d", len(seen))
+	}
+}
+
+func TestBadCheckpoint(t *testing.T) {
+	for _, c := range []string{
+		`{"total": 2, "done": [2]}`,
+		`{"total": 2, "done": [-1]}`,
+	} {
+		_, err := LoadCheckpoint(bytes.NewBufferString(c))
+		if !errors.Is(err, ErrBadCheckpoint) {
+			t.Fatalf("%s: expected ErrBadCheckpoint, got %v", c, err)
+		}
+	}
+
+	_, err := StreamBulk(&streamTarget{}, streamMsgs(t, 3), &Checkpoint{Total: 2})
+	if !errors.Is(err, ErrBadCheckpoint) {
+		t.Fatalf("expected ErrBadCheckpoint, got %v", err)
+	}
+}
+
+func TestBulkPool(t *testing.T) {
+	p := newBulkPool()
+	for i := 0; i < bulkGrowAfter; i++ {
+		p.adjust(BulkSendResult{})
+	}
+	if p.workers != bulkInitialWorkers+1 {
+		t.Fatalf("expected pool to grow, have %d workers", p.workers)
+	}
+	p.adjust(BulkSendResult{Err: &communicate.SendError{Kind: communicate.ErrTimeout, Err: errors.New("timeout")}})
+	if p.workers != bulkInitialWorkers {
+		t.Fatalf("expected pool to shrink, have %d workers", p.workers)
+	}
+}
@@ -0,0 +1,202 @@
+package target
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"strconv"
+)
+
+// Presence describes what's known about whether a switch knows a MAC.
+type Presence int
+
+const (
+	PresenceUnknown Presence = iota
+	PresenceAbsent
+	PresencePresent
+	PresenceConflicting // replies disagree
+)
+
+func (o Presence) String() string {
+	switch o {
+	case PresenceAbsent:
+		return "absent"
+	case PresencePresent:
+		return "present"
+	case PresenceConflicting:
+		return "conflicting"
+	}
+	return "unknown"
+}
+
+func (o Presence) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// note combines a new observation with what's already known.
+func (o Presence) note(p Presence) Presence {
+	switch {
+	case p == PresenceUnknown || o == p:
+		return o
+	case o == PresenceUnknown:
+		return p
+	}
+	return PresenceConflicting
+}
+
+// SwapReply is the outcome of one of the queries sent by SwapProbe.
+type SwapReply struct {
+	Type       message.MsgType  `json:"type"`
+	Src        net.HardwareAddr `json:"src"`
+	Dst        net.HardwareAddr `json:"dst"`
+	Status     string           `json:"status,omitempty"`
+	InPort     string           `json:"in_port,omitempty"`
+	OutPort    string           `json:"out_port,omitempty"`
+	Neighbor   string           `json:"neighbor,omitempty"`
+	NeighborId string           `json:"neighbor_id,omitempty"`
+	Reply      message.Msg      `json:"-"`
+	Err        error            `json:"-"`
+}
+
+// MacEvidence is what SwapProbe learned about one of the MACs.
+type MacEvidence struct {
+	Mac      net.HardwareAddr `json:"mac"`
+	Presence Presence         `json:"presence"`
+	Port     string           `json:"port,omitempty"` // where the switch learned the MAC
+}
+
+// SwapResult combines the evidence from all of the queries sent by
+// SwapProbe.
+type SwapResult struct {
+	Vlan      int         `json:"vlan"`
+	A         MacEvidence `json:"a"`
+	B         MacEvidence `json:"b"`
+	Neighbors []string    `json:"neighbors,omitempty"`
+	Replies   []SwapReply `json:"replies"`
+}
+
+// SwapProbe asks the target about a pair of MACs in a VLAN four ways:
+// L2T_REQUEST_SRC and L2T_REQUEST_DST, each with the MACs in both orders.
+// The replies reveal different things: "source not found" says nothing
+// about the destination, while "destination not found" means the source
+// was found. Replies to individual queries which fail are recorded in the
+// SwapResult. An error is returned only if none of the queries got a
+// reply.
+func SwapProbe(t Target, a net.HardwareAddr, b net.HardwareAddr, vlan int) (SwapResult, error) {
+	result := SwapResult{
+		Vlan: vlan,
+		A:    MacEvidence{Mac: a},
+		B:    MacEvidence{Mac: b},
+	}
+	if vlan < vlanMin || vlan > vlanMax {
+		return result, fmt.Errorf("%w: %d", ErrVlanOutOfRange, vlan)
+	}
+
+	evidence := map[string]*MacEvidence{
+		a.String(): &result.A,
+		b.String(): &result.B,
+	}
+	neighbors := make(map[string]bool)
+
+	var replied bool
+	var lastErr error
+	for _, msgType := range []message.MsgType{message.RequestSrc, message.RequestDst} {
+		for _, pair := range [][2]net.HardwareAddr{{a, b}, {b, a}} {
+			r := swapQuery(t, msgType, pair[0], pair[1], vlan)
+			result.Replies = append(result.Replies, r)
+			if r.Err != nil {
+				lastErr = r.Err
+				continue
+			}
+			replied = true
+
+			src, dst := evidence[r.Src.String()], evidence[r.Dst.String()]
+			srcPresence, dstPresence := interpretStatus(r.Reply)
+			src.Presence = src.Presence.note(srcPresence)
+			dst.Presence = dst.Presence.note(dstPresence)
+			if src.Port == "" {
+				src.Port = r.InPort
+			}
+			if dst.Port == "" {
+				dst.Port = r.OutPort
+			}
+
+			if r.Neighbor != "" && !neighbors[r.Neighbor] {
+				neighbors[r.Neighbor] = true
+				result.Neighbors = append(result.Neighbors, r.Neighbor)
+			}
+		}
+	}
+
+	if !replied {
+		return result, lastErr
+	}
+	return result, nil
+}
+
+// swapQuery sends one of SwapProbe's queries.
+func swapQuery(t Target, msgType message.MsgType, src net.HardwareAddr, dst net.HardwareAddr, vlan int) SwapReply {
+	r := SwapReply{Type: msgType, Src: src, Dst: dst}
+
+	builder := message.NewMsgBuilder().SetType(msgType)
+	for _, a := range []struct {
+		t attribute.AttrType
+		s string
+	}{
+		{attribute.SrcMacType, src.String()},
+		{attribute.DstMacType, dst.String()},
+		{attribute.VlanType, strconv.Itoa(vlan)},
+	} {
+		att, err := attribute.NewAttrBuilder().SetType(a.t).SetString(a.s).Build()
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		builder.SetAttr(att)
+	}
+
+	r.Reply, r.Err = t.Send(builder.Build())
+	if r.Reply == nil {
+		return r
+	}
+	r.Err = nil // a reply which doesn't validate is still evidence
+
+	for _, f := range []struct {
+		t attribute.AttrType
+		s *string
+	}{
+		{attribute.ReplyStatusType, &r.Status},
+		{attribute.InPortNameType, &r.InPort},
+		{attribute.OutPortNameType, &r.OutPort},
+		{attribute.NbrIPv4Type, &r.Neighbor},
+		{attribute.NbrDevIDType, &r.NeighborId},
+	} {
+		if a := r.Reply.GetAttr(f.t); a != nil {
+			*f.s = a.String()
+		}
+	}
+	return r
+}
+
+// interpretStatus says what a reply's status reveals about the query's
+// source and destination MACs. The switch looks for the source first, so
+// "source not found" says nothing about the destination.
+func interpretStatus(reply message.Msg) (Presence, Presence) {
+	status := reply.GetAttr(attribute.ReplyStatusType)
+	if status == nil || len(status.Bytes()) != 1 || status.Bytes()[0] == replyStatusBadVlan {
+		return PresenceUnknown, PresenceUnknown
+	}
+
+	switch status.String() {
+	case attribute.ReplyStatusSrcNotFound:
+		return PresenceAbsent, PresenceUnknown
+	case attribute.ReplyStatusDstNotFound:
+		return PresencePresent, PresenceAbsent
+	case attribute.ReplyStatusSuccess, attribute.ReplyStatusMultipleNeighbors, attribute.ReplyStatusNoNeighbor:
+		return PresencePresent, PresencePresent
+	}
+
+	// Some other complaint. The switch got past the source, at least.
+	return PresencePresent, PresenceUnknown
+}
@@ -0,0 +1,90 @@
+package target
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+)
+
+// swapTarget answers queries as a switch which knows only the MACs in
+// its ports map.
+type swapTarget struct {
+	Target
+	ports map[string]string
+}
+
+func (o swapTarget) Send(msg message.Msg) (message.Msg, error) {
+	src := msg.GetAttr(attribute.SrcMacType).String()
+	dst := msg.GetAttr(attribute.DstMacType).String()
+
+	builder := message.NewMsgBuilder().SetType(message.ReplySrc)
+	set := func(t attribute.AttrType, s string) {
+		a, err := attribute.NewAttrBuilder().SetType(t).SetString(s).Build()
+		if err != nil {
+			panic(err)
+		}
+		builder.SetAttr(a)
+	}
+
+	switch {
+	case o.ports[src] == "":
+		set(attribute.ReplyStatusType, attribute.ReplyStatusSrcNotFound)
+	case o.ports[dst] == "":
+		set(attribute.ReplyStatusType, attribute.ReplyStatusDstNotFound)
+	default:
+		set(attribute.ReplyStatusType, attribute.ReplyStatusSuccess)
+		set(attribute.InPortNameType, o.ports[src])
+		set(attribute.OutPortNameType, o.ports[dst])
+		set(attribute.NbrIPv4Type, "192.0.2.2")
+	}
+	return builder.Build(), nil
+}
+
+func TestSwapProbe(t *testing.T) {
+	a, _ := net.ParseMAC("0011.2233.4455")
+	b, _ := net.ParseMAC("0011.2233.6677")
+
+	for _, test := range []struct {
+		ports     map[string]string
+		a         Presence
+		b         Presence
+		aPort     string
+		bPort     string
+		neighbors int
+	}{
+		{map[string]string{}, PresenceAbsent, PresenceAbsent, "", "", 0},
+		{map[string]string{a.String(): "Gi1/0/1"}, PresencePresent, PresenceAbsent, "", "", 0},
+		{map[string]string{a.String(): "Gi1/0/1", b.String(): "Gi1/0/2"}, PresencePresent, PresencePresent, "Gi1/0/1", "Gi1/0/2", 1},
+	} {
+		r, err := SwapProbe(swapTarget{ports: test.ports}, a, b, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Replies) != 4 {
+			t.Fatalf("expected 4 replies, got %d", len(r.Replies))
+		}
+		if r.A.Presence != test.a || r.B.Presence != test.b {
+			t.Fatalf("expected %s/%s, got %s/%s", test.a, test.b, r.A.Presence, r.B.Presence)
+		}
+		if r.A.Port != test.aPort || r.B.Port != test.bPort {
+			t.Fatalf("expected ports %s/%s, got %s/%s", test.aPort, test.bPort, r.A.Port, r.B.Port)
+		}
+		if len(r.Neighbors) != test.neighbors {
+			t.Fatalf("expected %d neighbors, got %v", test.neighbors, r.Neighbors)
+		}
+	}
+
+	_, err := SwapProbe(swapTarget{}, a, b, 0)
+	if !errors.Is(err, ErrVlanOutOfRange) {
+		t.Fatalf("expected ErrVlanOutOfRange, got %v", err)
+	}
+}
+
+func TestPresenceNote(t *testing.T) {
+	p := PresenceUnknown.note(PresenceAbsent)
+	if p != PresenceAbsent || p.note(PresenceUnknown) != PresenceAbsent || p.note(PresencePresent) != PresenceConflicting {
+		t.Fatal("unexpected presence combination")
+	}
+}
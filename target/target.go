@@ -18,9 +18,14 @@ const (
 type Target interface {
 	GetIps() []net.IP
 	GetLocalIp() net.IP
+	GetSrcIp() net.IP
 	HasIp(*net.IP) bool
 	HasVlan(int) (bool, error)
+	Health() []AddressHealth
 	MacInVlan(net.HardwareAddr, int) (bool, error)
+	MacKnownInVlan(net.HardwareAddr, int) (bool, error)
+	MacsInVlans([]MacVlan, chan struct{}) []MacSweepResult
+	Profile() Profile
 	Reachable() bool
 	Send(message.Msg) (message.Msg, error)
 	SendBulkUnsafe([]message.Msg, chan struct{}) []BulkSendResult
@@ -35,17 +40,54 @@ type defaultTarget struct {
 	name      string
 	platform  string
 	mgmtIp    net.IP
-	rttLock   sync.Mutex
+	bind      communicate.Bind
+	lock      sync.Mutex // protects info and best
 }
 
 func (o *defaultTarget) GetLocalIp() net.IP {
-	return o.info[o.best].localAddr
+	_, ti := o.current()
+	return ti.localAddr
+}
+
+// GetSrcIp returns the address queries should name as their source. It's
+// the local address unless we're advertising another one (NAT).
+func (o *defaultTarget) GetSrcIp() net.IP {
+	return o.bind.SrcIp(o.GetLocalIp())
+}
+
+// replySources returns the addresses from which replies are accepted
+// in NAT mode: every address the target is known by. Otherwise, it's nil.
+func (o *defaultTarget) replySources() []net.IP {
+	if !o.bind.Nat() {
+		return nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var out []net.IP
+	for _, ti := range o.info {
+		for _, ip := range []net.IP{ti.destination.IP, ti.theirSource} {
+			if ip != nil && addressIsNew(ip, out) {
+				out = append(out, ip)
+			}
+		}
+	}
+	return out
 }
 
 func (o *defaultTarget) Reachable() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
 	return o.reachable
 }
 
+// current returns the index of the targetInfo currently in use,
+// along with a copy of it.
+func (o *defaultTarget) current() (int, targetInfo) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.best, o.info[o.best]
+}
+
 type BulkSendResult struct {
 	Index   int
 	Retries int
@@ -53,7 +95,16 @@ type BulkSendResult struct {
 	Err     error
 }
 
+// SendBulkUnsafe sends the messages concurrently, and returns once every
+// one is done. StreamBulk() delivers results as they arrive instead.
 func (o *defaultTarget) SendBulkUnsafe(out []message.Msg, progressChan chan struct{}) []BulkSendResult {
+	return sendBulk(o, out, progressChan)
+}
+
+// sendBulk is SendBulkUnsafe() for any Target. The Index of each result
+// refers to the message's position in out, including for messages which
+// had to be sent more than once.
+func sendBulk(t Target, out []message.Msg, progressChan chan struct{}) []BulkSendResult {
 	resultChan := make(chan BulkSendResult, len(out))
 	finalResultChan := make(chan []BulkSendResult)
 
@@ -64,85 +115,32 @@ func (o *defaultTarget) SendBulkUnsafe(out []message.Msg, progressChan chan stru
 	wg := &sync.WaitGroup{}
 	wg.Add(len(out))
 
-	// Initialize the worker pool (channel)
-	maxWorkers := 100
-	workers := 5
-	workerPool := make(chan struct{}, maxWorkers)
-	for i := 0; i < workers; i++ {
-		workerPool <- struct{}{} //add worker credits to the workerPool
-	}
+	pool := newBulkPool()
 
 	// collect results from all of the child routines;
-	// tweak workerPool as necessary
+	// tweak the pool as necessary
 	go func() {
-		msgsSinceLastRetry := 0
 		var results []BulkSendResult
 		for r := range resultChan { // loop until resultChan closes
 			results = append(results, r) // collect the reply
 			wg.Done()
 
-			updatePBar := true
-			switch r.Err.(type) {
-			case (net.Error):
-				if r.Err.(net.Error).Temporary() {
-					updatePBar = false
-					msgsSinceLastRetry = 0
-				}
-				if r.Err.(net.Error).Timeout() {
-					updatePBar = true
-					msgsSinceLastRetry = 0
-				}
-			default:
-				updatePBar = true
-				if r.Retries == 0 {
-					msgsSinceLastRetry++
-				} else {
-					msgsSinceLastRetry = 0
-				}
-			}
-
-			if updatePBar {
-				if progressChan != nil {
-					progressChan <- struct{}{}
-				}
+			// temporary errors get retried, so don't count them
+			if progressChan != nil && !isTemporary(r.Err) {
+				progressChan <- struct{}{}
 			}
 
-			switch msgsSinceLastRetry {
-			case 0:
-				if workers > 1 {
-					<-workerPool
-					workers--
-				}
-			case 5:
-				if workers < maxWorkers {
-					workerPool <- struct{}{}
-					workers++
-					msgsSinceLastRetry = 1
-				}
-			}
+			pool.adjust(r)
 		}
 		finalResultChan <- results
 	}()
 
 	// main loop instantiates a worker (pool permitting) to send each message
 	for index, outMsg := range out {
-		<-workerPool                    // Block until possible to get a worker credit
+		pool.get()                      // Block until possible to get a worker credit
 		go func(i int, m message.Msg) { // Start a worker routine
-			reply := o.SendUnsafe(m)
-
-			var inMsg message.Msg
-			replyErr := reply.Err
-			if replyErr == nil {
-				inMsg, replyErr = message.UnmarshalMessageUnsafe(reply.ReplyData)
-			}
-
-			resultChan <- BulkSendResult{
-				Index:   i,
-				Retries: reply.Attempts - 1,
-				Msg:     inMsg,
-				Err:     replyErr,
-			}
-			workerPool <- struct{}{} // Worker done, return credit to the pool
+			resultChan <- bulkSend(t, i, m)
+			pool.put() // Worker done, return credit to the pool
 		}(index, outMsg)
 
 	}
@@ -154,10 +152,12 @@ func (o *defaultTarget) SendBulkUnsafe(out []message.Msg, progressChan chan stru
 
 	var goodResults []BulkSendResult
 	var retry []message.Msg
+	var retryIndex []int // maps retry to out
 
 	for _, ir := range interimResults {
-		if x, ok := ir.Err.(net.Error); ok && x.Temporary() {
+		if isTemporary(ir.Err) {
 			retry = append(retry, out[ir.Index])
+			retryIndex = append(retryIndex, ir.Index)
 		} else {
 			goodResults = append(goodResults, ir)
 		}
@@ -165,7 +165,10 @@ func (o *defaultTarget) SendBulkUnsafe(out []message.Msg, progressChan chan stru
 
 	var retryResult []BulkSendResult
 	if len(retry) != 0 {
-		retryResult = o.SendBulkUnsafe(retry, progressChan)
+		retryResult = sendBulk(t, retry, progressChan)
+		for i := range retryResult {
+			retryResult[i].Index = retryIndex[retryResult[i].Index]
+		}
 	}
 
 	return append(goodResults, retryResult...)
@@ -173,10 +176,7 @@ func (o *defaultTarget) SendBulkUnsafe(out []message.Msg, progressChan chan stru
 
 func (o *defaultTarget) Send(out message.Msg) (message.Msg, error) {
 	if out.NeedsSrcIp() {
-		srcIpAttr, err := attribute.NewAttrBuilder().
-			SetType(attribute.SrcIPv4Type).
-			SetString(o.info[o.best].localAddr.String()).
-			Build()
+		srcIpAttr, err := attribute.NewSrcIpAttribute(o.GetSrcIp())
 		if err != nil {
 			return nil, err
 		}
@@ -201,20 +201,35 @@ func (o *defaultTarget) Send(out message.Msg) (message.Msg, error) {
 	return inMsg, nil
 }
 
+// SendUnsafe sends the message via the target's best address. Repeated
+// timeouts cause the target to fail over to its next best address, in which
+// case the message is sent again via the new address.
 func (o *defaultTarget) SendUnsafe(msg message.Msg) communicate.SendResult {
 	payload := msg.Marshal([]attribute.Attribute{})
 
-	out := communicate.SendThis{
-		Payload:         payload,
-		Destination:     o.info[o.best].destination,
-		ExpectReplyFrom: o.info[o.best].theirSource,
-		RttGuess:        o.estimateLatency(),
-	}
+	var in communicate.SendResult
+	for attempt := 0; attempt < len(o.info); attempt++ {
+		index, ti := o.current()
+		out := communicate.SendThis{
+			Payload:         payload,
+			Destination:     ti.destination,
+			ExpectReplyFrom: ti.theirSource,
+			RttGuess:        paddedRtt(ti.rtt),
+			Bind:            o.bind,
+			AcceptFrom:      o.replySources(),
+		}
 
-	in := communicate.Communicate(out, nil)
+		in = communicate.Communicate(out, nil)
 
-	if in.Err == nil {
-		o.updateLatency(o.best, in.Rtt)
+		if in.Err == nil {
+			o.recordSuccess(index, in.Rtt)
+			return in
+		}
+
+		timeout, ok := in.Err.(net.Error)
+		if !ok || !timeout.Timeout() || !o.recordTimeout(index) {
+			return in
+		}
 	}
 
 	return in
@@ -247,8 +262,18 @@ func (o *defaultTarget) String() string {
 		out.WriteString(o.mgmtIp.String())
 	}
 
+	// work from a snapshot: replies update info as we go
+	o.lock.Lock()
+	info := make([]targetInfo, len(o.info))
+	for i, ti := range o.info {
+		info[i] = ti
+		info[i].rtt = append([]time.Duration(nil), ti.rtt...)
+	}
+	best := info[o.best]
+	o.lock.Unlock()
+
 	out.WriteString("\n  Known IP Addresses:")
-	for _, i := range o.info {
+	for _, i := range info {
 		var avgRttStr string
 		switch len(i.rtt){
 		case 0: avgRttStr = ""
@@ -261,13 +286,13 @@ func (o *defaultTarget) String() string {
 	}
 
 	out.WriteString("\n  Target address:      ")
-	out.WriteString(o.info[o.best].destination.IP.String())
+	out.WriteString(best.destination.IP.String())
 
 	out.WriteString("\n  Listen address:      ")
-	out.WriteString(o.info[o.best].theirSource.String())
+	out.WriteString(best.theirSource.String())
 
 	out.WriteString("\n  Local address:       ")
-	out.WriteString(o.info[o.best].localAddr.String())
+	out.WriteString(best.localAddr.String())
 
 	return out.String()
 }
@@ -287,10 +312,23 @@ func averageRtt (in []time.Duration) time.Duration{
 // estimateLatency tries to estimate the response time for this target
 // using the contents of the objects latency slice.
 func (o *defaultTarget) estimateLatency() time.Duration {
-	o.rttLock.Lock()
-	observed := o.info[o.best].rtt
-	o.rttLock.Unlock()
+	_, ti := o.current()
+	return paddedRtt(ti.rtt)
+}
 
+// paddedRtt returns a retransmit timer value based on the supplied
+// latency samples.
+func paddedRtt(observed []time.Duration) time.Duration {
+	if len(observed) == 0 {
+		return communicate.InitialRTTGuess
+	}
+
+	// half-assed latency estimator does a rolling average then pads 25%
+	return time.Duration(float32(smoothedRtt(observed)) * float32(1.25))
+}
+
+// smoothedRtt returns a rolling average of the most recent latency samples.
+func smoothedRtt(observed []time.Duration) time.Duration {
 	if len(observed) == 0 {
 		return communicate.InitialRTTGuess
 	}
@@ -301,7 +339,6 @@ func (o *defaultTarget) estimateLatency() time.Duration {
 		observed = observed[lo-maxLatencySamples : lo]
 	}
 
-	// half-assed latency estimator does a rolling average then pads 25%
 	var result int64
 	for i, l := range observed {
 		switch i {
@@ -311,20 +348,20 @@ func (o *defaultTarget) estimateLatency() time.Duration {
 			result = (result + int64(l)) / 2
 		}
 	}
-	return time.Duration(float32(result) * float32(1.25))
+	return time.Duration(result)
 }
 
 // updateLatency adds the passed time.Duration as the most recent
 // latency sample to the specified targetInfo index.
 func (o *defaultTarget) updateLatency(index int, t time.Duration) {
-	o.rttLock.Lock()
+	o.lock.Lock()
 	l := len(o.info[index].rtt)
 	if l < maxLatencySamples {
 		o.info[index].rtt = append(o.info[index].rtt, t)
 	} else {
 		o.info[index].rtt = append(o.info[index].rtt, t)[l+1-maxLatencySamples : l+1]
 	}
-	o.rttLock.Unlock()
+	o.lock.Unlock()
 }
 
 type SendMessageConfig struct {
@@ -146,6 +146,22 @@ func TestSendBulkUnsafe(t *testing.T) {
 	log.Println(len(result))
 }
 
+func TestSendBulkRetryIndex(t *testing.T) {
+	tgt := &streamTarget{failures: map[string]int{"3": 1, "7": 2, "40": 1}}
+	results := sendBulk(tgt, streamMsgs(t, 50), nil)
+
+	seen := make(map[int]bool)
+	for _, r := range results {
+		if r.Err != nil || seen[r.Index] || r.Index < 0 || r.Index >= 50 {
+			t.Fatalf("unexpected result: %+v", r)
+		}
+		seen[r.Index] = true
+	}
+	if len(seen) != 50 || tgt.sentCount() != 54 {
+		t.Fatalf("got %d results from %d sends", len(seen), tgt.sentCount())
+	}
+}
+
 func TestAverageRtt(t *testing.T) {
 	var a []time.Duration
  	e := []time.Duration{
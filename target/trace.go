@@ -0,0 +1,72 @@
+package target
+
+import (
+	"fmt"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+)
+
+const (
+	// MaxTraceHops is the number of switches Trace() asks before
+	// giving up.
+	MaxTraceHops = 16
+)
+
+// TraceHop is one switch along a layer 2 trace.
+type TraceHop struct {
+	Address net.IP
+	Reply   message.Msg
+}
+
+// TraceResult is the outcome of a trace. Loop is set when a switch named
+// a neighbor which had already been asked.
+type TraceResult struct {
+	Hops []TraceHop
+	Loop bool
+}
+
+// Trace follows the layer 2 path from src to dst in vlan. It sends a
+// L2T_REQUEST_DST to the target, then to each CDP neighbor revealed along
+// the way. Targets for the neighbors are built with newBuilder. If hopFunc
+// is not nil, it's called as each hop completes. Hops completed before an
+// error are returned along with it.
+func Trace(t Target, newBuilder func() Builder, src net.HardwareAddr, dst net.HardwareAddr, vlan int, hopFunc func(TraceHop)) (TraceResult, error) {
+	result := TraceResult{Hops: []TraceHop{}}
+	visited := make(map[string]bool)
+	for hop := 1; hop <= MaxTraceHops; hop++ {
+		msg, err := traceQueryFrom(t.GetSrcIp(), src, dst, vlan)
+		if err != nil {
+			return result, err
+		}
+
+		reply, err := t.Send(msg)
+		if err != nil {
+			return result, fmt.Errorf("hop %d: %w", hop, err)
+		}
+
+		here := t.GetIps()[0]
+		visited[here.String()] = true
+		h := TraceHop{Address: here, Reply: reply}
+		result.Hops = append(result.Hops, h)
+		if hopFunc != nil {
+			hopFunc(h)
+		}
+
+		nbr := reply.GetAttr(attribute.NbrIPv4Type)
+		if nbr == nil {
+			return result, nil
+		}
+		if visited[nbr.String()] {
+			result.Loop = true
+			return result, nil
+		}
+
+		t, err = newBuilder().AddIp(net.ParseIP(nbr.String())).Build()
+		if err != nil {
+			return result, fmt.Errorf("hop %d: %w", hop+1, err)
+		}
+	}
+
+	return result, fmt.Errorf("%w: giving up after %d hops", ErrTraceTooLong, MaxTraceHops)
+}
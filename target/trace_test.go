@@ -0,0 +1,87 @@
+package target
+
+import (
+	"errors"
+	"github.com/chrismarget/cisco-l2t/attribute"
+	"github.com/chrismarget/cisco-l2t/communicate"
+	"github.com/chrismarget/cisco-l2t/message"
+	"net"
+	"testing"
+)
+
+// traceTarget is a switch at ip whose replies name neighbors[ip] as
+// the CDP neighbor.
+type traceTarget struct {
+	Target
+	ip        net.IP
+	neighbors map[string]string
+}
+
+func (o traceTarget) GetIps() []net.IP { return []net.IP{o.ip} }
+func (o traceTarget) GetSrcIp() net.IP { return net.ParseIP("192.0.2.1") }
+func (o traceTarget) Send(msg message.Msg) (message.Msg, error) {
+	builder := message.NewMsgBuilder().SetType(message.ReplyDst)
+	if nbr, ok := o.neighbors[o.ip.String()]; ok {
+		att, err := attribute.NewAttrBuilder().SetType(attribute.NbrIPv4Type).SetString(nbr).Build()
+		if err != nil {
+			return nil, err
+		}
+		builder.SetAttr(att)
+	}
+	return builder.Build(), nil
+}
+
+// traceBuilder builds traceTargets.
+type traceBuilder struct {
+	ip        net.IP
+	neighbors map[string]string
+}
+
+func (o *traceBuilder) AddIp(ip net.IP) Builder          { o.ip = ip; return o }
+func (o *traceBuilder) SetBind(communicate.Bind) Builder { return o }
+func (o *traceBuilder) Build() (Target, error) {
+	return traceTarget{ip: o.ip, neighbors: o.neighbors}, nil
+}
+
+func TestTrace(t *testing.T) {
+	src, _ := net.ParseMAC("0011.2233.4455")
+	dst, _ := net.ParseMAC("0011.2233.4466")
+
+	for _, test := range []struct {
+		neighbors map[string]string
+		hops      int
+		loop      bool
+		tooLong   bool
+	}{
+		{map[string]string{}, 1, false, false},
+		{map[string]string{"192.0.2.10": "192.0.2.11", "192.0.2.11": "192.0.2.12"}, 3, false, false},
+		{map[string]string{"192.0.2.10": "192.0.2.11", "192.0.2.11": "192.0.2.10"}, 2, true, false},
+	} {
+		newBuilder := func() Builder { return &traceBuilder{neighbors: test.neighbors} }
+		first, _ := newBuilder().AddIp(net.ParseIP("192.0.2.10")).Build()
+
+		var called int
+		r, err := Trace(first, newBuilder, src, dst, 10, func(TraceHop) { called++ })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Hops) != test.hops || called != test.hops || r.Loop != test.loop {
+			t.Fatalf("%v: unexpected result %+v", test.neighbors, r)
+		}
+		if !r.Hops[0].Address.Equal(net.ParseIP("192.0.2.10")) {
+			t.Fatalf("unexpected first hop %s", r.Hops[0].Address)
+		}
+	}
+
+	// every switch has a new neighbor
+	neighbors := make(map[string]string)
+	for i := 0; i <= MaxTraceHops; i++ {
+		neighbors[net.IPv4(192, 0, 2, byte(i)).String()] = net.IPv4(192, 0, 2, byte(i+1)).String()
+	}
+	newBuilder := func() Builder { return &traceBuilder{neighbors: neighbors} }
+	first, _ := newBuilder().AddIp(net.IPv4(192, 0, 2, 0)).Build()
+	r, err := Trace(first, newBuilder, src, dst, 10, nil)
+	if !errors.Is(err, ErrTraceTooLong) || len(r.Hops) != MaxTraceHops {
+		t.Fatalf("expected ErrTraceTooLong after %d hops, got %v after %d", MaxTraceHops, err, len(r.Hops))
+	}
+}